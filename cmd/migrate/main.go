@@ -0,0 +1,63 @@
+// Command migrate prepares log_entries for the configured DB_DRIVER, the
+// same as the API and worker do at startup. With -convert it also
+// partitions an existing plain table in place (MySQL with
+// DB_PARTITION_ENABLED=true), which startup never does because the rewrite
+// locks the table until it finishes:
+//
+//	DB_PARTITION_ENABLED=true go run ./cmd/migrate -convert
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/Yupoer/logpulse/internal/config"
+	"github.com/Yupoer/logpulse/internal/logging"
+	"github.com/Yupoer/logpulse/internal/repository"
+)
+
+func main() {
+	convert := flag.Bool("convert", false, "partition an existing unpartitioned log_entries in place (MySQL)")
+	flag.Parse()
+
+	cfg := config.LoadConfig()
+	if err := logging.Setup(cfg.Log, os.Stdout); err != nil {
+		fatal("Invalid log config", err)
+	}
+
+	backend, err := repository.NewRelationalBackend(cfg)
+	if err != nil {
+		fatal("Database connection failed", err)
+	}
+	defer func() {
+		if sqlDB, err := backend.DB.DB(); err == nil {
+			_ = sqlDB.Close()
+		}
+	}()
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	migrate := backend.Schema.Migrate
+	if *convert {
+		converter, ok := backend.Schema.(repository.TableConverter)
+		if !ok {
+			fatal("Cannot convert", errors.New("in-place conversion needs DB_DRIVER=mysql and DB_PARTITION_ENABLED=true"))
+		}
+		migrate = converter.Convert
+	}
+	if err := migrate(ctx); err != nil {
+		fatal("Migration failed", err)
+	}
+	slog.Info("Migration done", "driver", cfg.DBDriver, "partitioned", cfg.Partition.Enabled)
+}
+
+func fatal(msg string, err error) {
+	slog.Error(msg, "error", err)
+	os.Exit(1)
+}
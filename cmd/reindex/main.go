@@ -0,0 +1,85 @@
+// Command reindex rebuilds the Elasticsearch index from the relational DB.
+//
+// It streams log_entries by ID range into a new index, saving a checkpoint
+// after every batch, and finally points the "logs" alias at the new index:
+//
+//	go run ./cmd/reindex -index logs-v2 -rate 5000
+//
+// Re-running the same command after an interruption resumes from the
+// checkpoint. Without -index, a run resumes whatever index the checkpoint
+// names, or starts a new logs-<timestamp> one.
+package main
+
+import (
+	"context"
+	"flag"
+	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/Yupoer/logpulse/internal/config"
+	"github.com/Yupoer/logpulse/internal/logging"
+	"github.com/Yupoer/logpulse/internal/repository"
+	"github.com/Yupoer/logpulse/internal/service"
+)
+
+func main() {
+	index := flag.String("index", "", "target index to create and fill (default: the checkpoint's index, else logs-<timestamp>)")
+	alias := flag.String("alias", "logs", "alias switched to the new index when done (empty to skip)")
+	replace := flag.Bool("replace-index", false, "delete a concrete index named like the alias during the switch")
+	mappingPath := flag.String("mapping", "", "optional JSON file with settings/mappings for the new index")
+	batchSize := flag.Int("batch", 1000, "entries per DB page and bulk request")
+	rate := flag.Float64("rate", 0, "max entries per second (0 = unlimited)")
+	checkpoint := flag.String("checkpoint", "reindex.checkpoint.json", "checkpoint file used to resume")
+	progress := flag.Duration("progress", 5*time.Second, "progress report interval")
+	flag.Parse()
+
+	cfg := config.LoadConfig()
+	if err := logging.Setup(cfg.Log, os.Stdout); err != nil {
+		fatal("Invalid log config", err)
+	}
+
+	var mapping []byte
+	if *mappingPath != "" {
+		var err error
+		if mapping, err = os.ReadFile(*mappingPath); err != nil {
+			fatal("Failed to read mapping", err)
+		}
+	}
+
+	backend, err := repository.NewRelationalBackend(cfg)
+	if err != nil {
+		fatal("Database connection failed", err)
+	}
+	indexAdmin, err := repository.NewESIndexAdmin(cfg.ESAddress)
+	if err != nil {
+		fatal("Failed to connect to Elasticsearch", err)
+	}
+
+	// Stop cleanly on Ctrl+C; the checkpoint keeps the progress
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	reindexService := service.NewReindexService(backend.Logs, indexAdmin)
+	_, err = reindexService.Run(ctx, service.ReindexOptions{
+		Index:          *index,
+		Mapping:        mapping,
+		Alias:          *alias,
+		ReplaceIndex:   *replace,
+		BatchSize:      *batchSize,
+		Rate:           *rate,
+		CheckpointPath: *checkpoint,
+		ProgressEvery:  *progress,
+	})
+	if err != nil {
+		slog.Error("Reindex failed, re-run to resume from the checkpoint", "checkpoint", *checkpoint, "error", err)
+		os.Exit(1)
+	}
+}
+
+func fatal(msg string, err error) {
+	slog.Error(msg, "error", err)
+	os.Exit(1)
+}
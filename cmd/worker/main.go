@@ -0,0 +1,49 @@
+// Command worker consumes logs from Kafka into the relational DB and
+// Elasticsearch. It is the same as running the API binary with -role=worker,
+// so ingestion HTTP and indexing can be scaled independently.
+package main
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/Yupoer/logpulse/internal/app"
+	"github.com/Yupoer/logpulse/internal/config"
+	"github.com/Yupoer/logpulse/internal/logging"
+)
+
+func main() {
+	cfg := config.LoadConfig()
+	if err := logging.Setup(cfg.Log, os.Stdout); err != nil {
+		fatal("Invalid log config", err)
+	}
+	if err := cfg.Validate(); err != nil {
+		fatal("Invalid config", err)
+	}
+
+	application, err := app.New(cfg, app.RoleWorker)
+	if err != nil {
+		fatal("Startup failed", err)
+	}
+
+	// Stop on SIGINT/SIGTERM after the final flush has committed its offsets
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	runErr := application.Run(ctx)
+	if err := application.Close(); err != nil {
+		slog.Error("Failed to close connections", "error", err)
+	}
+	if runErr != nil {
+		fatal("Exiting with error", runErr)
+	}
+	slog.Info("Worker exiting")
+}
+
+func fatal(msg string, err error) {
+	slog.Error(msg, "error", err)
+	os.Exit(1)
+}
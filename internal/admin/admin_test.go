@@ -0,0 +1,157 @@
+package admin
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Yupoer/logpulse/internal/config"
+	"github.com/Yupoer/logpulse/internal/logging"
+)
+
+func init() { gin.SetMode(gin.TestMode) }
+
+func serve(t *testing.T, cfg *config.Config, method, path, body string) *httptest.ResponseRecorder {
+	t.Helper()
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	NewRouter(cfg, "api", time.Now()).ServeHTTP(w, req)
+	return w
+}
+
+func TestConfig_RedactsSecrets(t *testing.T) {
+	tests := []struct {
+		name  string
+		dsn   string
+		clean string
+	}{
+		{"MySQL", "logpulse:hunter2@tcp(mysql:3306)/logpulse?parseTime=true", "logpulse:[REDACTED]@tcp(mysql:3306)/logpulse?parseTime=true"},
+		{"PostgresKeyValue", "host=pg port=5432 user=logpulse password=hunter2 dbname=logpulse", "host=pg port=5432 user=logpulse password=[REDACTED] dbname=logpulse"},
+		{"PostgresURL", "postgres://logpulse:hunter2@pg:5432/logpulse", "postgres://logpulse:[REDACTED]@pg:5432/logpulse"},
+		// Passwords may contain the separators themselves
+		{"MySQLSeparatorsInPassword", "logpulse:hunter2@p:ss/w0rd@tcp(mysql:3306)/logpulse", "logpulse:[REDACTED]@tcp(mysql:3306)/logpulse"},
+		{"PostgresURLSeparatorsInPassword", "postgres://logpulse:hunter2@p:ss/w0rd@pg:5432/logpulse", "postgres://logpulse:[REDACTED]@pg:5432/logpulse"},
+		{"PostgresKeyValueQuoted", "host=pg password='hunter2 p@ss:w0rd' dbname=logpulse", "host=pg password=[REDACTED] dbname=logpulse"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &config.Config{
+				DBUrl:     tt.dsn,
+				ESAddress: "http://elasticsearch:9200",
+				Archive:   config.ArchiveConfig{S3AccessKey: "AKIA", S3SecretKey: "hunter2", S3Region: "us-east-1"},
+			}
+
+			w := serve(t, cfg, http.MethodGet, "/debug/config", "")
+
+			require.Equal(t, http.StatusOK, w.Code)
+			assert.NotContains(t, w.Body.String(), "hunter2")
+			var dump map[string]any
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &dump))
+			assert.Equal(t, tt.clean, dump["DBUrl"])
+			assert.Equal(t, "http://elasticsearch:9200", dump["ESAddress"])
+			archive := dump["Archive"].(map[string]any)
+			assert.Equal(t, Redacted, archive["S3SecretKey"])
+			assert.Equal(t, Redacted, archive["S3AccessKey"])
+			assert.Equal(t, "us-east-1", archive["S3Region"])
+		})
+	}
+}
+
+func TestConfig_LeavesEmptySecretsEmpty(t *testing.T) {
+	w := serve(t, &config.Config{}, http.MethodGet, "/debug/config", "")
+
+	require.Equal(t, http.StatusOK, w.Code)
+	var dump map[string]any
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &dump))
+	assert.Equal(t, "", dump["Archive"].(map[string]any)["S3SecretKey"])
+}
+
+func TestLogLevel_Toggle(t *testing.T) {
+	require.NoError(t, logging.Setup(config.LogConfig{Level: "info", Format: "json"}, &strings.Builder{}))
+	t.Cleanup(func() { _ = logging.SetLevel("info") })
+
+	w := serve(t, &config.Config{}, http.MethodPut, "/debug/loglevel", `{"level":"debug"}`)
+
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"level":"debug"}`, w.Body.String())
+	assert.Equal(t, slog.LevelDebug, logging.Level())
+	assert.True(t, slog.Default().Enabled(t.Context(), slog.LevelDebug))
+
+	w = serve(t, &config.Config{}, http.MethodGet, "/debug/loglevel", "")
+	assert.JSONEq(t, `{"level":"debug"}`, w.Body.String())
+}
+
+func TestLogLevel_RejectsUnknownLevel(t *testing.T) {
+	w := serve(t, &config.Config{}, http.MethodPut, "/debug/loglevel", `{"level":"loud"}`)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestPprof(t *testing.T) {
+	w := serve(t, &config.Config{}, http.MethodGet, "/debug/pprof/", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), "goroutine")
+
+	w = serve(t, &config.Config{}, http.MethodGet, "/debug/pprof/heap?debug=1", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), "heap profile")
+
+	w = serve(t, &config.Config{}, http.MethodGet, "/debug/goroutines", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), "goroutine ")
+}
+
+func TestBuildInfoAndRuntime(t *testing.T) {
+	w := serve(t, &config.Config{}, http.MethodGet, "/debug/buildinfo", "")
+	require.Equal(t, http.StatusOK, w.Code)
+	var info map[string]any
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &info))
+	assert.Equal(t, "api", info["role"])
+	assert.NotEmpty(t, info["go_version"])
+
+	w = serve(t, &config.Config{}, http.MethodGet, "/debug/runtime", "")
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"goroutines"`)
+}
+
+func TestConfig_HashesAPIKeys(t *testing.T) {
+	cfg := &config.Config{RateLimit: config.RateLimitConfig{
+		// Keys sharing a prefix must not collide, and short keys stay apart too
+		APIKeys: map[string]string{"abcd1234secret": "acme", "abcd5678secret": "acme", "k1": "", "k2": ""},
+		Overrides: map[string]string{
+			"api_key:abcd1234secret":                  "pro",
+			"api_key:abcd5678secret:service:checkout": "pro",
+			"tenant:acme":                             "pro",
+		},
+	}}
+
+	w := serve(t, cfg, http.MethodGet, "/debug/config", "")
+
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.NotContains(t, w.Body.String(), "secret")
+	var dump map[string]any
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &dump))
+	rateLimit := dump["RateLimit"].(map[string]any)
+	label := func(key string) string {
+		sum := sha256.Sum256([]byte(key))
+		return "sha256:" + hex.EncodeToString(sum[:8])
+	}
+	assert.Equal(t, map[string]any{
+		label("abcd1234secret"): "acme", label("abcd5678secret"): "acme", label("k1"): "", label("k2"): "",
+	}, rateLimit["APIKeys"])
+	assert.Equal(t, map[string]any{
+		"api_key:" + label("abcd1234secret"):                       "pro",
+		"api_key:" + label("abcd5678secret") + ":service:checkout": "pro",
+		"tenant:acme": "pro",
+	}, rateLimit["Overrides"])
+}
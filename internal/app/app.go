@@ -0,0 +1,687 @@
+// Package app wires LogPulse's components from config, so the API and
+// worker binaries share one startup path and differ only in their role.
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/extra/redisotel/v9"
+	"github.com/redis/go-redis/v9"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/gin-gonic/gin/otelgin"
+
+	"github.com/Yupoer/logpulse/internal/admin"
+	"github.com/Yupoer/logpulse/internal/config"
+	"github.com/Yupoer/logpulse/internal/domain"
+	"github.com/Yupoer/logpulse/internal/envelope"
+	"github.com/Yupoer/logpulse/internal/handler"
+	"github.com/Yupoer/logpulse/internal/health"
+	"github.com/Yupoer/logpulse/internal/metrics"
+	"github.com/Yupoer/logpulse/internal/middleware"
+	"github.com/Yupoer/logpulse/internal/repository"
+	"github.com/Yupoer/logpulse/internal/resilience"
+	"github.com/Yupoer/logpulse/internal/service"
+	"github.com/Yupoer/logpulse/internal/tracing"
+)
+
+// Role selects which parts of LogPulse a process runs
+type Role string
+
+const (
+	RoleAPI    Role = "api"    // HTTP ingestion and queries
+	RoleWorker Role = "worker" // Queue consumer and schema maintenance
+	RoleAll    Role = "all"    // Both, in one process
+)
+
+const (
+	// consumerGroupID is shared by every worker, so partitions are split among them
+	consumerGroupID = "logpulse-group"
+
+	httpShutdownTimeout   = 5 * time.Second
+	traceShutdownTimeout  = 5 * time.Second  // Export of buffered spans
+	workerShutdownTimeout = 30 * time.Second // Covers the consumer's final flush
+
+	// How often each worker publishes its stats for /admin/pipeline
+	consumerStatsInterval = 5 * time.Second
+)
+
+func ParseRole(s string) (Role, error) {
+	switch Role(s) {
+	case RoleAPI, RoleWorker, RoleAll:
+		return Role(s), nil
+	}
+	return "", fmt.Errorf("unknown role %q (want api, worker or all)", s)
+}
+
+func (r Role) runsAPI() bool    { return r == RoleAPI || r == RoleAll }
+func (r Role) runsWorker() bool { return r == RoleWorker || r == RoleAll }
+
+// App holds the infrastructure shared by both roles
+type App struct {
+	cfg  *config.Config
+	role Role
+
+	backend     *repository.RelationalBackend
+	rdb         *redis.Client
+	esRepo      domain.LogSearchRepository
+	deadLetters domain.DeadLetterQueue // nil when the dead-letter topic is disabled
+	encoder     envelope.Encoder
+	queues      map[string]*repository.ChannelQueue // Per lane name, only for the channel backend
+	breakers    *resilience.Registry
+	backoff     resilience.Backoff
+
+	// Circuit breakers per dependency, reported by /ping
+	queueBreaker *resilience.Breaker // Around the producer
+	dbBreaker    *resilience.Breaker
+	esBreaker    *resilience.Breaker
+
+	health *handler.HealthHandler // Shared by the API and metrics listeners
+
+	background sync.WaitGroup // Goroutines Run waits for on shutdown
+	closers    []func() error // Run in reverse order by Close
+}
+
+// New connects to the infrastructure role needs and migrates the schema
+func New(cfg *config.Config, role Role) (*App, error) {
+	rc := cfg.Resilience
+	a := &App{
+		cfg:      cfg,
+		role:     role,
+		breakers: resilience.NewRegistry(),
+		backoff:  resilience.Backoff{Initial: rc.RetryInitialBackoff, Max: rc.RetryMaxBackoff, Jitter: 0.5},
+	}
+	// Tracing first, so every client created below picks up the provider
+	shutdownTracing, err := tracing.Setup(context.Background(), cfg.Tracing, "logpulse-"+string(role))
+	if err != nil {
+		return nil, err
+	}
+	a.closers = append(a.closers, func() error {
+		ctx, cancel := context.WithTimeout(context.Background(), traceShutdownTimeout)
+		defer cancel()
+		return shutdownTracing(ctx)
+	})
+
+	// Named after the queue backend ("kafka", "redis" or "channel")
+	a.queueBreaker = a.breakers.NewBreaker(cfg.Queue.Backend, rc.BreakerFailureThreshold, rc.BreakerOpenTimeout)
+	a.dbBreaker = a.breakers.NewBreaker("database", rc.BreakerFailureThreshold, rc.BreakerOpenTimeout)
+	a.esBreaker = a.breakers.NewBreaker("elasticsearch", rc.BreakerFailureThreshold, rc.BreakerOpenTimeout)
+
+	host, _ := os.Hostname()
+	encoder, err := envelope.NewEncoder(cfg.KafkaEncoding, "logpulse-api/"+host)
+	if err != nil {
+		return nil, fmt.Errorf("invalid KAFKA_ENCODING: %w", err)
+	}
+	a.encoder = encoder
+
+	switch cfg.Queue.Backend {
+	case "kafka", "redis":
+	case "channel":
+		// The API and the worker must share the process to share the channel
+		if role != RoleAll {
+			return nil, fmt.Errorf("QUEUE_BACKEND=channel needs role all, got %s", role)
+		}
+		a.queues = map[string]*repository.ChannelQueue{}
+		for _, lane := range a.queueLanes() {
+			a.queues[lane.name] = repository.NewChannelQueue(cfg.Queue.ChannelSize, encoder)
+		}
+	default:
+		return nil, fmt.Errorf("unknown QUEUE_BACKEND %q (want kafka, redis or channel)", cfg.Queue.Backend)
+	}
+
+	if err := a.connect(); err != nil {
+		_ = a.Close()
+		return nil, err
+	}
+	return a, nil
+}
+
+func (a *App) connect() error {
+	// Relational DB (MySQL / PostgreSQL / SQLite, selected by DB_DRIVER)
+	backend, err := repository.NewRelationalBackend(a.cfg)
+	if err != nil {
+		return fmt.Errorf("database connection failed: %w", err)
+	}
+	a.backend = backend
+	a.closers = append(a.closers, func() error {
+		sqlDB, err := backend.DB.DB()
+		if err != nil {
+			return err
+		}
+		return sqlDB.Close()
+	})
+	if err := backend.Schema.Migrate(context.Background()); err != nil {
+		return fmt.Errorf("database migration failed: %w", err)
+	}
+
+	// Redis (rate limiting, caching, archive locks, the redis queue backend)
+	a.rdb = redis.NewClient(&redis.Options{Addr: a.cfg.RedisAddr})
+	a.closers = append(a.closers, a.rdb.Close)
+	if err := redisotel.InstrumentTracing(a.rdb); err != nil {
+		return fmt.Errorf("redis tracing setup failed: %w", err)
+	}
+	if err := a.rdb.Ping(context.Background()).Err(); err != nil {
+		return fmt.Errorf("redis connection failed: %w", err)
+	}
+
+	// ES Repo init
+	if a.esRepo, err = repository.NewESLogRepository(a.cfg.ESAddress); err != nil {
+		return fmt.Errorf("failed to connect to Elasticsearch: %w", err)
+	}
+
+	// Dead-letter topic for poison and permanently failing messages (Kafka
+	// backend only; other backends log and skip poison messages)
+	if a.cfg.DeadLetter.Enabled && a.cfg.Queue.Backend == "kafka" {
+		if a.deadLetters, err = repository.NewKafkaDeadLetterQueue(a.cfg.KafkaBrokers, a.cfg.DeadLetter.Topic); err != nil {
+			return fmt.Errorf("failed to initialize dead-letter queue: %w", err)
+		}
+		a.closers = append(a.closers, a.deadLetters.Close)
+	}
+	return nil
+}
+
+// Run starts the role's components and blocks until ctx is done. Shutdown
+// first drains HTTP requests, then waits for the consumer's final flush so
+// its offsets are committed before the connections close.
+func (a *App) Run(ctx context.Context) error {
+	// Background work (worker, spool drain, archive) outlives ctx until the
+	// HTTP server has drained, so logs accepted meanwhile are still handled
+	bgCtx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+	defer cancel()
+
+	// The admin listener is off by default and should stay on a private
+	// address: it exposes pprof, the effective config and the /admin/*
+	// operator endpoints
+	var adminRouter *gin.Engine
+	if a.cfg.Admin.Enabled {
+		adminRouter = admin.NewRouter(a.cfg, string(a.role), time.Now())
+	}
+
+	if a.role.runsWorker() {
+		if err := a.startWorker(bgCtx); err != nil {
+			return err
+		}
+	}
+
+	// Every role serves /metrics and the probes on METRICS_PORT, so scrapes
+	// stay off the public API port
+	serverErr := make(chan error, 3) // API, metrics and admin listeners
+	var srv *http.Server
+	if a.role.runsAPI() {
+		router, err := a.router(bgCtx, adminRouter)
+		if err != nil {
+			return err
+		}
+		srv = &http.Server{
+			Addr:    ":" + a.cfg.ServerPort,
+			Handler: router,
+		}
+		go func() {
+			slog.Info("Starting server", "addr", srv.Addr, "role", a.role)
+			if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				serverErr <- err
+			}
+		}()
+	}
+
+	metricsSrv := &http.Server{
+		Addr:    ":" + a.cfg.MetricsPort,
+		Handler: a.metricsRouter(),
+	}
+	go func() {
+		slog.Info("Starting metrics server", "addr", metricsSrv.Addr)
+		if err := metricsSrv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			serverErr <- fmt.Errorf("metrics: %w", err)
+		}
+	}()
+
+	var adminSrv *http.Server
+	if adminRouter != nil {
+		adminSrv = &http.Server{
+			Addr:    a.cfg.Admin.Addr,
+			Handler: adminRouter,
+		}
+		go func() {
+			slog.Info("Starting admin server", "addr", adminSrv.Addr)
+			if err := adminSrv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				serverErr <- fmt.Errorf("admin: %w", err)
+			}
+		}()
+	}
+
+	var runErr error
+	select {
+	case <-ctx.Done():
+	case runErr = <-serverErr:
+		runErr = fmt.Errorf("server listen error: %w", runErr)
+	}
+	slog.Info("Shutting down", "role", a.role)
+
+	shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), httpShutdownTimeout)
+	defer shutdownCancel()
+	if srv != nil {
+		if err := srv.Shutdown(shutdownCtx); err != nil {
+			slog.Error("Server forced to shutdown", "error", err)
+		}
+	}
+	if err := metricsSrv.Shutdown(shutdownCtx); err != nil {
+		slog.Error("Metrics server forced to shutdown", "error", err)
+	}
+	if adminSrv != nil {
+		if err := adminSrv.Shutdown(shutdownCtx); err != nil {
+			slog.Error("Admin server forced to shutdown", "error", err)
+		}
+	}
+	cancel()
+
+	done := make(chan struct{})
+	go func() {
+		a.background.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(workerShutdownTimeout):
+		slog.Warn("Background tasks did not stop in time, unflushed logs will be redelivered", "timeout", workerShutdownTimeout)
+	}
+	return runErr
+}
+
+// Close releases connections in reverse order of creation
+func (a *App) Close() error {
+	var errs []error
+	for i := len(a.closers) - 1; i >= 0; i-- {
+		errs = append(errs, a.closers[i]())
+	}
+	a.closers = nil
+	return errors.Join(errs...)
+}
+
+// goBackground runs fn in a goroutine that Run waits for on shutdown.
+// fn must return once ctx is done.
+func (a *App) goBackground(fn func()) {
+	a.background.Add(1)
+	go func() {
+		defer a.background.Done()
+		fn()
+	}()
+}
+
+// queueLane is the default topic or one of the configured priority lanes
+type queueLane struct {
+	name     string // "" for the default topic
+	topic    string // Kafka topic or Redis stream
+	consumer config.ConsumerConfig
+}
+
+// groupID gives every lane its own consumer group, so each group has a
+// single subscription
+func (l queueLane) groupID() string {
+	if l.name == "" {
+		return consumerGroupID
+	}
+	return consumerGroupID + "-" + l.name
+}
+
+// queueLanes lists the default topic first, then the lanes in routing order
+func (a *App) queueLanes() []queueLane {
+	topic := a.cfg.KafkaTopic
+	if a.cfg.Queue.Backend == "redis" {
+		topic = a.cfg.Queue.RedisStream
+	}
+	lanes := []queueLane{{topic: topic, consumer: a.cfg.Consumer}}
+	for _, l := range a.cfg.Lanes {
+		lanes = append(lanes, queueLane{name: l.Name, topic: l.Topic, consumer: l.Consumer})
+	}
+	return lanes
+}
+
+func (a *App) startWorker(ctx context.Context) error {
+	// Built first, so a bad archive config fails before anything starts
+	var archiveService *service.ArchiveService
+	if a.cfg.Archive.Enabled {
+		var err error
+		if archiveService, err = a.archiveService(ctx); err != nil {
+			return err
+		}
+	}
+
+	var consumers []domain.LogConsumer
+	for _, lane := range a.queueLanes() {
+		consumers = append(consumers, a.newConsumer(lane))
+	}
+	consumerWorker := repository.NewLaneConsumers(consumers...)
+
+	a.goBackground(func() {
+		slog.Info("Starting consumer worker", "backend", a.cfg.Queue.Backend)
+		consumerWorker.Run(ctx)
+		slog.Info("Consumer worker stopped", "backend", a.cfg.Queue.Backend)
+	})
+
+	// Share batch fill and error counts with the API through Redis
+	statsStore := repository.NewConsumerStatsStore(a.rdb)
+	a.goBackground(func() {
+		service.PublishConsumerStats(ctx, statsStore, service.ReplicaName(), consumerWorker.Stats, consumerStatsInterval)
+	})
+
+	// Pre-create future partitions and drop expired ones (Background)
+	a.goBackground(func() { repository.RunSchemaMaintenance(ctx, a.backend.Schema, 1*time.Hour) })
+
+	// Archive aged days before their partitions are dropped (Background)
+	if archiveService != nil {
+		a.goBackground(func() { archiveService.Run(ctx, 1*time.Hour) })
+	}
+	return nil
+}
+
+// newConsumer builds lane's consumer for the configured queue backend. Every
+// worker process joins the same group and shares the partitions (or stream).
+func (a *App) newConsumer(lane queueLane) domain.LogConsumer {
+	res := repository.ConsumerResilience{
+		Backoff:   a.backoff,
+		DBBreaker: a.dbBreaker,
+		ESBreaker: a.esBreaker,
+	}
+	maxAttempts := a.cfg.DeadLetter.MaxAttempts
+	switch a.cfg.Queue.Backend {
+	case "redis":
+		queueCfg := a.cfg.Queue
+		queueCfg.RedisStream = lane.topic
+		c := repository.NewRedisStreamConsumer(a.backend.Logs, a.esRepo, a.deadLetters, maxAttempts, res)
+		c.SetBatching(lane.consumer)
+		return c.Subscribe(a.rdb, queueCfg, lane.groupID(), service.ReplicaName())
+	case "channel":
+		c := repository.NewChannelConsumer(a.backend.Logs, a.esRepo, a.deadLetters, maxAttempts, res)
+		c.SetBatching(lane.consumer)
+		return c.Subscribe(a.queues[lane.name])
+	default:
+		c := repository.NewKafkaConsumer(a.backend.Logs, a.esRepo, a.deadLetters, maxAttempts, res)
+		c.SetBatching(lane.consumer)
+		return c.Subscribe(a.cfg.KafkaBrokers, lane.topic, lane.groupID())
+	}
+}
+
+// newProducer builds the producer for lane's topic. The async Kafka producer
+// is also returned on its own, for its delivery stats.
+func (a *App) newProducer(lane queueLane, onError repository.DeliveryErrorFunc) (domain.LogProducer, *repository.KafkaAsyncProducer, error) {
+	switch {
+	case a.cfg.Queue.Backend == "redis":
+		queueCfg := a.cfg.Queue
+		queueCfg.RedisStream = lane.topic
+		return repository.NewRedisStreamProducer(a.rdb, queueCfg, a.encoder, a.queueBreaker), nil, nil
+	case a.cfg.Queue.Backend == "channel":
+		return a.queues[lane.name].Producer(), nil, nil
+	case a.cfg.KafkaProducer.Mode == "async":
+		p, err := repository.NewKafkaAsyncProducer(a.cfg.KafkaBrokers, lane.topic, a.cfg.KafkaProducer, a.encoder, a.queueBreaker, onError)
+		if err != nil {
+			return nil, nil, err
+		}
+		return p, p, nil
+	default:
+		rc := a.cfg.Resilience
+		p, err := repository.NewKafkaProducer(a.cfg.KafkaBrokers, lane.topic, a.cfg.KafkaProducer, a.encoder, a.queueBreaker, resilience.RetryPolicy{
+			MaxAttempts: rc.RetryMaxAttempts,
+			Backoff:     a.backoff,
+			Budget:      resilience.NewRetryBudget(rc.RetryBudgetRatio, 1),
+		})
+		return p, nil, err
+	}
+}
+
+// router builds the public API router. The operator endpoints under
+// /admin go on adminRouter instead, and are not served when it is nil.
+func (a *App) router(ctx context.Context, adminRouter *gin.Engine) (*gin.Engine, error) {
+	// Queue Producer, one per lane
+	var asyncProducers []*repository.KafkaAsyncProducer
+	// Async logs that fail after SendLog returned are kept in the spool, if
+	// enabled. The producers report from their own goroutines as soon as
+	// they exist, before the spool (which wraps them) does
+	var spoolRef atomic.Pointer[repository.SpoolProducer]
+	onError := func(entry *domain.LogEntry, err error) {
+		spool := spoolRef.Load()
+		if spool == nil {
+			return
+		}
+		if spoolErr := spool.Spool(entry); spoolErr != nil {
+			slog.Error("Undelivered log lost, spool failed", "service", entry.ServiceName, "error", spoolErr)
+		}
+	}
+	var producers []domain.LogProducer
+	for _, lane := range a.queueLanes() {
+		p, async, err := a.newProducer(lane, onError)
+		if err != nil {
+			for _, p := range producers {
+				_ = p.Close()
+			}
+			return nil, fmt.Errorf("failed to initialize queue producer: %w", err)
+		}
+		laneName := lane.name
+		if laneName == "" {
+			laneName = "default"
+		}
+		producers = append(producers, metrics.InstrumentProducer(p, a.cfg.Queue.Backend, laneName))
+		if async != nil {
+			asyncProducers = append(asyncProducers, async)
+		}
+	}
+	producer := producers[0]
+	if len(a.cfg.Lanes) > 0 {
+		routed := make([]repository.RoutedLane, len(a.cfg.Lanes))
+		for i, lane := range a.cfg.Lanes {
+			routed[i] = repository.RoutedLane{Lane: lane, Producer: producers[i+1]}
+		}
+		producer = repository.NewLaneRouter(routed, producers[0])
+	}
+
+	// Local disk spool in front of Kafka, so accepted logs survive an outage
+	var spool *repository.SpoolProducer
+	if a.cfg.Spool.Enabled {
+		var err error
+		if spool, err = repository.NewSpoolProducer(producer, a.cfg.Spool, a.backoff); err != nil {
+			_ = producer.Close()
+			return nil, fmt.Errorf("failed to open spool: %w", err)
+		}
+		spoolRef.Store(spool)
+		producer = spool
+		metrics.ObserveSpool(func() (int64, int64) {
+			stats := spool.Stats()
+			return stats.Entries, stats.Bytes
+		})
+		a.goBackground(func() { spool.Run(ctx) })
+	}
+	a.closers = append(a.closers, producer.Close)
+
+	statsRepo := repository.NewLogCacheRepository(a.rdb)
+	logService := service.NewLogService(producer, a.backend.Logs, statsRepo, a.esRepo)
+	logHandler := handler.NewLogHandler(logService)
+
+	// Router Setup
+	r := gin.New()
+	r.Use(gin.Recovery())
+	// X-Forwarded-For is only believed from the proxies in front (nginx), so
+	// clients can't pick the IP they are rate limited as
+	if err := r.SetTrustedProxies(a.cfg.TrustedProxies); err != nil {
+		return nil, fmt.Errorf("invalid TRUSTED_PROXIES: %w", err)
+	}
+
+	// Probes, ahead of logging, tracing, metrics and rate limiting, which
+	// would only add noise every few seconds
+	a.healthRoutes(r)
+
+	// Request ID first, so the request's log lines and queued logs carry it;
+	// then the server span per request, continuing the caller's trace
+	// (traceparent header); the access log sees both
+	r.Use(middleware.RequestID())
+	r.Use(otelgin.Middleware("logpulse-api"))
+	r.Use(middleware.AccessLog())
+
+	// Prometheus metrics, ahead of the rate limiter so rejected requests are
+	// counted too. /metrics itself is served on METRICS_PORT
+	r.Use(middleware.Metrics(a.cfg.MetricsServices))
+
+	// While /readyz fails, everything else gets 503 without taking tokens,
+	// so nginx drains this replica
+	a.goBackground(func() { a.health.Watch(ctx) })
+	r.Use(a.health.RequireReady())
+
+	// Rate Limiter Middleware (Token Bucket via Redis Lua Script)
+	// Its own breaker: with the Redis queue backend, "redis" is the producer's
+	rc := a.cfg.Resilience
+	rateLimitBreaker := a.breakers.NewBreaker("ratelimit", rc.BreakerFailureThreshold, rc.BreakerOpenTimeout)
+	rateLimiter, err := middleware.NewRateLimiter(a.rdb, a.cfg.RateLimit, rateLimitBreaker)
+	if err != nil {
+		return nil, err
+	}
+	r.Use(rateLimiter.Middleware())
+
+	r.GET("/ping", func(c *gin.Context) {
+		res := gin.H{
+			"message":  "pong",
+			"breakers": a.breakers.States(),
+			"degraded": len(a.breakers.Open()) > 0,
+		}
+		if spool != nil {
+			res["spool"] = spool.Stats()
+		}
+		if len(asyncProducers) > 0 {
+			var stats repository.ProducerStats
+			for _, p := range asyncProducers {
+				s := p.Stats()
+				stats.Delivered += s.Delivered
+				stats.Failed += s.Failed
+				stats.BufferedBytes += s.BufferedBytes
+			}
+			res["producer"] = stats
+		}
+		c.JSON(200, res)
+	})
+	r.POST("/logs", logHandler.CreateLog)
+	r.GET("/logs/:id", logHandler.GetLog)
+	r.GET("/logs/search", logHandler.SearchLogs)
+
+	if adminRouter == nil {
+		return r, nil
+	}
+
+	// Cold Archive (aged-out logs -> compressed segments, rehydrate on
+	// demand). The scheduled run is the worker's; these are manual
+	if a.cfg.Archive.Enabled {
+		archiveService, err := a.archiveService(ctx)
+		if err != nil {
+			return nil, err
+		}
+		archiveHandler := handler.NewArchiveHandler(archiveService)
+		archive := adminRouter.Group("/admin/archive")
+		archive.POST("/days/:day", archiveHandler.ArchiveDay)
+		archive.GET("/days/:day", archiveHandler.GetManifest)
+		archive.POST("/rehydrate", archiveHandler.Rehydrate)
+		archive.GET("/rehydrated/:index/search", archiveHandler.SearchRehydrated)
+		archive.DELETE("/rehydrated/:index", archiveHandler.DropRehydrated)
+	}
+
+	// Dead-letter inspection and replay
+	if a.deadLetters != nil {
+		deadLetterHandler := handler.NewDeadLetterHandler(service.NewDeadLetterService(a.deadLetters))
+		dlq := adminRouter.Group("/admin/dlq")
+		dlq.GET("", deadLetterHandler.List)
+		dlq.GET("/:partition/:offset", deadLetterHandler.Get)
+		dlq.POST("/:partition/:offset/replay", deadLetterHandler.Replay)
+	}
+
+	// Consumer lag (Kafka backend only) and worker replica stats
+	var groups []string
+	for _, lane := range a.queueLanes() {
+		groups = append(groups, lane.groupID())
+	}
+	var offsets domain.OffsetInspector
+	if a.cfg.Queue.Backend == "kafka" {
+		var inspectors []domain.OffsetInspector
+		for _, lane := range a.queueLanes() {
+			inspector, err := repository.NewKafkaOffsetInspector(a.cfg.KafkaBrokers, lane.topic, lane.groupID())
+			if err != nil {
+				return nil, fmt.Errorf("failed to initialize Kafka offset inspector: %w", err)
+			}
+			a.closers = append(a.closers, inspector.Close)
+			inspectors = append(inspectors, inspector)
+		}
+		offsets = repository.NewLaneOffsetInspectors(inspectors...)
+	}
+	pipelineService := service.NewPipelineService(offsets, repository.NewConsumerStatsStore(a.rdb), groups)
+	adminRouter.GET("/admin/pipeline", handler.NewPipelineHandler(pipelineService).Status)
+
+	return r, nil
+}
+
+// healthRoutes registers /healthz and /readyz. /readyz checks the DB,
+// Redis, Elasticsearch and the queue; the ones in cfg.Health.Critical decide
+// whether the process is ready.
+func (a *App) healthRoutes(r gin.IRoutes) {
+	if a.health == nil {
+		checker := health.NewChecker(a.cfg.Health.Timeout, a.healthChecks()...)
+		checker.ReportBreakers(a.breakers.States)
+		a.health = handler.NewHealthHandler(checker)
+	}
+	r.GET("/healthz", a.health.Healthz)
+	r.GET("/readyz", a.health.Readyz)
+}
+
+func (a *App) healthChecks() []health.Check {
+	critical := func(name string) bool { return slices.Contains(a.cfg.Health.Critical, name) }
+	checks := []health.Check{
+		{Name: "database", Critical: critical("database"), Probe: func(ctx context.Context) error {
+			sqlDB, err := a.backend.DB.DB()
+			if err != nil {
+				return err
+			}
+			return sqlDB.PingContext(ctx)
+		}},
+		{Name: "redis", Critical: critical("redis"), Probe: func(ctx context.Context) error {
+			return a.rdb.Ping(ctx).Err()
+		}},
+		{Name: "elasticsearch", Critical: critical("elasticsearch"), Probe: a.esRepo.Ping},
+	}
+	if a.cfg.Queue.Backend == "kafka" {
+		pinger := repository.NewKafkaPinger(a.cfg.KafkaBrokers, a.cfg.KafkaTopic, a.cfg.Health.Timeout)
+		a.closers = append(a.closers, pinger.Close)
+		checks = append(checks, health.Check{Name: "kafka", Critical: critical("kafka"), Probe: pinger.Ping})
+	}
+	return checks
+}
+
+// metricsRouter serves /metrics and the probes on METRICS_PORT
+func (a *App) metricsRouter() http.Handler {
+	r := gin.New()
+	r.Use(gin.Recovery())
+	a.healthRoutes(r)
+	r.GET("/metrics", gin.WrapH(metrics.Handler()))
+	return r
+}
+
+func (a *App) archiveService(ctx context.Context) (*service.ArchiveService, error) {
+	var store domain.ArchiveStore
+	var err error
+	switch a.cfg.Archive.Backend {
+	case "s3":
+		store, err = repository.NewS3ArchiveStore(ctx, a.cfg.Archive)
+	default:
+		store, err = repository.NewFSArchiveStore(a.cfg.Archive.Dir)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize archive store: %w", err)
+	}
+
+	indexAdmin, err := repository.NewESIndexAdmin(a.cfg.ESAddress)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to Elasticsearch: %w", err)
+	}
+
+	return service.NewArchiveService(a.backend.Logs, store, indexAdmin, repository.NewRedisLocker(a.rdb), a.cfg.Archive), nil
+}
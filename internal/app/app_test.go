@@ -0,0 +1,22 @@
+package app
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseRole(t *testing.T) {
+	for _, s := range []string{"api", "worker", "all"} {
+		role, err := ParseRole(s)
+		assert.NoError(t, err)
+		assert.Equal(t, Role(s), role)
+	}
+
+	_, err := ParseRole("consumer")
+	assert.Error(t, err)
+
+	assert.True(t, RoleAll.runsAPI() && RoleAll.runsWorker())
+	assert.False(t, RoleAPI.runsWorker())
+	assert.False(t, RoleWorker.runsAPI())
+}
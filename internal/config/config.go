@@ -1,34 +1,186 @@
 package config
 
 import (
-	"log"
+	"fmt"
+	"log/slog"
 	"os"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/joho/godotenv"
 )
 
 type RateLimitConfig struct {
-	Enabled  bool
-	Capacity int64   // Max burst requests
-	Rate     float64 // Tokens per second refill rate
+	Enabled   bool
+	Algorithm string  // token_bucket, gcra or sliding_window
+	Capacity  int64   // Max burst requests
+	Rate      float64 // Tokens per second refill rate
+
+	// APIKeys maps every valid X-API-Key to its tenant ("" for none). A
+	// request without a listed key is limited by its client IP.
+	APIKeys map[string]string
+	// Identity lists which identity of a listed key is used, in order:
+	// api_key (a bucket per key) or tenant (one per tenant, shared by its keys)
+	Identity  []string
+	Tiers     map[string]RateLimitTier // By tier name
+	Overrides map[string]string        // Identity ("api_key:abc", "tenant:acme", "ip:10.0.0.7") to tier name
+
+	// A request costs RouteCosts[method+" "+route] tokens (default 1), plus
+	// one per BytesPerToken bytes of body (0 = body size is free)
+	RouteCosts    map[string]int64
+	BytesPerToken int64
+
+	// FailurePolicy is what happens while Redis is unreachable: open (allow
+	// everything), closed (reject with 503) or local (per-process buckets,
+	// each limit divided by Replicas)
+	FailurePolicy string
+	Replicas      int // API replicas expected to share the traffic
+}
+
+// RateLimitTier is a named bucket size; clients without an override get
+// RateLimitConfig's own Capacity and Rate
+type RateLimitTier struct {
+	Capacity int64
+	Rate     float64
+}
+
+type PartitionConfig struct {
+	Enabled       bool
+	RetentionDays int // Daily partitions older than this are dropped (0 = keep forever)
+	PremakeDays   int // Future daily partitions created ahead of time
+}
+
+type ArchiveConfig struct {
+	Enabled      bool
+	Backend      string // fs or s3
+	Dir          string // Root directory for the fs backend
+	S3Endpoint   string
+	S3Bucket     string
+	S3AccessKey  string
+	S3SecretKey  string
+	S3Region     string
+	S3UseSSL     bool
+	AfterDays    int           // Archive days older than this (must be below DB_PARTITION_RETENTION_DAYS)
+	LookbackDays int           // How far back to look for days not archived yet
+	SegmentSize  int           // Max entries per segment file
+	RehydrateTTL time.Duration // Rehydrated indices are deleted after this
+}
+
+type DeadLetterConfig struct {
+	Enabled     bool
+	Topic       string // Kafka topic for poison and permanently failing messages
+	MaxAttempts int    // Failed flushes before a batch is checked for entries to dead-letter
+}
+
+type KafkaProducerConfig struct {
+	Mode             string        // sync (ack per log) or async (batched)
+	Compression      string        // none, gzip, snappy, lz4 or zstd
+	Linger           time.Duration // async: how long a batch waits to fill
+	BatchBytes       int           // async: a batch is sent once it reaches this size
+	MaxBufferedBytes int64         // async: SendLog blocks while this much is awaiting delivery
+}
+
+type SpoolConfig struct {
+	Enabled       bool
+	Dir           string        // Segment files and the drain cursor
+	SegmentBytes  int64         // A new segment is started past this size
+	MaxBytes      int64         // Spool size cap; SendLog fails with domain.ErrSpoolFull beyond it
+	Fsync         string        // always, interval or never
+	FsyncInterval time.Duration // For the interval policy
+}
+
+type QueueConfig struct {
+	Backend        string        // kafka, redis (Redis Streams) or channel (in-process, role all only)
+	RedisStream    string        // Stream key for the redis backend
+	RedisMaxLen    int64         // Approximate stream length cap; older entries are trimmed
+	RedisClaimIdle time.Duration // Pending entries idle this long are claimed from dead workers
+	ChannelSize    int           // Buffered logs for the channel backend
+}
+
+// ConsumerConfig is how the worker batches logs from one topic or stream
+type ConsumerConfig struct {
+	BatchSize     int           // A batch is flushed once it holds this many logs
+	FlushInterval time.Duration // ...or after this long
+}
+
+// LaneConfig routes matching logs to their own topic (or stream), consumed
+// with their own batch settings. A log matches if its level is one of
+// Levels and its service one of Services; an empty list matches anything.
+type LaneConfig struct {
+	Name     string
+	Topic    string   // Kafka topic or Redis stream; unused by the channel backend
+	Levels   []string // Compared case-insensitively
+	Services []string
+	Consumer ConsumerConfig
+}
+
+type AdminConfig struct {
+	Enabled bool
+	Addr    string // host:port; keep it off the public interface
+}
+
+type HealthConfig struct {
+	Critical []string      // Components that must be up for /readyz to pass
+	Timeout  time.Duration // Per component check
+}
+
+type LogConfig struct {
+	Level  string // debug, info, warn or error
+	Format string // json or text
+}
+
+type TracingConfig struct {
+	Exporter     string  // none, otlp or stdout
+	OTLPEndpoint string  // OTLP/HTTP endpoint URL (empty = OTEL_EXPORTER_OTLP_* env or localhost:4318)
+	SampleRatio  float64 // Share of new traces recorded; incoming sampled traces are always kept
+}
+
+type ResilienceConfig struct {
+	BreakerFailureThreshold int           // Consecutive failures that open a dependency's breaker
+	BreakerOpenTimeout      time.Duration // How long an open breaker fails fast before probing
+	RetryMaxAttempts        int           // Producer attempts per message, including the first
+	RetryInitialBackoff     time.Duration // First retry delay, doubled per attempt with jitter
+	RetryMaxBackoff         time.Duration
+	RetryBudgetRatio        float64 // Producer retries allowed per message, process-wide
 }
 
 type Config struct {
-	ServerPort   string
-	DBUrl        string
-	RedisAddr    string
-	KafkaBrokers []string
-	KafkaTopic   string
-	ESAddress    string
-	RateLimit    RateLimitConfig
+	ServerPort  string
+	MetricsPort string // /metrics and probes listener, for every role
+	// Proxies (IPs or CIDRs) whose X-Forwarded-For is believed for the
+	// client IP; none by default, so the client IP is the connection's peer
+	TrustedProxies []string
+	// Services reported by name in the HTTP metrics' service label; others
+	// are reported as "other", so clients can't grow the label without bound
+	MetricsServices []string
+	DBDriver        string // mysql, postgres or sqlite
+	DBUrl           string
+	RedisAddr       string
+	KafkaBrokers    []string
+	KafkaTopic      string
+	KafkaEncoding   string // Envelope content type for new messages: json or protobuf
+	KafkaProducer   KafkaProducerConfig
+	ESAddress       string
+	RateLimit       RateLimitConfig
+	Partition       PartitionConfig
+	Archive         ArchiveConfig
+	DeadLetter      DeadLetterConfig
+	Resilience      ResilienceConfig
+	Spool           SpoolConfig
+	Queue           QueueConfig
+	Consumer        ConsumerConfig // For the default topic
+	Lanes           []LaneConfig   // Checked in order; unmatched logs use the default topic
+	Tracing         TracingConfig
+	Log             LogConfig
+	Health          HealthConfig
+	Admin           AdminConfig // Debug listener: pprof, build info, config dump, log level
 }
 
 func LoadConfig() *Config {
 	err := godotenv.Load()
 	if err != nil {
-		log.Println("Warning: .env file not found, relying on system environment variables")
+		slog.Warn(".env file not found, relying on system environment variables")
 	}
 
 	// Helper to handle comma-separated brokers from env
@@ -44,7 +196,26 @@ func LoadConfig() *Config {
 	dbPort := os.Getenv("DB_PORT")
 	dbName := os.Getenv("DB_NAME")
 
-	dsn := dbUser + ":" + dbPass + "@tcp(" + dbHost + ":" + dbPort + ")/" + dbName + "?charset=utf8mb4&parseTime=True&loc=Local"
+	dbDriver := os.Getenv("DB_DRIVER")
+	if dbDriver == "" {
+		dbDriver = "mysql"
+	}
+
+	// DB_DSN overrides the DSN assembled from the individual DB_* variables
+	dsn := os.Getenv("DB_DSN")
+	if dsn == "" {
+		switch dbDriver {
+		case "postgres":
+			dsn = "host=" + dbHost + " port=" + dbPort + " user=" + dbUser + " password=" + dbPass + " dbname=" + dbName + " sslmode=disable"
+		case "sqlite":
+			dsn = os.Getenv("DB_PATH")
+			if dsn == "" {
+				dsn = "logpulse.db"
+			}
+		default:
+			dsn = dbUser + ":" + dbPass + "@tcp(" + dbHost + ":" + dbPort + ")/" + dbName + "?charset=utf8mb4&parseTime=True&loc=Local"
+		}
+	}
 
 	// Rate Limit Config
 	rateLimitEnabled := os.Getenv("RATE_LIMIT_ENABLED") == "true"
@@ -56,18 +227,413 @@ func LoadConfig() *Config {
 	if rateLimitRate == 0 {
 		rateLimitRate = 50 // Default: 50 tokens/sec
 	}
+	rateLimitAlgorithm := os.Getenv("RATE_LIMIT_ALGORITHM")
+	if rateLimitAlgorithm == "" {
+		rateLimitAlgorithm = "token_bucket"
+	}
+	// RATE_LIMIT_API_KEYS=key1=acme,key2=acme,key3 (tenant optional)
+	rateLimitAPIKeys := map[string]string{}
+	for _, item := range splitList(os.Getenv("RATE_LIMIT_API_KEYS")) {
+		key, tenant, _ := strings.Cut(item, "=")
+		rateLimitAPIKeys[strings.TrimSpace(key)] = strings.TrimSpace(tenant)
+	}
+	rateLimitIdentity := splitList(os.Getenv("RATE_LIMIT_IDENTITY"))
+	if len(rateLimitIdentity) == 0 {
+		rateLimitIdentity = []string{"tenant", "api_key"}
+	}
+	// RATE_LIMIT_TIERS=pro reads RATE_LIMIT_TIER_PRO_CAPACITY and RATE_LIMIT_TIER_PRO_RATE
+	rateLimitTiers := map[string]RateLimitTier{}
+	for _, name := range splitList(os.Getenv("RATE_LIMIT_TIERS")) {
+		prefix := "RATE_LIMIT_TIER_" + strings.ToUpper(name) + "_"
+		capacity, _ := strconv.ParseInt(os.Getenv(prefix+"CAPACITY"), 10, 64)
+		if capacity == 0 {
+			capacity = rateLimitCapacity
+		}
+		rate, _ := strconv.ParseFloat(os.Getenv(prefix+"RATE"), 64)
+		if rate == 0 {
+			rate = rateLimitRate
+		}
+		rateLimitTiers[name] = RateLimitTier{Capacity: capacity, Rate: rate}
+	}
+	// RATE_LIMIT_OVERRIDES=api_key:abc=pro,tenant:acme=pro
+	rateLimitOverrides := map[string]string{}
+	for _, item := range splitList(os.Getenv("RATE_LIMIT_OVERRIDES")) {
+		identity, tier, _ := strings.Cut(item, "=")
+		rateLimitOverrides[strings.TrimSpace(identity)] = strings.TrimSpace(tier)
+	}
+	// RATE_LIMIT_ROUTE_COSTS=GET /logs/search=5,GET /logs/:id=2
+	rateLimitRouteCosts := map[string]int64{}
+	for _, item := range splitList(os.Getenv("RATE_LIMIT_ROUTE_COSTS")) {
+		route, cost, _ := strings.Cut(item, "=")
+		n, err := strconv.ParseInt(strings.TrimSpace(cost), 10, 64)
+		if err != nil || n < 0 {
+			slog.Warn("Ignoring invalid RATE_LIMIT_ROUTE_COSTS entry", "entry", item)
+			continue
+		}
+		rateLimitRouteCosts[strings.Join(strings.Fields(route), " ")] = n
+	}
+	rateLimitBytesPerToken, _ := strconv.ParseInt(os.Getenv("RATE_LIMIT_BYTES_PER_TOKEN"), 10, 64)
+	rateLimitFailurePolicy := os.Getenv("RATE_LIMIT_FAILURE_POLICY")
+	if rateLimitFailurePolicy == "" {
+		rateLimitFailurePolicy = "local"
+	}
+	rateLimitReplicas, _ := strconv.Atoi(os.Getenv("RATE_LIMIT_REPLICAS"))
+	if rateLimitReplicas < 1 {
+		rateLimitReplicas = 1
+	}
+
+	// Partition Config (log_entries RANGE partitioning by day)
+	partitionEnabled := os.Getenv("DB_PARTITION_ENABLED") == "true"
+	retentionDays, _ := strconv.Atoi(os.Getenv("DB_PARTITION_RETENTION_DAYS")) // Default: keep forever
+	premakeDays, err := strconv.Atoi(os.Getenv("DB_PARTITION_PREMAKE_DAYS"))
+	if err != nil {
+		premakeDays = 7 // Default: one week ahead (0 = today only)
+	}
+
+	// Archive Config (cold storage of aged-out logs)
+	archiveBackend := os.Getenv("ARCHIVE_BACKEND")
+	if archiveBackend == "" {
+		archiveBackend = "fs"
+	}
+	archiveDir := os.Getenv("ARCHIVE_DIR")
+	if archiveDir == "" {
+		archiveDir = "./archive"
+	}
+	archiveAfterDays, _ := strconv.Atoi(os.Getenv("ARCHIVE_AFTER_DAYS"))
+	if archiveAfterDays == 0 {
+		archiveAfterDays = 1 // Default: archive yesterday and older
+	}
+	archiveLookbackDays, _ := strconv.Atoi(os.Getenv("ARCHIVE_LOOKBACK_DAYS"))
+	if archiveLookbackDays == 0 {
+		archiveLookbackDays = 30
+	}
+	archiveSegmentSize, _ := strconv.Atoi(os.Getenv("ARCHIVE_SEGMENT_SIZE"))
+	if archiveSegmentSize == 0 {
+		archiveSegmentSize = 50000
+	}
+	rehydrateTTL, err := time.ParseDuration(os.Getenv("ARCHIVE_REHYDRATE_TTL"))
+	if err != nil {
+		rehydrateTTL = 24 * time.Hour
+	}
+
+	kafkaEncoding := os.Getenv("KAFKA_ENCODING")
+	if kafkaEncoding == "" {
+		kafkaEncoding = "json"
+	}
+
+	// Kafka Producer Config
+	producerMode := os.Getenv("KAFKA_PRODUCER_MODE")
+	if producerMode == "" {
+		producerMode = "sync"
+	}
+	compression := os.Getenv("KAFKA_COMPRESSION")
+	if compression == "" {
+		compression = "none"
+	}
+	linger, err := time.ParseDuration(os.Getenv("KAFKA_LINGER"))
+	if err != nil {
+		linger = 5 * time.Millisecond
+	}
+	batchKB, _ := strconv.Atoi(os.Getenv("KAFKA_BATCH_KB"))
+	if batchKB == 0 {
+		batchKB = 512
+	}
+	maxBufferedMB, _ := strconv.ParseInt(os.Getenv("KAFKA_MAX_BUFFERED_MB"), 10, 64)
+	if maxBufferedMB == 0 {
+		maxBufferedMB = 64
+	}
+
+	// Dead-letter Config
+	kafkaTopic := os.Getenv("KAFKA_TOPIC")
+	dlqTopic := os.Getenv("DLQ_TOPIC")
+	if dlqTopic == "" {
+		dlqTopic = kafkaTopic + "-dlq"
+	}
+	dlqMaxAttempts, _ := strconv.Atoi(os.Getenv("DLQ_MAX_ATTEMPTS"))
+	if dlqMaxAttempts == 0 {
+		dlqMaxAttempts = 5
+	}
+
+	// Spool Config (local disk buffer while Kafka is unavailable)
+	spoolDir := os.Getenv("SPOOL_DIR")
+	if spoolDir == "" {
+		spoolDir = "./spool"
+	}
+	spoolSegmentMB, _ := strconv.ParseInt(os.Getenv("SPOOL_SEGMENT_MB"), 10, 64)
+	if spoolSegmentMB == 0 {
+		spoolSegmentMB = 16
+	}
+	spoolMaxMB, _ := strconv.ParseInt(os.Getenv("SPOOL_MAX_MB"), 10, 64)
+	if spoolMaxMB == 0 {
+		spoolMaxMB = 1024
+	}
+	spoolFsync := os.Getenv("SPOOL_FSYNC")
+	if spoolFsync == "" {
+		spoolFsync = "interval"
+	}
+	spoolFsyncInterval, err := time.ParseDuration(os.Getenv("SPOOL_FSYNC_INTERVAL"))
+	if err != nil {
+		spoolFsyncInterval = 1 * time.Second
+	}
+
+	// Queue Config (Kafka, Redis Streams or an in-process channel)
+	queueBackend := os.Getenv("QUEUE_BACKEND")
+	if queueBackend == "" {
+		queueBackend = "kafka"
+	}
+	redisStream := os.Getenv("QUEUE_REDIS_STREAM")
+	if redisStream == "" {
+		redisStream = "logs"
+	}
+	redisMaxLen, _ := strconv.ParseInt(os.Getenv("QUEUE_REDIS_MAXLEN"), 10, 64)
+	if redisMaxLen == 0 {
+		redisMaxLen = 1000000
+	}
+	redisClaimIdle, err := time.ParseDuration(os.Getenv("QUEUE_REDIS_CLAIM_IDLE"))
+	if err != nil {
+		redisClaimIdle = 1 * time.Minute
+	}
+	channelSize, _ := strconv.Atoi(os.Getenv("QUEUE_CHANNEL_SIZE"))
+	if channelSize == 0 {
+		channelSize = 10000
+	}
+
+	// Consumer Config (default topic)
+	consumerBatchSize, _ := strconv.Atoi(os.Getenv("CONSUMER_BATCH_SIZE"))
+	if consumerBatchSize == 0 {
+		consumerBatchSize = 100
+	}
+	consumerFlushInterval, err := time.ParseDuration(os.Getenv("CONSUMER_FLUSH_INTERVAL"))
+	if err != nil {
+		consumerFlushInterval = 1 * time.Second
+	}
+
+	// Priority Lanes (LANES=critical reads LANE_CRITICAL_LEVELS, LANE_CRITICAL_TOPIC, ...)
+	baseTopic := kafkaTopic
+	if queueBackend == "redis" {
+		baseTopic = redisStream
+	}
+	var lanes []LaneConfig
+	for _, name := range splitList(os.Getenv("LANES")) {
+		prefix := "LANE_" + strings.ToUpper(name) + "_"
+		topic := os.Getenv(prefix + "TOPIC")
+		if topic == "" {
+			topic = baseTopic + "-" + name
+		}
+		batchSize, _ := strconv.Atoi(os.Getenv(prefix + "BATCH_SIZE"))
+		if batchSize == 0 {
+			batchSize = 10 // Default: small batches, searchable sooner
+		}
+		flushInterval, err := time.ParseDuration(os.Getenv(prefix + "FLUSH_INTERVAL"))
+		if err != nil {
+			flushInterval = 200 * time.Millisecond
+		}
+		lanes = append(lanes, LaneConfig{
+			Name:     name,
+			Topic:    topic,
+			Levels:   splitList(os.Getenv(prefix + "LEVELS")),
+			Services: splitList(os.Getenv(prefix + "SERVICES")),
+			Consumer: ConsumerConfig{BatchSize: batchSize, FlushInterval: flushInterval},
+		})
+	}
+
+	// Resilience Config (retries and circuit breakers around Kafka, DB and ES)
+	breakerThreshold, _ := strconv.Atoi(os.Getenv("BREAKER_FAILURE_THRESHOLD"))
+	if breakerThreshold == 0 {
+		breakerThreshold = 5
+	}
+	breakerOpenTimeout, err := time.ParseDuration(os.Getenv("BREAKER_OPEN_TIMEOUT"))
+	if err != nil {
+		breakerOpenTimeout = 30 * time.Second
+	}
+	retryMaxAttempts, _ := strconv.Atoi(os.Getenv("RETRY_MAX_ATTEMPTS"))
+	if retryMaxAttempts == 0 {
+		retryMaxAttempts = 3
+	}
+	retryInitialBackoff, err := time.ParseDuration(os.Getenv("RETRY_INITIAL_BACKOFF"))
+	if err != nil {
+		retryInitialBackoff = 100 * time.Millisecond
+	}
+	retryMaxBackoff, err := time.ParseDuration(os.Getenv("RETRY_MAX_BACKOFF"))
+	if err != nil {
+		retryMaxBackoff = 30 * time.Second
+	}
+	retryBudgetRatio, err := strconv.ParseFloat(os.Getenv("RETRY_BUDGET_RATIO"), 64)
+	if err != nil {
+		retryBudgetRatio = 0.1 // Default: at most 10% extra load from retries
+	}
+
+	// Health Config (/readyz)
+	readyCritical := splitList(os.Getenv("READY_CRITICAL"))
+	if len(readyCritical) == 0 {
+		// Default: the DB and the queue; the API can ingest without ES or
+		// Redis (search falls back to the DB, the rate limiter fails open)
+		readyCritical = []string{"database"}
+		if queueBackend != "channel" {
+			readyCritical = append(readyCritical, queueBackend)
+		}
+	}
+	readyTimeout, err := time.ParseDuration(os.Getenv("READY_TIMEOUT"))
+	if err != nil || readyTimeout <= 0 {
+		readyTimeout = 2 * time.Second
+	}
+
+	// Admin Config (debug listener)
+	adminAddr := os.Getenv("ADMIN_ADDR")
+	if adminAddr == "" {
+		adminAddr = "127.0.0.1:6060" // Loopback only: reach it with port forwarding or exec
+	}
+
+	// Log Config (LogPulse's own logs)
+	logLevel := os.Getenv("LOG_LEVEL")
+	if logLevel == "" {
+		logLevel = "info"
+	}
+	logFormat := os.Getenv("LOG_FORMAT")
+	if logFormat == "" {
+		logFormat = "json"
+	}
+
+	// Tracing Config (OpenTelemetry)
+	tracingExporter := os.Getenv("TRACING_EXPORTER")
+	if tracingExporter == "" {
+		tracingExporter = "none"
+	}
+	sampleRatio, err := strconv.ParseFloat(os.Getenv("TRACING_SAMPLE_RATIO"), 64)
+	if err != nil {
+		sampleRatio = 1 // Default: record every trace
+	}
+
+	metricsPort := os.Getenv("METRICS_PORT")
+	if metricsPort == "" {
+		metricsPort = "9091"
+	}
 
 	return &Config{
-		ServerPort:   os.Getenv("SERVER_PORT"),
-		DBUrl:        dsn,
-		RedisAddr:    os.Getenv("REDIS_ADDR"),
-		KafkaBrokers: brokerList,
-		KafkaTopic:   os.Getenv("KAFKA_TOPIC"),
-		ESAddress:    os.Getenv("ELASTICSEARCH_ADDRESS"),
+		ServerPort:      os.Getenv("SERVER_PORT"),
+		TrustedProxies:  splitList(os.Getenv("TRUSTED_PROXIES")),
+		MetricsPort:     metricsPort,
+		MetricsServices: splitList(os.Getenv("METRICS_SERVICES")),
+		DBDriver:        dbDriver,
+		DBUrl:           dsn,
+		RedisAddr:       os.Getenv("REDIS_ADDR"),
+		KafkaBrokers:    brokerList,
+		KafkaTopic:      kafkaTopic,
+		KafkaEncoding:   kafkaEncoding,
+		KafkaProducer: KafkaProducerConfig{
+			Mode:             producerMode,
+			Compression:      compression,
+			Linger:           linger,
+			BatchBytes:       batchKB << 10,
+			MaxBufferedBytes: maxBufferedMB << 20,
+		},
+		ESAddress: os.Getenv("ELASTICSEARCH_ADDRESS"),
 		RateLimit: RateLimitConfig{
-			Enabled:  rateLimitEnabled,
-			Capacity: rateLimitCapacity,
-			Rate:     rateLimitRate,
+			Enabled:   rateLimitEnabled,
+			Algorithm: rateLimitAlgorithm,
+			Capacity:  rateLimitCapacity,
+			Rate:      rateLimitRate,
+			APIKeys:   rateLimitAPIKeys,
+			Identity:  rateLimitIdentity,
+			Tiers:     rateLimitTiers,
+			Overrides: rateLimitOverrides,
+
+			RouteCosts:    rateLimitRouteCosts,
+			BytesPerToken: rateLimitBytesPerToken,
+			FailurePolicy: rateLimitFailurePolicy,
+			Replicas:      rateLimitReplicas,
+		},
+		Partition: PartitionConfig{
+			Enabled:       partitionEnabled,
+			RetentionDays: retentionDays,
+			PremakeDays:   premakeDays,
 		},
+		Archive: ArchiveConfig{
+			Enabled:      os.Getenv("ARCHIVE_ENABLED") == "true",
+			Backend:      archiveBackend,
+			Dir:          archiveDir,
+			S3Endpoint:   os.Getenv("ARCHIVE_S3_ENDPOINT"),
+			S3Bucket:     os.Getenv("ARCHIVE_S3_BUCKET"),
+			S3AccessKey:  os.Getenv("ARCHIVE_S3_ACCESS_KEY"),
+			S3SecretKey:  os.Getenv("ARCHIVE_S3_SECRET_KEY"),
+			S3Region:     os.Getenv("ARCHIVE_S3_REGION"),
+			S3UseSSL:     os.Getenv("ARCHIVE_S3_USE_SSL") == "true",
+			AfterDays:    archiveAfterDays,
+			LookbackDays: archiveLookbackDays,
+			SegmentSize:  archiveSegmentSize,
+			RehydrateTTL: rehydrateTTL,
+		},
+		DeadLetter: DeadLetterConfig{
+			Enabled:     os.Getenv("DLQ_ENABLED") != "false",
+			Topic:       dlqTopic,
+			MaxAttempts: dlqMaxAttempts,
+		},
+		Resilience: ResilienceConfig{
+			BreakerFailureThreshold: breakerThreshold,
+			BreakerOpenTimeout:      breakerOpenTimeout,
+			RetryMaxAttempts:        retryMaxAttempts,
+			RetryInitialBackoff:     retryInitialBackoff,
+			RetryMaxBackoff:         retryMaxBackoff,
+			RetryBudgetRatio:        retryBudgetRatio,
+		},
+		Spool: SpoolConfig{
+			Enabled:       os.Getenv("SPOOL_ENABLED") == "true",
+			Dir:           spoolDir,
+			SegmentBytes:  spoolSegmentMB << 20,
+			MaxBytes:      spoolMaxMB << 20,
+			Fsync:         spoolFsync,
+			FsyncInterval: spoolFsyncInterval,
+		},
+		Queue: QueueConfig{
+			Backend:        queueBackend,
+			RedisStream:    redisStream,
+			RedisMaxLen:    redisMaxLen,
+			RedisClaimIdle: redisClaimIdle,
+			ChannelSize:    channelSize,
+		},
+		Consumer: ConsumerConfig{
+			BatchSize:     consumerBatchSize,
+			FlushInterval: consumerFlushInterval,
+		},
+		Lanes: lanes,
+		Tracing: TracingConfig{
+			Exporter:     tracingExporter,
+			OTLPEndpoint: os.Getenv("TRACING_OTLP_ENDPOINT"),
+			SampleRatio:  sampleRatio,
+		},
+		Log: LogConfig{
+			Level:  logLevel,
+			Format: logFormat,
+		},
+		Admin: AdminConfig{
+			Enabled: os.Getenv("ADMIN_ENABLED") == "true",
+			Addr:    adminAddr,
+		},
+		Health: HealthConfig{
+			Critical: readyCritical,
+			Timeout:  readyTimeout,
+		},
+	}
+}
+
+// Validate reports settings that load fine on their own but conflict
+func (c *Config) Validate() error {
+	// Days must be archived before their partition (or rows) are dropped
+	if c.Archive.Enabled && c.Partition.Enabled && c.Partition.RetentionDays > 0 &&
+		c.Archive.AfterDays >= c.Partition.RetentionDays {
+		return fmt.Errorf("ARCHIVE_AFTER_DAYS (%d) must be below DB_PARTITION_RETENTION_DAYS (%d)",
+			c.Archive.AfterDays, c.Partition.RetentionDays)
+	}
+	return nil
+}
+
+// splitList splits a comma-separated value, dropping blanks
+func splitList(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
 	}
+	return items
 }
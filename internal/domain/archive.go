@@ -0,0 +1,54 @@
+package domain
+
+import (
+	"context"
+	"errors"
+	"io"
+	"time"
+)
+
+// ErrArchiveObjectNotFound is returned by ArchiveStore.Get for missing keys
+var ErrArchiveObjectNotFound = errors.New("archive object not found")
+
+// ArchiveSegment describes one immutable gzip-compressed NDJSON file
+type ArchiveSegment struct {
+	Key     string    `json:"key"`
+	Count   int       `json:"count"`
+	FirstID uint      `json:"first_id"`
+	LastID  uint      `json:"last_id"`
+	MinTime time.Time `json:"min_time"`
+	MaxTime time.Time `json:"max_time"`
+	Bytes   int64     `json:"bytes"`
+	SHA256  string    `json:"sha256"`
+}
+
+// ArchiveManifest indexes the segments of one archived day.
+// It is written after all segments, so its presence marks the day as complete.
+type ArchiveManifest struct {
+	Day        string           `json:"day"` // YYYY-MM-DD
+	Count      int              `json:"count"`
+	Segments   []ArchiveSegment `json:"segments"`
+	ArchivedAt time.Time        `json:"archived_at"`
+}
+
+// RehydrateResult reports a time range loaded back into a temporary ES index
+type RehydrateResult struct {
+	Index string    `json:"index"`
+	From  time.Time `json:"from"`
+	To    time.Time `json:"to"`
+	Count int       `json:"count"`
+}
+
+// ArchiveStore (local filesystem or S3-compatible object storage)
+type ArchiveStore interface {
+	Put(ctx context.Context, key string, r io.Reader, size int64) error
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+}
+
+// Locker provides a cluster-wide mutex so only one replica runs a job at a time
+type Locker interface {
+	// TryLock returns ok=false if another holder owns key. The lock is kept
+	// until release is called; ttl only bounds how long it outlives a
+	// holder that dies without releasing it.
+	TryLock(ctx context.Context, key string, ttl time.Duration) (release func(), ok bool, err error)
+}
@@ -0,0 +1,45 @@
+package domain
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+var (
+	// ErrLogRejected marks errors where a store refused a specific entry
+	// (e.g. an ES mapping conflict). Retrying the same entry cannot succeed.
+	ErrLogRejected = errors.New("log entry rejected")
+	// ErrDeadLetterNotFound is returned when no dead letter exists at a position
+	ErrDeadLetterNotFound = errors.New("dead letter not found")
+)
+
+// DeadLetter is a consumed message that could not be stored, together with
+// where it came from and why it failed
+type DeadLetter struct {
+	// Position in the dead-letter topic (set when read back)
+	Partition int32 `json:"partition"`
+	Offset    int64 `json:"offset"`
+
+	SourceTopic     string    `json:"source_topic"`
+	SourcePartition int32     `json:"source_partition"`
+	SourceOffset    int64     `json:"source_offset"`
+	Error           string    `json:"error"`
+	Attempts        int       `json:"attempts"`
+	FailedAt        time.Time `json:"failed_at"`
+	ContentType     string    `json:"content_type,omitempty"` // Of Value, empty for legacy messages
+	RequestID       string    `json:"request_id,omitempty"`   // Of the API request that sent the log
+	Key             []byte    `json:"-"`
+	Value           []byte    `json:"-"`
+}
+
+// DeadLetterQueue stores dead letters and sends them back for another try
+type DeadLetterQueue interface {
+	Publish(ctx context.Context, letter *DeadLetter) error
+	// List returns up to limit of the most recent dead letters per partition
+	List(ctx context.Context, limit int) ([]*DeadLetter, error)
+	Get(ctx context.Context, partition int32, offset int64) (*DeadLetter, error)
+	// Replay re-publishes the original message to its source topic
+	Replay(ctx context.Context, partition int32, offset int64) error
+	Close() error
+}
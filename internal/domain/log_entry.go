@@ -2,6 +2,7 @@ package domain
 
 import (
 	"context"
+	"errors"
 	"time"
 
 	"gorm.io/gorm"
@@ -16,10 +17,39 @@ type LogEntry struct {
 	Timestamp   time.Time `json:"timestamp"`
 }
 
+// LogSearchQuery is a keyword search with optional filters.
+// Zero values mean "no filter".
+type LogSearchQuery struct {
+	Query       string
+	ServiceName string
+	Level       string
+	From        time.Time
+	To          time.Time
+	Limit       int
+}
+
+// LogSearchResult carries the hits and whether they came from the degraded
+// relational fallback instead of Elasticsearch
+type LogSearchResult struct {
+	Logs     []*LogEntry
+	Degraded bool
+}
+
 // LogRepository (MySQL)
 type LogRepository interface {
 	Create(ctx context.Context, entry *LogEntry) error
-	GetByID(ctx context.Context, id uint) (*LogEntry, error)
+	// GetByID looks up an entry by ID. A non-zero day (local midnight)
+	// limits the lookup to entries timestamped that day, which lets
+	// partitioned backends read a single partition.
+	GetByID(ctx context.Context, id uint, day time.Time) (*LogEntry, error)
+	// FindByTimeRange pages through entries with from <= timestamp < to,
+	// ordered by ID and starting after afterID (keyset pagination).
+	FindByTimeRange(ctx context.Context, from, to time.Time, afterID uint, limit int) ([]*LogEntry, error)
+	// FindByIDRange pages through entries with afterID < id <= untilID, ordered by ID
+	FindByIDRange(ctx context.Context, afterID, untilID uint, limit int) ([]*LogEntry, error)
+	MaxID(ctx context.Context) (uint, error)
+	// Search is the degraded search path used while Elasticsearch is unavailable
+	Search(ctx context.Context, query LogSearchQuery) ([]*LogEntry, error)
 }
 
 // LogCacheRepository (Redis)
@@ -31,14 +61,45 @@ type LogCacheRepository interface {
 	GetLog(ctx context.Context, id uint) (*LogEntry, error)
 }
 
+// ErrSpoolFull is returned by a spooling producer whose disk buffer is at its size cap
+var ErrSpoolFull = errors.New("log spool is full")
+
 // LogProducer
 type LogProducer interface {
 	SendLog(ctx context.Context, entry *LogEntry) error
 	Close() error
 }
 
+type deliveryAckKey struct{}
+
+// WithDeliveryAck asks the producer to return only once the broker has
+// acknowledged the log, even when it otherwise sends asynchronously
+func WithDeliveryAck(ctx context.Context) context.Context {
+	return context.WithValue(ctx, deliveryAckKey{}, true)
+}
+
+func DeliveryAckRequested(ctx context.Context) bool {
+	ack, _ := ctx.Value(deliveryAckKey{}).(bool)
+	return ack
+}
+
 // LogSearchRepository elasticsearch
 type LogSearchRepository interface {
 	BulkIndex(ctx context.Context, entries []*LogEntry) error
-	Search(ctx context.Context, query string) ([]*LogEntry, error)
+	Search(ctx context.Context, query LogSearchQuery) ([]*LogEntry, error)
+	// Ping checks that the cluster answers, for the readiness probe
+	Ping(ctx context.Context) error
+}
+
+// LogIndexAdmin manages Elasticsearch indices other than the live "logs" index
+type LogIndexAdmin interface {
+	// CreateIndex creates index with optional settings/mappings JSON (nil for defaults)
+	CreateIndex(ctx context.Context, index string, body []byte) error
+	DeleteIndex(ctx context.Context, index string) error
+	ListIndices(ctx context.Context, pattern string) ([]string, error)
+	BulkIndexInto(ctx context.Context, index string, entries []*LogEntry) error
+	SearchIndex(ctx context.Context, index string, query LogSearchQuery) ([]*LogEntry, error)
+	// SwitchAlias atomically points alias at index only. If alias is still a
+	// concrete index it is deleted in the same request when replaceIndex is set.
+	SwitchAlias(ctx context.Context, alias, index string, replaceIndex bool) error
 }
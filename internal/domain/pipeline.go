@@ -0,0 +1,56 @@
+package domain
+
+import (
+	"context"
+	"time"
+)
+
+// PartitionLag is how far a consumer group is behind on one partition
+type PartitionLag struct {
+	Group     string `json:"group"`
+	Topic     string `json:"topic"`
+	Partition int32  `json:"partition"`
+	Committed int64  `json:"committed"` // -1 when the group has not committed yet
+	HighWater int64  `json:"high_water"`
+	Lag       int64  `json:"lag"`
+}
+
+// ConsumerStats is one worker replica's view of its own progress
+type ConsumerStats struct {
+	Replica      string    `json:"replica"`
+	BatchFill    int       `json:"batch_fill"` // Entries buffered but not flushed yet, over all claims
+	BatchSize    int       `json:"batch_size"` // Flush threshold per claim
+	Claims       int       `json:"claims"`     // Partitions currently consumed
+	LastFlushAt  time.Time `json:"last_flush_at"`
+	FlushedTotal int64     `json:"flushed_total"`
+	DBErrors     int64     `json:"db_errors"`
+	ESErrors     int64     `json:"es_errors"`
+	DeadLettered int64     `json:"dead_lettered"`
+	UpdatedAt    time.Time `json:"updated_at"`
+}
+
+// PipelineStatus combines broker-side lag with the stats of live replicas
+type PipelineStatus struct {
+	Groups       []string         `json:"groups"` // One consumer group per lane
+	Partitions   []PartitionLag   `json:"partitions"`
+	TotalLag     int64            `json:"total_lag"`
+	Replicas     []*ConsumerStats `json:"replicas"`
+	BatchFill    int              `json:"batch_fill"`
+	LastFlushAt  time.Time        `json:"last_flush_at"`
+	DBErrors     int64            `json:"db_errors"`
+	ESErrors     int64            `json:"es_errors"`
+	DeadLettered int64            `json:"dead_lettered"`
+}
+
+// OffsetInspector reads committed offsets and high-water marks from the broker
+type OffsetInspector interface {
+	PartitionLags(ctx context.Context) ([]PartitionLag, error)
+	Close() error
+}
+
+// ConsumerStatsStore shares ConsumerStats between replicas. Entries expire
+// after ttl, so stopped replicas drop out on their own.
+type ConsumerStatsStore interface {
+	Publish(ctx context.Context, stats ConsumerStats, ttl time.Duration) error
+	List(ctx context.Context) ([]*ConsumerStats, error)
+}
@@ -0,0 +1,11 @@
+package domain
+
+import "context"
+
+// LogConsumer moves logs from the queue into the DB and ES. Each queue
+// backend (Kafka, Redis Streams, in-process channel) has its own.
+type LogConsumer interface {
+	// Run consumes until ctx is done, then flushes what it has buffered
+	Run(ctx context.Context)
+	Stats() ConsumerStats
+}
@@ -0,0 +1,124 @@
+// Package envelope defines the versioned Kafka payload for log entries.
+// Each message carries a schema version, its content type, when and where
+// it was ingested, and the log itself, independent of the GORM model, so
+// storage changes don't break messages already in flight.
+package envelope
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/Yupoer/logpulse/internal/domain"
+)
+
+// SchemaVersion is the envelope version written by this build. Version 0
+// is the legacy payload: a bare JSON-encoded domain.LogEntry.
+const SchemaVersion = 1
+
+// Content types, carried in the HeaderContentType Kafka header
+const (
+	ContentTypeJSON     = "application/json"
+	ContentTypeProtobuf = "application/x-protobuf"
+)
+
+// Kafka headers set on every enveloped message
+const (
+	HeaderContentType   = "content-type"
+	HeaderSchemaVersion = "x-schema-version"
+	HeaderRequestID     = "x-request-id" // Of the API request that sent the log, when there was one
+)
+
+var (
+	ErrUnsupportedVersion     = errors.New("unsupported envelope schema version")
+	ErrUnsupportedContentType = errors.New("unsupported envelope content type")
+)
+
+// Envelope is a decoded Kafka message
+type Envelope struct {
+	SchemaVersion int
+	ContentType   string
+	IngestedAt    time.Time // Zero for legacy messages
+	Source        string    // Process that accepted the log, empty for legacy messages
+	Entry         *domain.LogEntry
+}
+
+// Encoder writes envelopes in one content type
+type Encoder struct {
+	ContentType string
+	Source      string
+}
+
+// NewEncoder returns an encoder for encoding "json" or "protobuf"
+func NewEncoder(encoding, source string) (Encoder, error) {
+	switch encoding {
+	case "", "json":
+		return Encoder{ContentType: ContentTypeJSON, Source: source}, nil
+	case "protobuf":
+		return Encoder{ContentType: ContentTypeProtobuf, Source: source}, nil
+	}
+	return Encoder{}, fmt.Errorf("unknown encoding %q (want json or protobuf)", encoding)
+}
+
+// Encode wraps entry in a current-version envelope. Only the log fields are
+// encoded; the DB assigns ID and bookkeeping timestamps on insert.
+func (e Encoder) Encode(entry *domain.LogEntry, ingestedAt time.Time) ([]byte, error) {
+	env := &Envelope{
+		SchemaVersion: SchemaVersion,
+		ContentType:   e.ContentType,
+		IngestedAt:    ingestedAt,
+		Source:        e.Source,
+		Entry:         entry,
+	}
+	switch e.ContentType {
+	case ContentTypeJSON:
+		return marshalJSON(env)
+	case ContentTypeProtobuf:
+		return marshalProtobuf(env), nil
+	}
+	return nil, fmt.Errorf("%w: %q", ErrUnsupportedContentType, e.ContentType)
+}
+
+// Decode reads a message of any supported version. contentType comes from
+// the message's HeaderContentType header; when it is missing (messages
+// written before the header existed) the format is detected from the data.
+func Decode(contentType string, data []byte) (*Envelope, error) {
+	if contentType == "" {
+		contentType = sniffContentType(data)
+	}
+
+	var env *Envelope
+	var err error
+	switch contentType {
+	case ContentTypeJSON:
+		env, err = unmarshalJSON(data)
+	case ContentTypeProtobuf:
+		env, err = unmarshalProtobuf(data)
+	default:
+		return nil, fmt.Errorf("%w: %q", ErrUnsupportedContentType, contentType)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if env.SchemaVersion > SchemaVersion {
+		return nil, fmt.Errorf("%w: %d (newest known is %d)", ErrUnsupportedVersion, env.SchemaVersion, SchemaVersion)
+	}
+	if env.Entry == nil {
+		return nil, errors.New("envelope has no log entry")
+	}
+	env.ContentType = contentType
+	return env, nil
+}
+
+// sniffContentType tells JSON from Protobuf: a JSON object starts with '{',
+// which as a Protobuf tag would be a (deprecated) group start for field 15,
+// never written by this schema.
+func sniffContentType(data []byte) string {
+	trimmed := bytes.TrimLeft(data, " \t\r\n")
+	if len(trimmed) > 0 && trimmed[0] == '{' {
+		return ContentTypeJSON
+	}
+	return ContentTypeProtobuf
+}
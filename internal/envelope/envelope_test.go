@@ -0,0 +1,111 @@
+package envelope
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/Yupoer/logpulse/internal/domain"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/encoding/protowire"
+	"gorm.io/gorm"
+)
+
+func testEntry() *domain.LogEntry {
+	return &domain.LogEntry{
+		ServiceName: "payment-service",
+		Level:       "ERROR",
+		Message:     "timeout calling bank",
+		Timestamp:   time.Date(2024, 3, 1, 12, 0, 0, 123, time.UTC),
+	}
+}
+
+func TestEncodeDecode_RoundTrip(t *testing.T) {
+	ingestedAt := time.Date(2024, 3, 1, 12, 0, 1, 0, time.UTC)
+
+	for _, encoding := range []string{"json", "protobuf"} {
+		t.Run(encoding, func(t *testing.T) {
+			encoder, err := NewEncoder(encoding, "api-1")
+			require.NoError(t, err)
+			data, err := encoder.Encode(testEntry(), ingestedAt)
+			require.NoError(t, err)
+
+			env, err := Decode(encoder.ContentType, data)
+			require.NoError(t, err)
+			assert.Equal(t, SchemaVersion, env.SchemaVersion)
+			assert.Equal(t, encoder.ContentType, env.ContentType)
+			assert.True(t, ingestedAt.Equal(env.IngestedAt))
+			assert.Equal(t, "api-1", env.Source)
+			assert.Equal(t, "payment-service", env.Entry.ServiceName)
+			assert.Equal(t, "ERROR", env.Entry.Level)
+			assert.Equal(t, "timeout calling bank", env.Entry.Message)
+			assert.True(t, testEntry().Timestamp.Equal(env.Entry.Timestamp))
+
+			// Without the content-type header the format is detected
+			sniffed, err := Decode("", data)
+			require.NoError(t, err)
+			assert.Equal(t, encoder.ContentType, sniffed.ContentType)
+		})
+	}
+}
+
+func TestDecode_LegacyJSON(t *testing.T) {
+	legacy := testEntry()
+	legacy.Model = gorm.Model{ID: 7}
+	data, err := json.Marshal(legacy)
+	require.NoError(t, err)
+
+	env, err := Decode("", data)
+	require.NoError(t, err)
+	assert.Equal(t, 0, env.SchemaVersion)
+	assert.Equal(t, ContentTypeJSON, env.ContentType)
+	assert.True(t, env.IngestedAt.IsZero())
+	assert.Equal(t, "timeout calling bank", env.Entry.Message)
+	assert.Zero(t, env.Entry.ID)
+}
+
+func TestDecode_RejectsNewerVersion(t *testing.T) {
+	data := []byte(`{"schema_version": 2, "log": {"message": "from the future"}}`)
+	_, err := Decode(ContentTypeJSON, data)
+	assert.ErrorIs(t, err, ErrUnsupportedVersion)
+
+	proto := protowire.AppendTag(nil, fieldEnvelopeSchemaVersion, protowire.VarintType)
+	proto = protowire.AppendVarint(proto, 2)
+	_, err = Decode(ContentTypeProtobuf, proto)
+	assert.ErrorIs(t, err, ErrUnsupportedVersion)
+}
+
+func TestDecode_ProtobufSkipsUnknownFields(t *testing.T) {
+	data, err := Encoder{ContentType: ContentTypeProtobuf}.Encode(testEntry(), time.Now())
+	require.NoError(t, err)
+	// A field added by a newer writer
+	data = protowire.AppendTag(data, 99, protowire.BytesType)
+	data = protowire.AppendString(data, "ignored")
+
+	env, err := Decode(ContentTypeProtobuf, data)
+	require.NoError(t, err)
+	assert.Equal(t, "timeout calling bank", env.Entry.Message)
+}
+
+func TestDecode_Invalid(t *testing.T) {
+	_, err := Decode("", []byte("not json"))
+	assert.Error(t, err)
+
+	_, err = Decode(ContentTypeJSON, []byte(`{"schema_version": 1}`))
+	assert.Error(t, err, "envelope without a log")
+
+	_, err = Decode("text/plain", []byte("{}"))
+	assert.ErrorIs(t, err, ErrUnsupportedContentType)
+
+	_, err = NewEncoder("avro", "")
+	assert.Error(t, err)
+}
+
+func TestEncode_ProtobufIsSmaller(t *testing.T) {
+	jsonData, err := Encoder{ContentType: ContentTypeJSON, Source: "api-1"}.Encode(testEntry(), time.Now())
+	require.NoError(t, err)
+	protoData, err := Encoder{ContentType: ContentTypeProtobuf, Source: "api-1"}.Encode(testEntry(), time.Now())
+	require.NoError(t, err)
+	assert.Less(t, len(protoData), len(jsonData))
+}
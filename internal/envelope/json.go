@@ -0,0 +1,70 @@
+package envelope
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/Yupoer/logpulse/internal/domain"
+	"gorm.io/gorm"
+)
+
+// jsonEnvelope is the JSON wire format of schema version 1
+type jsonEnvelope struct {
+	SchemaVersion int       `json:"schema_version"`
+	IngestedAt    time.Time `json:"ingested_at"`
+	Source        string    `json:"source,omitempty"`
+	Log           *jsonLog  `json:"log"`
+}
+
+type jsonLog struct {
+	ServiceName string    `json:"service_name"`
+	Level       string    `json:"level"`
+	Message     string    `json:"message"`
+	Timestamp   time.Time `json:"timestamp"`
+}
+
+func marshalJSON(env *Envelope) ([]byte, error) {
+	return json.Marshal(jsonEnvelope{
+		SchemaVersion: env.SchemaVersion,
+		IngestedAt:    env.IngestedAt,
+		Source:        env.Source,
+		Log: &jsonLog{
+			ServiceName: env.Entry.ServiceName,
+			Level:       env.Entry.Level,
+			Message:     env.Entry.Message,
+			Timestamp:   env.Entry.Timestamp,
+		},
+	})
+}
+
+func unmarshalJSON(data []byte) (*Envelope, error) {
+	var wire jsonEnvelope
+	if err := json.Unmarshal(data, &wire); err != nil {
+		return nil, err
+	}
+
+	// No schema_version: a legacy bare LogEntry
+	if wire.SchemaVersion == 0 {
+		var entry domain.LogEntry
+		if err := json.Unmarshal(data, &entry); err != nil {
+			return nil, err
+		}
+		entry.Model = gorm.Model{} // Never meaningful before the insert
+		return &Envelope{Entry: &entry}, nil
+	}
+
+	env := &Envelope{
+		SchemaVersion: wire.SchemaVersion,
+		IngestedAt:    wire.IngestedAt,
+		Source:        wire.Source,
+	}
+	if wire.Log != nil {
+		env.Entry = &domain.LogEntry{
+			ServiceName: wire.Log.ServiceName,
+			Level:       wire.Log.Level,
+			Message:     wire.Log.Message,
+			Timestamp:   wire.Log.Timestamp,
+		}
+	}
+	return env, nil
+}
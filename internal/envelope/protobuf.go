@@ -0,0 +1,155 @@
+package envelope
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/Yupoer/logpulse/internal/domain"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// Field numbers from log_envelope.proto
+const (
+	fieldEnvelopeSchemaVersion = 1
+	fieldEnvelopeIngestedAt    = 2
+	fieldEnvelopeSource        = 3
+	fieldEnvelopeLog           = 4
+
+	fieldLogServiceName = 1
+	fieldLogLevel       = 2
+	fieldLogMessage     = 3
+	fieldLogTimestamp   = 4
+)
+
+func marshalProtobuf(env *Envelope) []byte {
+	var record []byte
+	record = appendString(record, fieldLogServiceName, env.Entry.ServiceName)
+	record = appendString(record, fieldLogLevel, env.Entry.Level)
+	record = appendString(record, fieldLogMessage, env.Entry.Message)
+	record = appendTime(record, fieldLogTimestamp, env.Entry.Timestamp)
+
+	var b []byte
+	b = protowire.AppendTag(b, fieldEnvelopeSchemaVersion, protowire.VarintType)
+	b = protowire.AppendVarint(b, uint64(env.SchemaVersion))
+	b = appendTime(b, fieldEnvelopeIngestedAt, env.IngestedAt)
+	b = appendString(b, fieldEnvelopeSource, env.Source)
+	b = protowire.AppendTag(b, fieldEnvelopeLog, protowire.BytesType)
+	b = protowire.AppendBytes(b, record)
+	return b
+}
+
+func unmarshalProtobuf(data []byte) (*Envelope, error) {
+	env := &Envelope{}
+	err := consumeFields(data, func(num protowire.Number, typ protowire.Type, b []byte) (int, error) {
+		switch {
+		case num == fieldEnvelopeSchemaVersion && typ == protowire.VarintType:
+			v, n := protowire.ConsumeVarint(b)
+			env.SchemaVersion = int(v)
+			return n, nil
+		case num == fieldEnvelopeIngestedAt && typ == protowire.VarintType:
+			v, n := protowire.ConsumeVarint(b)
+			env.IngestedAt = fromUnixNano(int64(v))
+			return n, nil
+		case num == fieldEnvelopeSource && typ == protowire.BytesType:
+			v, n := protowire.ConsumeString(b)
+			env.Source = v
+			return n, nil
+		case num == fieldEnvelopeLog && typ == protowire.BytesType:
+			v, n := protowire.ConsumeBytes(b)
+			if n < 0 {
+				return n, nil
+			}
+			entry, err := unmarshalProtobufLog(v)
+			if err != nil {
+				return 0, fmt.Errorf("log: %w", err)
+			}
+			env.Entry = entry
+			return n, nil
+		}
+		return protowire.ConsumeFieldValue(num, typ, b), nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if env.SchemaVersion == 0 {
+		return nil, errors.New("protobuf envelope has no schema version")
+	}
+	return env, nil
+}
+
+func unmarshalProtobufLog(data []byte) (*domain.LogEntry, error) {
+	entry := &domain.LogEntry{}
+	err := consumeFields(data, func(num protowire.Number, typ protowire.Type, b []byte) (int, error) {
+		if typ == protowire.BytesType {
+			var field *string
+			switch num {
+			case fieldLogServiceName:
+				field = &entry.ServiceName
+			case fieldLogLevel:
+				field = &entry.Level
+			case fieldLogMessage:
+				field = &entry.Message
+			}
+			if field != nil {
+				v, n := protowire.ConsumeString(b)
+				*field = v
+				return n, nil
+			}
+		}
+		if num == fieldLogTimestamp && typ == protowire.VarintType {
+			v, n := protowire.ConsumeVarint(b)
+			entry.Timestamp = fromUnixNano(int64(v))
+			return n, nil
+		}
+		return protowire.ConsumeFieldValue(num, typ, b), nil
+	})
+	return entry, err
+}
+
+// consumeFields walks the fields of a message. field returns how many bytes
+// of the value it consumed (negative on malformed input, as protowire does).
+// Unknown fields are skipped, so newer writers may add fields.
+func consumeFields(data []byte, field func(num protowire.Number, typ protowire.Type, b []byte) (int, error)) error {
+	for len(data) > 0 {
+		num, typ, n := protowire.ConsumeTag(data)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		data = data[n:]
+
+		n, err := field(num, typ, data)
+		if err != nil {
+			return err
+		}
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		data = data[n:]
+	}
+	return nil
+}
+
+func appendString(b []byte, num protowire.Number, v string) []byte {
+	if v == "" {
+		return b // proto3 omits default values
+	}
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendString(b, v)
+}
+
+// Times are int64 nanoseconds since the Unix epoch, 0 for the zero time
+func appendTime(b []byte, num protowire.Number, t time.Time) []byte {
+	if t.IsZero() {
+		return b
+	}
+	b = protowire.AppendTag(b, num, protowire.VarintType)
+	return protowire.AppendVarint(b, uint64(t.UnixNano()))
+}
+
+func fromUnixNano(ns int64) time.Time {
+	if ns == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, ns)
+}
@@ -0,0 +1,127 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/Yupoer/logpulse/internal/domain"
+	"github.com/Yupoer/logpulse/internal/service"
+	"github.com/gin-gonic/gin"
+)
+
+type ArchiveHandler struct {
+	service *service.ArchiveService
+}
+
+func NewArchiveHandler(service *service.ArchiveService) *ArchiveHandler {
+	return &ArchiveHandler{service: service}
+}
+
+type rehydrateRequest struct {
+	From time.Time `json:"from" binding:"required"`
+	To   time.Time `json:"to" binding:"required"`
+}
+
+// ArchiveDay handles POST /admin/archive/days/:day (day = YYYY-MM-DD)
+func (h *ArchiveHandler) ArchiveDay(c *gin.Context) {
+	day, err := time.ParseInLocation("2006-01-02", c.Param("day"), time.Local)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid day format, expected YYYY-MM-DD"})
+		return
+	}
+
+	manifest, err := h.service.ArchiveDayExclusive(c.Request.Context(), day)
+	if errors.Is(err, service.ErrArchiveBusy) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Another archive run is in progress, retry later"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Archiving failed"})
+		return
+	}
+
+	c.JSON(http.StatusOK, manifest)
+}
+
+// GetManifest handles GET /admin/archive/days/:day
+func (h *ArchiveHandler) GetManifest(c *gin.Context) {
+	day, err := time.ParseInLocation("2006-01-02", c.Param("day"), time.Local)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid day format, expected YYYY-MM-DD"})
+		return
+	}
+
+	manifest, err := h.service.GetManifest(c.Request.Context(), day)
+	if errors.Is(err, domain.ErrArchiveObjectNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Day not archived"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read manifest"})
+		return
+	}
+
+	c.JSON(http.StatusOK, manifest)
+}
+
+// Rehydrate handles POST /admin/archive/rehydrate
+// Body: {"from": "2024-03-01T00:00:00Z", "to": "2024-03-02T00:00:00Z"}
+func (h *ArchiveHandler) Rehydrate(c *gin.Context) {
+	var req rehydrateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid JSON format"})
+		return
+	}
+
+	result, err := h.service.Rehydrate(c.Request.Context(), req.From, req.To)
+	if errors.Is(err, service.ErrInvalidRehydrateRange) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "'from' must be before 'to' and the range at most 31 days"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Rehydration failed"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, result)
+}
+
+// SearchRehydrated handles GET /admin/archive/rehydrated/:index/search?q=keyword
+func (h *ArchiveHandler) SearchRehydrated(c *gin.Context) {
+	query := c.Query("q")
+	if query == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Query parameter 'q' is required"})
+		return
+	}
+
+	logs, err := h.service.SearchRehydrated(c.Request.Context(), c.Param("index"), domain.LogSearchQuery{Query: query})
+	if errors.Is(err, service.ErrNotRehydratedIndex) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Not a rehydrated index"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Search failed"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"count": len(logs),
+		"data":  logs,
+	})
+}
+
+// DropRehydrated handles DELETE /admin/archive/rehydrated/:index
+func (h *ArchiveHandler) DropRehydrated(c *gin.Context) {
+	err := h.service.DropRehydrated(c.Request.Context(), c.Param("index"))
+	if errors.Is(err, service.ErrNotRehydratedIndex) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Not a rehydrated index"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete index"})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
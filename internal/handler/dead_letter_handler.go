@@ -0,0 +1,112 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/Yupoer/logpulse/internal/domain"
+	"github.com/Yupoer/logpulse/internal/service"
+	"github.com/gin-gonic/gin"
+)
+
+type DeadLetterHandler struct {
+	service *service.DeadLetterService
+}
+
+func NewDeadLetterHandler(service *service.DeadLetterService) *DeadLetterHandler {
+	return &DeadLetterHandler{service: service}
+}
+
+// deadLetterResponse shows key and value as text instead of base64
+type deadLetterResponse struct {
+	*domain.DeadLetter
+	Key   string `json:"key"`
+	Value string `json:"value"`
+}
+
+func toDeadLetterResponse(letter *domain.DeadLetter) deadLetterResponse {
+	return deadLetterResponse{DeadLetter: letter, Key: string(letter.Key), Value: string(letter.Value)}
+}
+
+// List handles GET /admin/dlq?limit=50
+func (h *DeadLetterHandler) List(c *gin.Context) {
+	limit := 0
+	if v := c.Query("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid limit"})
+			return
+		}
+		limit = n
+	}
+
+	letters, err := h.service.List(c.Request.Context(), limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read dead-letter topic"})
+		return
+	}
+
+	data := make([]deadLetterResponse, 0, len(letters))
+	for _, letter := range letters {
+		data = append(data, toDeadLetterResponse(letter))
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"count": len(data),
+		"data":  data,
+	})
+}
+
+// Get handles GET /admin/dlq/:partition/:offset
+func (h *DeadLetterHandler) Get(c *gin.Context) {
+	partition, offset, ok := parseDeadLetterPosition(c)
+	if !ok {
+		return
+	}
+
+	letter, err := h.service.Get(c.Request.Context(), partition, offset)
+	if errors.Is(err, domain.ErrDeadLetterNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Dead letter not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read dead-letter topic"})
+		return
+	}
+
+	c.JSON(http.StatusOK, toDeadLetterResponse(letter))
+}
+
+// Replay handles POST /admin/dlq/:partition/:offset/replay
+func (h *DeadLetterHandler) Replay(c *gin.Context) {
+	partition, offset, ok := parseDeadLetterPosition(c)
+	if !ok {
+		return
+	}
+
+	err := h.service.Replay(c.Request.Context(), partition, offset)
+	if errors.Is(err, domain.ErrDeadLetterNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Dead letter not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Replay failed"})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{"message": "Replayed to source topic"})
+}
+
+func parseDeadLetterPosition(c *gin.Context) (int32, int64, bool) {
+	partition, err := strconv.ParseInt(c.Param("partition"), 10, 32)
+	if err != nil || partition < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid partition"})
+		return 0, 0, false
+	}
+	offset, err := strconv.ParseInt(c.Param("offset"), 10, 64)
+	if err != nil || offset < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid offset"})
+		return 0, 0, false
+	}
+	return int32(partition), offset, true
+}
@@ -0,0 +1,52 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/Yupoer/logpulse/internal/health"
+	"github.com/gin-gonic/gin"
+)
+
+type HealthHandler struct {
+	checker *health.Checker
+}
+
+func NewHealthHandler(checker *health.Checker) *HealthHandler {
+	return &HealthHandler{checker: checker}
+}
+
+// Healthz handles GET /healthz: the process is up and serving HTTP
+func (h *HealthHandler) Healthz(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"status": "alive"})
+}
+
+// RequireReady answers every request with 503 while the last readiness
+// check failed. nginx counts the 503s against the replica and retries GETs
+// on another one, so an unready replica drops out of rotation. It only
+// reads the last report; the checker has to be watched for it to change.
+func (h *HealthHandler) RequireReady() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if h.checker.Ready() {
+			c.Next()
+			return
+		}
+		c.Header("Retry-After", "1")
+		c.AbortWithStatusJSON(http.StatusServiceUnavailable, gin.H{"error": "Service not ready, retry later"})
+	}
+}
+
+// Watch keeps the readiness RequireReady reads current until ctx is done
+func (h *HealthHandler) Watch(ctx context.Context) { h.checker.Watch(ctx) }
+
+// Readyz handles GET /readyz: 200 while every critical dependency is up
+// (status ready or degraded), 503 otherwise, with a status per component.
+// Errors are only logged, since /readyz is reachable through nginx.
+func (h *HealthHandler) Readyz(c *gin.Context) {
+	report := h.checker.Check(c.Request.Context())
+	code := http.StatusOK
+	if !report.Ready() {
+		code = http.StatusServiceUnavailable
+	}
+	c.JSON(code, report.Redacted())
+}
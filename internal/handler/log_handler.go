@@ -1,15 +1,20 @@
 package handler
 
 import (
+	"errors"
 	"net/http"
 	"strconv"
 	"time"
 
 	"github.com/Yupoer/logpulse/internal/domain"
+	"github.com/Yupoer/logpulse/internal/metrics"
+	"github.com/Yupoer/logpulse/internal/resilience"
 	"github.com/Yupoer/logpulse/internal/service"
 	"github.com/gin-gonic/gin"
 )
 
+const maxSearchLimit = 1000
+
 type LogHandler struct {
 	service *service.LogService
 }
@@ -28,8 +33,19 @@ func (h *LogHandler) CreateLog(c *gin.Context) {
 	if entry.Timestamp.IsZero() {
 		entry.Timestamp = time.Now()
 	}
+	c.Set(metrics.ServiceKey, entry.ServiceName)
+
+	ctx := c.Request.Context()
+	if c.GetHeader("X-Require-Ack") == "true" {
+		// Wait for Kafka's ack even when the producer runs in async mode
+		ctx = domain.WithDeliveryAck(ctx)
+	}
 
-	totalCount, err := h.service.CreateLog(c.Request.Context(), &entry)
+	totalCount, err := h.service.CreateLog(ctx, &entry)
+	if errors.Is(err, resilience.ErrCircuitOpen) || errors.Is(err, domain.ErrSpoolFull) {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Log pipeline unavailable, retry later"})
+		return
+	}
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to process log"})
 		return
@@ -42,7 +58,8 @@ func (h *LogHandler) CreateLog(c *gin.Context) {
 	})
 }
 
-// GetLog
+// GetLog handles GET /logs/:id. The optional day (YYYY-MM-DD, server local
+// time) of the entry's timestamp lets a partitioned DB read just that day.
 func (h *LogHandler) GetLog(c *gin.Context) {
 	idStr := c.Param("id")
 	id, err := strconv.ParseUint(idStr, 10, 32)
@@ -50,8 +67,15 @@ func (h *LogHandler) GetLog(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID format"})
 		return
 	}
+	var day time.Time
+	if value := c.Query("day"); value != "" {
+		if day, err = time.ParseInLocation(time.DateOnly, value, time.Local); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid 'day', expected YYYY-MM-DD"})
+			return
+		}
+	}
 
-	entry, err := h.service.GetLog(c.Request.Context(), uint(id))
+	entry, err := h.service.GetLog(c.Request.Context(), uint(id), day)
 	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Log not found"})
 		return
@@ -61,21 +85,59 @@ func (h *LogHandler) GetLog(c *gin.Context) {
 }
 
 // SearchLogs handles GET /logs/search?q=keyword
+// Filters: service, level, from, to (RFC 3339), limit; at least one of q,
+// service or level is required
 func (h *LogHandler) SearchLogs(c *gin.Context) {
-	query := c.Query("q")
-	if query == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Query parameter 'q' is required"})
+	query := domain.LogSearchQuery{
+		Query:       c.Query("q"),
+		ServiceName: c.Query("service"),
+		Level:       c.Query("level"),
+	}
+	if query.Query == "" && query.ServiceName == "" && query.Level == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "At least one of 'q', 'service' or 'level' is required"})
 		return
 	}
 
-	logs, err := h.service.SearchLogs(c.Request.Context(), query)
+	var err error
+	if query.From, err = parseTimeParam(c, "from"); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid 'from', expected RFC 3339"})
+		return
+	}
+	if query.To, err = parseTimeParam(c, "to"); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid 'to', expected RFC 3339"})
+		return
+	}
+	if limit := c.Query("limit"); limit != "" {
+		query.Limit, err = strconv.Atoi(limit)
+		if err != nil || query.Limit <= 0 || query.Limit > maxSearchLimit {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid 'limit'"})
+			return
+		}
+	}
+
+	result, err := h.service.SearchLogs(c.Request.Context(), query)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Search failed"})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{
-		"count": len(logs),
-		"data":  logs,
-	})
+	resp := gin.H{
+		"count":    len(result.Logs),
+		"data":     result.Logs,
+		"degraded": result.Degraded,
+	}
+	if result.Degraded {
+		// Search engine unavailable: results come from the DB fallback
+		c.Header("X-Search-Degraded", "true")
+		resp["warning"] = "Search engine unavailable, showing degraded results from the database (substring match, last 24h unless 'from' is set)"
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+func parseTimeParam(c *gin.Context, name string) (time.Time, error) {
+	value := c.Query(name)
+	if value == "" {
+		return time.Time{}, nil
+	}
+	return time.Parse(time.RFC3339, value)
 }
@@ -0,0 +1,26 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/Yupoer/logpulse/internal/service"
+	"github.com/gin-gonic/gin"
+)
+
+type PipelineHandler struct {
+	service *service.PipelineService
+}
+
+func NewPipelineHandler(service *service.PipelineService) *PipelineHandler {
+	return &PipelineHandler{service: service}
+}
+
+// Status handles GET /admin/pipeline
+func (h *PipelineHandler) Status(c *gin.Context) {
+	status, err := h.service.Status(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read pipeline status"})
+		return
+	}
+	c.JSON(http.StatusOK, status)
+}
@@ -0,0 +1,195 @@
+// Package health checks LogPulse's dependencies for the readiness probe.
+// Liveness (/healthz) checks nothing: a process that can answer is alive,
+// and restarting it would not bring a dependency back.
+package health
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// reportTTL is how long Check reuses a report, so frequent or concurrent
+// probes don't each ping every dependency
+const reportTTL = time.Second
+
+// Component statuses
+const (
+	StatusUp   = "up"
+	StatusDown = "down"
+)
+
+// Overall statuses: every component up, only non-critical components down,
+// or a critical component down (not ready)
+const (
+	StatusReady    = "ready"
+	StatusDegraded = "degraded"
+	StatusNotReady = "not_ready"
+)
+
+// Check probes one dependency. Probe should honour ctx; one that doesn't is
+// reported down once the timeout passes and left to finish on its own.
+type Check struct {
+	Name     string
+	Critical bool // Down means the process is not ready
+	Probe    func(ctx context.Context) error
+}
+
+// ComponentStatus is the result of one Check
+type ComponentStatus struct {
+	Status    string `json:"status"`
+	Critical  bool   `json:"critical"`
+	LatencyMS int64  `json:"latency_ms"`
+	Error     string `json:"error,omitempty"`
+}
+
+// BreakerOpen is the state of a circuit breaker failing calls fast
+const BreakerOpen = "open"
+
+// Report is the result of every Check
+type Report struct {
+	Status     string                     `json:"status"`
+	Components map[string]ComponentStatus `json:"components"`
+	Breakers   map[string]string          `json:"breakers,omitempty"` // Circuit breaker states by name
+}
+
+// Ready reports whether every critical component is up
+func (r Report) Ready() bool { return r.Status != StatusNotReady }
+
+// Redacted drops the error messages, which can name hosts and users, for
+// responses on public ports
+func (r Report) Redacted() Report {
+	components := make(map[string]ComponentStatus, len(r.Components))
+	for name, status := range r.Components {
+		status.Error = ""
+		components[name] = status
+	}
+	return Report{Status: r.Status, Components: components, Breakers: r.Breakers}
+}
+
+// Checker runs its checks concurrently, each under timeout
+type Checker struct {
+	checks   []Check
+	timeout  time.Duration
+	breakers func() map[string]string
+
+	mu       sync.Mutex // Held while checking, so concurrent callers share one run
+	last     Report
+	lastTime time.Time
+	ready    atomic.Bool // Whether last is ready, readable without waiting on mu
+}
+
+func NewChecker(timeout time.Duration, checks ...Check) *Checker {
+	c := &Checker{checks: checks, timeout: timeout}
+	c.ready.Store(true)
+	return c
+}
+
+// ReportBreakers adds the circuit breaker states returned by states to every
+// report; call it before the first Check. An open breaker makes the report
+// degraded, never not ready: the breaker already fails its calls fast, and
+// whether the dependency behind it is critical is its probe's call
+// (READY_CRITICAL). Otherwise an open Elasticsearch breaker would take a
+// replica whose ingestion works out of rotation.
+func (c *Checker) ReportBreakers(states func() map[string]string) {
+	c.breakers = states
+}
+
+// Ready reports whether the last report was ready, without probing
+// anything. It is true until the first Check.
+func (c *Checker) Ready() bool { return c.ready.Load() }
+
+// Watch runs Check every reportTTL until ctx is done, so Ready stays
+// current even when nothing polls /readyz
+func (c *Checker) Watch(ctx context.Context) {
+	ticker := time.NewTicker(reportTTL)
+	defer ticker.Stop()
+	for {
+		c.Check(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Check probes every dependency and waits for all of them (at most timeout).
+// A report younger than reportTTL is returned as is. Down components are
+// logged with their error.
+func (c *Checker) Check(ctx context.Context) Report {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.lastTime.IsZero() && time.Since(c.lastTime) < reportTTL {
+		return c.last
+	}
+
+	// Shared with other callers, so one caller going away must not fail it
+	report := c.check(context.WithoutCancel(ctx))
+	for name, status := range report.Components {
+		if status.Status == StatusDown {
+			slog.Warn("Readiness check failed", "component", name, "critical", status.Critical, "error", status.Error)
+		}
+	}
+	c.last, c.lastTime = report, time.Now()
+	c.ready.Store(report.Ready())
+	return report
+}
+
+func (c *Checker) check(ctx context.Context) Report {
+	report := Report{Status: StatusReady, Components: make(map[string]ComponentStatus, len(c.checks))}
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for _, check := range c.checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			status := c.run(ctx, check)
+
+			mu.Lock()
+			defer mu.Unlock()
+			report.Components[check.Name] = status
+			switch {
+			case status.Status == StatusUp:
+			case check.Critical:
+				report.Status = StatusNotReady
+			case report.Status == StatusReady:
+				report.Status = StatusDegraded
+			}
+		}()
+	}
+	wg.Wait()
+
+	if c.breakers != nil {
+		report.Breakers = c.breakers()
+		for _, state := range report.Breakers {
+			if state == BreakerOpen && report.Status == StatusReady {
+				report.Status = StatusDegraded
+			}
+		}
+	}
+	return report
+}
+
+func (c *Checker) run(ctx context.Context, check Check) ComponentStatus {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	start := time.Now()
+	done := make(chan error, 1)
+	go func() { done <- check.Probe(ctx) }()
+
+	var err error
+	select {
+	case err = <-done:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+	status := ComponentStatus{Status: StatusUp, Critical: check.Critical, LatencyMS: time.Since(start).Milliseconds()}
+	if err != nil {
+		status.Status, status.Error = StatusDown, err.Error()
+	}
+	return status
+}
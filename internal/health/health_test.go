@@ -0,0 +1,121 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func up(context.Context) error   { return nil }
+func down(context.Context) error { return errors.New("connection refused") }
+
+func TestChecker_CriticalDownIsNotReady(t *testing.T) {
+	report := NewChecker(time.Second,
+		Check{Name: "database", Critical: true, Probe: down},
+		Check{Name: "elasticsearch", Probe: up},
+	).Check(context.Background())
+
+	assert.Equal(t, StatusNotReady, report.Status)
+	assert.False(t, report.Ready())
+	assert.Equal(t, StatusDown, report.Components["database"].Status)
+	assert.Equal(t, "connection refused", report.Components["database"].Error)
+	assert.True(t, report.Components["database"].Critical)
+	assert.Equal(t, StatusUp, report.Components["elasticsearch"].Status)
+}
+
+func TestChecker_NonCriticalDownIsDegraded(t *testing.T) {
+	report := NewChecker(time.Second,
+		Check{Name: "database", Critical: true, Probe: up},
+		Check{Name: "elasticsearch", Probe: down},
+	).Check(context.Background())
+
+	assert.Equal(t, StatusDegraded, report.Status)
+	assert.True(t, report.Ready())
+}
+
+func TestChecker_TimesOutHangingProbe(t *testing.T) {
+	hang := make(chan struct{})
+	defer close(hang)
+
+	start := time.Now()
+	report := NewChecker(20*time.Millisecond,
+		Check{Name: "kafka", Critical: true, Probe: func(context.Context) error { <-hang; return nil }},
+	).Check(context.Background())
+
+	assert.Less(t, time.Since(start), time.Second)
+	assert.Equal(t, StatusNotReady, report.Status)
+	assert.Equal(t, context.DeadlineExceeded.Error(), report.Components["kafka"].Error)
+}
+
+func TestChecker_ReusesRecentReport(t *testing.T) {
+	var probes atomic.Int32
+	checker := NewChecker(time.Second, Check{Name: "database", Critical: true, Probe: func(context.Context) error {
+		probes.Add(1)
+		return nil
+	}})
+
+	for i := 0; i < 5; i++ {
+		assert.True(t, checker.Check(context.Background()).Ready())
+	}
+	assert.Equal(t, int32(1), probes.Load())
+
+	checker.lastTime = time.Now().Add(-reportTTL)
+	checker.Check(context.Background())
+	assert.Equal(t, int32(2), probes.Load())
+}
+
+func TestChecker_ReadyFollowsLastReport(t *testing.T) {
+	var failing atomic.Bool
+	checker := NewChecker(time.Second, Check{Name: "database", Critical: true, Probe: func(context.Context) error {
+		if failing.Load() {
+			return errors.New("connection refused")
+		}
+		return nil
+	}})
+	assert.True(t, checker.Ready(), "ready until the first check")
+
+	failing.Store(true)
+	checker.Check(context.Background())
+	assert.False(t, checker.Ready())
+
+	failing.Store(false)
+	checker.lastTime = time.Time{}
+	checker.Check(context.Background())
+	assert.True(t, checker.Ready())
+}
+
+func TestChecker_OpenBreakerIsDegradedNotUnready(t *testing.T) {
+	checker := NewChecker(time.Second, Check{Name: "database", Critical: true, Probe: up})
+	checker.ReportBreakers(func() map[string]string {
+		return map[string]string{"database": "closed", "elasticsearch": BreakerOpen}
+	})
+
+	report := checker.Check(context.Background())
+
+	assert.Equal(t, StatusDegraded, report.Status)
+	assert.True(t, report.Ready())
+	assert.True(t, checker.Ready())
+	assert.Equal(t, map[string]string{"database": "closed", "elasticsearch": BreakerOpen}, report.Redacted().Breakers)
+}
+
+func TestChecker_OpenBreakerKeepsNotReady(t *testing.T) {
+	checker := NewChecker(time.Second, Check{Name: "database", Critical: true, Probe: down})
+	checker.ReportBreakers(func() map[string]string { return map[string]string{"database": BreakerOpen} })
+
+	assert.Equal(t, StatusNotReady, checker.Check(context.Background()).Status)
+}
+
+func TestReport_RedactedDropsErrors(t *testing.T) {
+	report := NewChecker(time.Second, Check{Name: "database", Critical: true, Probe: down}).Check(context.Background())
+
+	redacted := report.Redacted()
+	assert.Equal(t, StatusNotReady, redacted.Status)
+	assert.Equal(t, StatusDown, redacted.Components["database"].Status)
+	assert.Empty(t, redacted.Components["database"].Error)
+	// The original keeps it
+	assert.Equal(t, "connection refused", report.Components["database"].Error)
+}
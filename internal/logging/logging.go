@@ -0,0 +1,116 @@
+// Package logging sets up LogPulse's own logs: leveled log/slog records,
+// JSON by default, tagged with the request ID and trace ID of the context
+// they are logged with. A request ID follows a log through the queue, so
+// the worker's lines about it carry the same ID as the API's.
+package logging
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+
+	"github.com/google/uuid"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/Yupoer/logpulse/internal/config"
+)
+
+// HeaderRequestID is the HTTP header a request ID is read from and echoed in
+const HeaderRequestID = "X-Request-ID"
+
+type requestIDKey struct{}
+
+// WithRequestID returns ctx carrying the request ID id
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// RequestID returns the request ID in ctx, or "" when there is none
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// NewRequestID returns a random request ID
+func NewRequestID() string {
+	return uuid.NewString()
+}
+
+// level is the default logger's minimum level, changed at runtime by SetLevel
+var level = new(slog.LevelVar)
+
+// Setup makes a handler for cfg the slog default. The standard log
+// package goes through it too, at info level.
+func Setup(cfg config.LogConfig, w io.Writer) error {
+	h, err := newHandler(cfg, w, level)
+	if err != nil {
+		return err
+	}
+	slog.SetDefault(slog.New(h))
+	return nil
+}
+
+// Level is the default logger's current minimum level
+func Level() slog.Level {
+	return level.Level()
+}
+
+// SetLevel changes the default logger's minimum level (debug, info, warn
+// or error) without a restart
+func SetLevel(name string) error {
+	var l slog.Level
+	if err := l.UnmarshalText([]byte(name)); err != nil {
+		return err
+	}
+	level.Set(l)
+	return nil
+}
+
+// NewHandler writes records of cfg.Level and above to w in cfg.Format
+// (json or text), adding request_id and trace_id from the record's context
+func NewHandler(cfg config.LogConfig, w io.Writer) (slog.Handler, error) {
+	return newHandler(cfg, w, new(slog.LevelVar))
+}
+
+func newHandler(cfg config.LogConfig, w io.Writer, lv *slog.LevelVar) (slog.Handler, error) {
+	var l slog.Level
+	if err := l.UnmarshalText([]byte(cfg.Level)); err != nil {
+		return nil, fmt.Errorf("invalid LOG_LEVEL %q: %w", cfg.Level, err)
+	}
+	lv.Set(l)
+	opts := &slog.HandlerOptions{Level: lv}
+
+	switch strings.ToLower(cfg.Format) {
+	case "", "json":
+		return &contextHandler{slog.NewJSONHandler(w, opts)}, nil
+	case "text":
+		return &contextHandler{slog.NewTextHandler(w, opts)}, nil
+	default:
+		return nil, fmt.Errorf("unknown LOG_FORMAT %q (want json or text)", cfg.Format)
+	}
+}
+
+// contextHandler adds the IDs carried by a record's context
+type contextHandler struct {
+	slog.Handler
+}
+
+func (h *contextHandler) Handle(ctx context.Context, r slog.Record) error {
+	if id := RequestID(ctx); id != "" {
+		r.AddAttrs(slog.String("request_id", id))
+	}
+	if sc := trace.SpanContextFromContext(ctx); sc.IsValid() {
+		r.AddAttrs(slog.String("trace_id", sc.TraceID().String()))
+	}
+	return h.Handler.Handle(ctx, r)
+}
+
+func (h *contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &contextHandler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h *contextHandler) WithGroup(name string) slog.Handler {
+	return &contextHandler{h.Handler.WithGroup(name)}
+}
@@ -0,0 +1,152 @@
+// Package metrics defines LogPulse's Prometheus metrics. Names and labels
+// are what dashboards and alerts are built on: add new metrics rather than
+// renaming or relabelling existing ones.
+package metrics
+
+import (
+	"context"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+
+	"github.com/Yupoer/logpulse/internal/domain"
+)
+
+// ServiceKey is the gin context key handlers set to the log's service name,
+// used as the service label of the HTTP metrics
+const ServiceKey = "metrics.service"
+
+// OtherService is the service label of services outside the allow-list
+const OtherService = "other"
+
+// Registry holds every LogPulse metric plus the Go runtime and process collectors
+var Registry = prometheus.NewRegistry()
+
+var (
+	// HTTP (API role)
+	HTTPRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "logpulse_http_requests_total",
+		Help: "HTTP requests by route, status code and service (service is only set on POST /logs, \"other\" outside METRICS_SERVICES).",
+	}, []string{"route", "status", "service"})
+	HTTPRequestBytes = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "logpulse_http_request_bytes_total",
+		Help: "Request body bytes read, by route, status code and service.",
+	}, []string{"route", "status", "service"})
+	HTTPRequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "logpulse_http_request_duration_seconds",
+		Help:    "HTTP request latency by route.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"route"})
+
+	// Producer (API role)
+	ProducerSendDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "logpulse_producer_send_duration_seconds",
+		Help:    "Time SendLog took per log, by queue backend, lane and result (ok or error).",
+		Buckets: []float64{.0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5},
+	}, []string{"backend", "lane", "result"})
+
+	// Spool (API role), read when scraped; zero while the spool is disabled
+	SpoolEntries = prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "logpulse_spool_entries",
+		Help: "Logs waiting in the local disk spool for the queue.",
+	}, func() float64 { entries, _ := spoolStats(); return float64(entries) })
+	SpoolBytes = prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "logpulse_spool_bytes",
+		Help: "Bytes of spool segments waiting on disk.",
+	}, func() float64 { _, bytes := spoolStats(); return float64(bytes) })
+
+	// Consumer (worker role)
+	ConsumerBatchSize = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "logpulse_consumer_batch_size",
+		Help:    "Logs per stored batch, by topic (or stream).",
+		Buckets: []float64{1, 5, 10, 25, 50, 100, 250, 500, 1000},
+	}, []string{"topic"})
+	ConsumerFlushDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "logpulse_consumer_flush_duration_seconds",
+		Help:    "Time to store a batch in the DB and ES, retries included, by topic.",
+		Buckets: []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10, 30},
+	}, []string{"topic"})
+	ConsumerFlushFailures = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "logpulse_consumer_flush_failures_total",
+		Help: "Failed flush attempts by topic and stage (db, es or dead_letter).",
+	}, []string{"topic", "stage"})
+
+	// Read path
+	CacheRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "logpulse_cache_requests_total",
+		Help: "Log lookups in the Redis cache by GET /logs/:id, by result (hit or miss).",
+	}, []string{"result"})
+	ESSearchDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "logpulse_es_search_duration_seconds",
+		Help:    "Elasticsearch search latency by result (ok or error).",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"result"})
+
+	// Rate limiting
+	RateLimitDecisions = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "logpulse_ratelimit_decisions_total",
+		Help: "Rate limiter decisions: allow, deny, too_large (cost above capacity), length_required (chunked body while bytes are charged); while Redis is unreachable, local_allow and local_deny (in-process fallback), error (request allowed) or unavailable (request rejected).",
+	}, []string{"decision"})
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		HTTPRequests, HTTPRequestBytes, HTTPRequestDuration,
+		ProducerSendDuration,
+		SpoolEntries, SpoolBytes,
+		ConsumerBatchSize, ConsumerFlushDuration, ConsumerFlushFailures,
+		CacheRequests, ESSearchDuration,
+		RateLimitDecisions,
+	)
+}
+
+var spoolSource atomic.Pointer[func() (entries, bytes int64)]
+
+// ObserveSpool makes the spool gauges report stats
+func ObserveSpool(stats func() (entries, bytes int64)) {
+	spoolSource.Store(&stats)
+}
+
+func spoolStats() (entries, bytes int64) {
+	if stats := spoolSource.Load(); stats != nil {
+		return (*stats)()
+	}
+	return 0, 0
+}
+
+// Handler serves Registry in the Prometheus text format
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{})
+}
+
+// Result is the result label for err
+func Result(err error) string {
+	if err != nil {
+		return "error"
+	}
+	return "ok"
+}
+
+type instrumentedProducer struct {
+	domain.LogProducer
+	backend string
+	lane    string
+}
+
+// InstrumentProducer records the latency of every SendLog on next
+func InstrumentProducer(next domain.LogProducer, backend, lane string) domain.LogProducer {
+	return &instrumentedProducer{LogProducer: next, backend: backend, lane: lane}
+}
+
+func (p *instrumentedProducer) SendLog(ctx context.Context, entry *domain.LogEntry) error {
+	start := time.Now()
+	err := p.LogProducer.SendLog(ctx, entry)
+	ProducerSendDuration.WithLabelValues(p.backend, p.lane, Result(err)).Observe(time.Since(start).Seconds())
+	return err
+}
@@ -0,0 +1,73 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Yupoer/logpulse/internal/domain"
+)
+
+type failingProducer struct {
+	domain.LogProducer
+	err error
+}
+
+func (p *failingProducer) SendLog(ctx context.Context, entry *domain.LogEntry) error { return p.err }
+
+func TestInstrumentProducer_ObservesByResult(t *testing.T) {
+	ok := InstrumentProducer(&failingProducer{}, "kafka", "test-ok")
+	failing := InstrumentProducer(&failingProducer{err: errors.New("down")}, "kafka", "test-failing")
+
+	require.NoError(t, ok.SendLog(context.Background(), &domain.LogEntry{}))
+	require.Error(t, failing.SendLog(context.Background(), &domain.LogEntry{}))
+
+	assert.Equal(t, uint64(1), sampleCount(t, ProducerSendDuration.WithLabelValues("kafka", "test-ok", "ok")))
+	assert.Equal(t, uint64(1), sampleCount(t, ProducerSendDuration.WithLabelValues("kafka", "test-failing", "error")))
+}
+
+func sampleCount(t *testing.T, o prometheus.Observer) uint64 {
+	var m dto.Metric
+	require.NoError(t, o.(prometheus.Histogram).Write(&m))
+	return m.GetHistogram().GetSampleCount()
+}
+
+// The names are documented in the README and used by dashboards
+func TestRegistry_MetricNamesAreStable(t *testing.T) {
+	HTTPRequests.WithLabelValues("/logs", "201", "test").Inc()
+	families, err := Registry.Gather()
+	require.NoError(t, err)
+	names := map[string]bool{}
+	for _, f := range families {
+		names[f.GetName()] = true
+	}
+	for _, name := range []string{
+		"logpulse_http_requests_total",
+		"logpulse_producer_send_duration_seconds",
+		"go_goroutines",
+	} {
+		assert.True(t, names[name], name)
+	}
+	problems, err := testutil.GatherAndLint(Registry)
+	require.NoError(t, err)
+	assert.Empty(t, problems)
+}
+
+func TestSpoolGauges_ReadStatsWhenScraped(t *testing.T) {
+	assert.Equal(t, float64(0), testutil.ToFloat64(SpoolEntries))
+
+	entries := int64(3)
+	ObserveSpool(func() (int64, int64) { return entries, entries * 100 })
+	t.Cleanup(func() { spoolSource.Store(nil) })
+
+	assert.Equal(t, float64(3), testutil.ToFloat64(SpoolEntries))
+	entries = 5
+	assert.Equal(t, float64(5), testutil.ToFloat64(SpoolEntries))
+	assert.Equal(t, float64(500), testutil.ToFloat64(SpoolBytes))
+}
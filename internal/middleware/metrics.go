@@ -0,0 +1,54 @@
+package middleware
+
+import (
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/Yupoer/logpulse/internal/metrics"
+	"github.com/gin-gonic/gin"
+)
+
+// countingBody counts the request body bytes the handler reads
+type countingBody struct {
+	io.ReadCloser
+	n int64
+}
+
+func (b *countingBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.n += int64(n)
+	return n, err
+}
+
+// Metrics records request counts, body bytes and latency per route. Handlers
+// add the service label by setting metrics.ServiceKey on the context; names
+// outside services are reported as metrics.OtherService.
+func Metrics(services []string) gin.HandlerFunc {
+	allowed := make(map[string]bool, len(services))
+	for _, s := range services {
+		allowed[s] = true
+	}
+	return func(c *gin.Context) {
+		start := time.Now()
+		body := &countingBody{ReadCloser: c.Request.Body}
+		if c.Request.Body != nil {
+			c.Request.Body = body
+		}
+
+		c.Next()
+
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched" // Unknown paths would make the label unbounded
+		}
+		status := strconv.Itoa(c.Writer.Status())
+		service := c.GetString(metrics.ServiceKey)
+		if service != "" && !allowed[service] {
+			service = metrics.OtherService // The name comes from the request body
+		}
+		metrics.HTTPRequests.WithLabelValues(route, status, service).Inc()
+		metrics.HTTPRequestBytes.WithLabelValues(route, status, service).Add(float64(body.n))
+		metrics.HTTPRequestDuration.WithLabelValues(route).Observe(time.Since(start).Seconds())
+	}
+}
@@ -0,0 +1,88 @@
+package middleware
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/Yupoer/logpulse/internal/config"
+	"github.com/Yupoer/logpulse/internal/metrics"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMetrics_CountsRequestsAndBytesByRoute(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(Metrics([]string{"metrics-test-service"}))
+	r.POST("/logs", func(c *gin.Context) {
+		_, _ = io.ReadAll(c.Request.Body)
+		c.Set(metrics.ServiceKey, c.GetHeader("X-Test-Service"))
+		c.Status(http.StatusCreated)
+	})
+
+	body := `{"service_name":"metrics-test-service"}`
+	for i := 0; i < 2; i++ {
+		req := httptest.NewRequest(http.MethodPost, "/logs", strings.NewReader(body))
+		req.Header.Set("X-Test-Service", "metrics-test-service")
+		r.ServeHTTP(httptest.NewRecorder(), req)
+	}
+	r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/no/such/path", nil))
+
+	assert.Equal(t, 2.0, testutil.ToFloat64(metrics.HTTPRequests.WithLabelValues("/logs", "201", "metrics-test-service")))
+	assert.Equal(t, float64(2*len(body)), testutil.ToFloat64(metrics.HTTPRequestBytes.WithLabelValues("/logs", "201", "metrics-test-service")))
+	assert.GreaterOrEqual(t, testutil.ToFloat64(metrics.HTTPRequests.WithLabelValues("unmatched", "404", "")), 1.0)
+}
+
+func TestMetrics_UnlistedServicesReportAsOther(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(Metrics([]string{"payment-service"}))
+	r.POST("/logs", func(c *gin.Context) {
+		c.Set(metrics.ServiceKey, c.GetHeader("X-Test-Service"))
+		c.Status(http.StatusCreated)
+	})
+
+	before := testutil.ToFloat64(metrics.HTTPRequests.WithLabelValues("/logs", "201", metrics.OtherService))
+	for _, service := range []string{"random-1", "random-2", "random-3"} {
+		req := httptest.NewRequest(http.MethodPost, "/logs", nil)
+		req.Header.Set("X-Test-Service", service)
+		r.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	assert.Equal(t, before+3, testutil.ToFloat64(metrics.HTTPRequests.WithLabelValues("/logs", "201", metrics.OtherService)))
+	assert.Equal(t, 0.0, testutil.ToFloat64(metrics.HTTPRequests.WithLabelValues("/logs", "201", "random-1")))
+}
+
+func TestRateLimiter_CountsDecisions(t *testing.T) {
+	mr, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mr.Close()
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	defer client.Close()
+
+	rl, err := NewRateLimiter(client, config.RateLimitConfig{Enabled: true, Capacity: 1, Rate: 1}, nil)
+	require.NoError(t, err)
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(rl.Middleware())
+	r.GET("/ping", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	allowed := testutil.ToFloat64(metrics.RateLimitDecisions.WithLabelValues("allow"))
+	denied := testutil.ToFloat64(metrics.RateLimitDecisions.WithLabelValues("deny"))
+	for i := 0; i < 3; i++ {
+		r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/ping", nil))
+	}
+
+	assert.Equal(t, allowed+1, testutil.ToFloat64(metrics.RateLimitDecisions.WithLabelValues("allow")))
+	assert.Equal(t, denied+2, testutil.ToFloat64(metrics.RateLimitDecisions.WithLabelValues("deny")))
+}
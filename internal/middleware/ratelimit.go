@@ -1,11 +1,22 @@
 package middleware
 
 import (
+	"cmp"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
 	"net/http"
+	"strconv"
+	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/Yupoer/logpulse/internal/config"
+	"github.com/Yupoer/logpulse/internal/metrics"
+	"github.com/Yupoer/logpulse/internal/resilience"
 	"github.com/gin-gonic/gin"
 	"github.com/redis/go-redis/v9"
 )
@@ -14,11 +25,14 @@ import (
 // This script atomically checks and consumes tokens from the bucket.
 // Atomicity is guaranteed by Redis executing Lua scripts in a single thread.
 const tokenBucketScript = `
--- KEYS[1] = rate limit key (e.g., "ratelimit:192.168.1.1")
+-- KEYS[1] = rate limit key (e.g., "ratelimit:ip:192.168.1.1")
 -- ARGV[1] = capacity (bucket capacity)
 -- ARGV[2] = rate (tokens per second refill rate)
 -- ARGV[3] = now (current timestamp in milliseconds)
--- ARGV[4] = requested (number of tokens to consume, usually 1)
+-- ARGV[4] = requested (number of tokens to consume: the request's cost, at most capacity)
+--
+-- Returns {allowed (1 or 0), remaining tokens (rounded down),
+--          ms until the bucket is full, ms until requested tokens are available (0 if allowed)}
 
 local tokens_key = KEYS[1]
 local capacity = tonumber(ARGV[1])
@@ -32,63 +46,335 @@ local tokens = tonumber(data[1]) or capacity  -- Default to full bucket on first
 local last_time = tonumber(data[2]) or now
 
 -- Calculate tokens to add based on elapsed time
-local elapsed = (now - last_time) / 1000  -- Convert to seconds
+local elapsed = math.max(0, now - last_time) / 1000  -- Convert to seconds
 local new_tokens = math.min(capacity, tokens + elapsed * rate)
 
 -- Try to consume tokens
+local allowed = 0
+local retry_ms = math.ceil((requested - new_tokens) * 1000 / rate)
 if new_tokens >= requested then
     new_tokens = new_tokens - requested
-    redis.call("HMSET", tokens_key, "tokens", new_tokens, "last_time", now)
-    redis.call("EXPIRE", tokens_key, 60)  -- TTL to prevent memory leak
-    return 1  -- Allow
-else
-    redis.call("HMSET", tokens_key, "tokens", new_tokens, "last_time", now)
-    redis.call("EXPIRE", tokens_key, 60)
-    return 0  -- Deny
+    allowed = 1
+    retry_ms = 0
 end
+
+-- A missing bucket reads as full, so the key may expire once it has refilled
+local reset_ms = math.ceil((capacity - new_tokens) * 1000 / rate)
+redis.call("HMSET", tokens_key, "tokens", new_tokens, "last_time", now)
+redis.call("PEXPIRE", tokens_key, math.max(reset_ms, 1000))  -- TTL to prevent memory leak
+
+return {allowed, math.floor(new_tokens), reset_ms, retry_ms}
 `
 
-// RateLimiter implements Token Bucket rate limiting using Redis
+// Decision is the outcome of one rate limit check
+type Decision struct {
+	Allowed    bool
+	Limit      int64         // Bucket capacity
+	Remaining  int64         // Whole tokens left after this request
+	Reset      time.Duration // Until the bucket is full again
+	RetryAfter time.Duration // Until the request would be allowed; 0 if it was
+	Local      bool          // Decided by the in-process fallback, Redis being unreachable
+}
+
+// HeaderAPIKey identifies a client holding one of RATE_LIMIT_API_KEYS
+const HeaderAPIKey = "X-API-Key"
+
+// HeaderService names the service a keyed request is sent for. It only
+// picks a bucket an override already gives that key or tenant.
+const HeaderService = "X-Service-Name"
+
+// serviceScope joins a key or tenant identity and one of its services
+const serviceScope = ":service:"
+
+// Identities a listed API key can be limited as (RATE_LIMIT_IDENTITY)
+const (
+	IdentityAPIKey = "api_key"
+	IdentityTenant = "tenant"
+)
+
+// Algorithms RateLimiter can run in Redis, each an atomic Lua script
+const (
+	AlgorithmTokenBucket   = "token_bucket"
+	AlgorithmGCRA          = "gcra"
+	AlgorithmSlidingWindow = "sliding_window"
+)
+
+// algorithms maps each algorithm to its script and key prefix. The
+// prefixes differ so switching algorithms never reads another's state.
+var algorithms = map[string]struct {
+	script    string
+	keyPrefix string
+}{
+	AlgorithmTokenBucket:   {tokenBucketScript, "ratelimit:"},
+	AlgorithmGCRA:          {gcraScript, "ratelimit:gcra:"},
+	AlgorithmSlidingWindow: {slidingWindowScript, "ratelimit:sw:"},
+}
+
+// What RateLimiter does while Redis is unreachable
+const (
+	FailOpen   = "open"   // Allow every request
+	FailClosed = "closed" // Reject every request with 503
+	FailLocal  = "local"  // Limit with per-process buckets
+)
+
+// ErrCostExceedsCapacity means a request costs more tokens than its bucket
+// can ever hold, so waiting would not help
+var ErrCostExceedsCapacity = errors.New("request cost exceeds rate limit capacity")
+
+// RateLimiter implements rate limiting in Redis (Token Bucket unless
+// configured otherwise), with one bucket per client identity
 type RateLimiter struct {
-	client   *redis.Client
-	script   *redis.Script
-	capacity int64
-	rate     float64
-	enabled  bool
+	client        *redis.Client
+	script        *redis.Script
+	keyPrefix     string
+	now           func() time.Time
+	limit         config.RateLimitTier // For clients without an override
+	apiKeys       map[string]string    // Valid API key to tenant
+	identity      []string
+	overrides     map[string]config.RateLimitTier
+	routeCosts    map[string]int64
+	bytesPerToken int64
+	enabled       bool
+
+	breaker  *resilience.Breaker // Around Redis; while open, Redis is not tried
+	policy   string
+	local    *localLimiter
+	degraded atomic.Bool // Redis failed and has not answered since
 }
 
-// NewRateLimiter creates a new rate limiter instance
-func NewRateLimiter(client *redis.Client, cfg config.RateLimitConfig) *RateLimiter {
-	return &RateLimiter{
-		client:   client,
-		script:   redis.NewScript(tokenBucketScript),
-		capacity: cfg.Capacity,
-		rate:     cfg.Rate,
-		enabled:  cfg.Enabled,
+// NewRateLimiter creates a new rate limiter instance. Redis calls go
+// through breaker, which may be nil. It fails on unknown algorithms,
+// identity sources and failure policies, and on overrides naming an unknown
+// tier or an identity no request can have.
+func NewRateLimiter(client *redis.Client, cfg config.RateLimitConfig, breaker *resilience.Breaker) (*RateLimiter, error) {
+	algorithm, ok := algorithms[cmp.Or(cfg.Algorithm, AlgorithmTokenBucket)]
+	if !ok {
+		return nil, fmt.Errorf("unknown rate limit algorithm %q (want token_bucket, gcra or sliding_window)", cfg.Algorithm)
 	}
+	policy := cfg.FailurePolicy
+	switch policy {
+	case "":
+		policy = FailOpen
+	case FailOpen, FailClosed, FailLocal:
+	default:
+		return nil, fmt.Errorf("unknown rate limit failure policy %q (want open, closed or local)", policy)
+	}
+	for _, source := range cfg.Identity {
+		if source != IdentityAPIKey && source != IdentityTenant {
+			return nil, fmt.Errorf("unknown rate limit identity %q (want api_key or tenant)", source)
+		}
+	}
+	overrides := make(map[string]config.RateLimitTier, len(cfg.Overrides))
+	for identity, name := range cfg.Overrides {
+		tier, ok := cfg.Tiers[name]
+		if !ok {
+			return nil, fmt.Errorf("rate limit override for %q: unknown tier %q", identity, name)
+		}
+		kind, id, _ := strings.Cut(identity, ":")
+		id, service, scoped := strings.Cut(id, serviceScope)
+		if scoped && (kind == "ip" || service == "") {
+			return nil, fmt.Errorf("rate limit override for %q: services are scoped to an api_key: or tenant: identity", identity)
+		}
+		switch kind {
+		case IdentityAPIKey:
+			if _, ok := cfg.APIKeys[id]; !ok {
+				return nil, errors.New("rate limit override for an API key not in RATE_LIMIT_API_KEYS")
+			}
+		case IdentityTenant, "ip":
+		default:
+			return nil, fmt.Errorf("rate limit override for %q: want api_key:, tenant: or ip: identity", identity)
+		}
+		overrides[identity] = tier
+	}
+	for route, cost := range cfg.RouteCosts {
+		if cost < 0 {
+			return nil, fmt.Errorf("rate limit cost of %q is negative", route)
+		}
+	}
+	return &RateLimiter{
+		client:        client,
+		script:        redis.NewScript(algorithm.script),
+		keyPrefix:     algorithm.keyPrefix,
+		now:           time.Now,
+		limit:         config.RateLimitTier{Capacity: cfg.Capacity, Rate: cfg.Rate},
+		apiKeys:       cfg.APIKeys,
+		identity:      cfg.Identity,
+		overrides:     overrides,
+		routeCosts:    cfg.RouteCosts,
+		bytesPerToken: cfg.BytesPerToken,
+		enabled:       cfg.Enabled,
+		breaker:       breaker,
+		policy:        policy,
+		local:         newLocalLimiter(cfg.Replicas),
+	}, nil
 }
 
-// Allow checks if a request is allowed under the rate limit
+// Allow checks if a request is allowed under the default limit
 func (rl *RateLimiter) Allow(ctx context.Context, key string) (bool, error) {
+	return rl.AllowN(ctx, key, 1)
+}
+
+// AllowN checks if a request costing cost tokens is allowed under the
+// default limit
+func (rl *RateLimiter) AllowN(ctx context.Context, key string, cost int64) (bool, error) {
+	d, err := rl.take(ctx, key, rl.limit, cost)
+	return d.Allowed, err
+}
+
+// Cost returns the tokens a request takes: its route's cost (1 unless
+// configured) plus one per BytesPerToken bytes of declared body. The server
+// never reads past Content-Length, so the declared size is the real one;
+// Middleware turns away bodies without one (chunked) while bytes are charged.
+func (rl *RateLimiter) Cost(c *gin.Context) int64 {
+	cost, ok := rl.routeCosts[c.Request.Method+" "+c.FullPath()]
+	if !ok {
+		cost = 1
+	}
+	if rl.bytesPerToken > 0 && c.Request.ContentLength > 0 {
+		cost += c.Request.ContentLength / rl.bytesPerToken
+	}
+	return cost
+}
+
+// take consumes cost tokens from key's bucket, if that many are left.
+// While Redis is unreachable, the local policy answers from the
+// in-process bucket; the other policies return the Redis error.
+func (rl *RateLimiter) take(ctx context.Context, key string, limit config.RateLimitTier, cost int64) (Decision, error) {
 	if !rl.enabled {
-		return true, nil
+		return Decision{Allowed: true, Limit: limit.Capacity, Remaining: limit.Capacity}, nil
+	}
+	if cost > limit.Capacity {
+		return Decision{}, fmt.Errorf("%w: costs %d, capacity %d", ErrCostExceedsCapacity, cost, limit.Capacity)
 	}
 
-	now := time.Now().UnixMilli()
+	var d Decision
+	var err error
+	breakerErr := rl.breaker.Do(func() error {
+		d, err = rl.takeShared(ctx, key, limit, cost)
+		if ctx.Err() != nil {
+			return nil // The client gave up; says nothing about Redis
+		}
+		return err
+	})
+	if err == nil {
+		err = breakerErr // ErrCircuitOpen, Redis not tried
+	}
+	if err == nil {
+		if rl.degraded.CompareAndSwap(true, false) {
+			slog.Info("Redis reachable again, rate limiting with shared buckets")
+		}
+		return d, nil
+	}
+	if ctx.Err() != nil {
+		return Decision{}, err
+	}
+
+	if rl.degraded.CompareAndSwap(false, true) {
+		slog.Warn("Redis unreachable, rate limiting falls back", "policy", rl.policy, "error", err)
+	}
+	if rl.policy != FailLocal {
+		return Decision{}, err
+	}
+	d = rl.local.take(key, limit, cost)
+	d.Local = true
+	return d, nil
+}
+
+// takeShared runs the algorithm's script on key's bucket in Redis
+func (rl *RateLimiter) takeShared(ctx context.Context, key string, limit config.RateLimitTier, cost int64) (Decision, error) {
+	now := rl.now().UnixMilli()
 	result, err := rl.script.Run(
 		ctx,
 		rl.client,
 		[]string{key},
-		rl.capacity,
-		rl.rate,
+		limit.Capacity,
+		limit.Rate,
 		now,
-		1, // Request 1 token
-	).Int()
+		cost,
+	).Int64Slice()
 
 	if err != nil {
-		return false, err
+		return Decision{}, err
+	}
+	if len(result) != 4 {
+		return Decision{}, fmt.Errorf("rate limit script returned %d values, want 4", len(result))
+	}
+	return Decision{
+		Allowed:    result[0] == 1,
+		Limit:      limit.Capacity,
+		Remaining:  result[1],
+		Reset:      time.Duration(result[2]) * time.Millisecond,
+		RetryAfter: time.Duration(result[3]) * time.Millisecond,
+	}, nil
+}
+
+// setHeaders reports d in the RateLimit-* headers (IETF draft
+// "RateLimit header fields for HTTP") and, on denial, Retry-After. Times
+// are whole seconds, rounded up so a client that waits them out is not
+// denied again.
+func setHeaders(c *gin.Context, d Decision) {
+	c.Header("RateLimit-Limit", strconv.FormatInt(d.Limit, 10))
+	c.Header("RateLimit-Remaining", strconv.FormatInt(d.Remaining, 10))
+	c.Header("RateLimit-Reset", strconv.FormatInt(ceilSeconds(d.Reset), 10))
+	if !d.Allowed {
+		c.Header("Retry-After", strconv.FormatInt(ceilSeconds(d.RetryAfter), 10))
+	}
+}
+
+func ceilSeconds(d time.Duration) int64 {
+	return int64((d + time.Second - 1) / time.Second)
+}
+
+// Identify returns the identity a request is limited as. A listed API key
+// gives "api_key:abc" or "tenant:acme", whichever of RATE_LIMIT_IDENTITY
+// comes first and applies, narrowed to "tenant:acme:service:checkout" when
+// X-Service-Name names a service overridden under it. Anything else,
+// unknown keys included, is limited by client IP ("ip:10.0.0.7"), and an
+// unlisted service shares its key's bucket, so no header buys a fresh one.
+func (rl *RateLimiter) Identify(c *gin.Context) string {
+	key := strings.TrimSpace(c.GetHeader(HeaderAPIKey))
+	if tenant, ok := rl.apiKeys[key]; ok && key != "" {
+		for _, source := range rl.identity {
+			switch {
+			case source == IdentityAPIKey:
+				return rl.scope(c, IdentityAPIKey+":"+key)
+			case source == IdentityTenant && tenant != "":
+				return rl.scope(c, IdentityTenant+":"+tenant)
+			}
+		}
+	}
+	return "ip:" + c.ClientIP()
+}
+
+// scope narrows owner to the request's service if an override names that
+// service under owner
+func (rl *RateLimiter) scope(c *gin.Context, owner string) string {
+	service := strings.TrimSpace(c.GetHeader(HeaderService))
+	if service == "" {
+		return owner
+	}
+	if _, ok := rl.overrides[owner+serviceScope+service]; ok {
+		return owner + serviceScope + service
+	}
+	return owner
+}
+
+// bucket returns the Redis key and limit for identity. API keys are
+// hashed, so they are not readable from Redis.
+func (rl *RateLimiter) bucket(identity string) (string, config.RateLimitTier) {
+	limit, ok := rl.overrides[identity]
+	if !ok {
+		limit = rl.limit
+	}
+	if key, isAPIKey := strings.CutPrefix(identity, "api_key:"); isAPIKey {
+		key, service, scoped := strings.Cut(key, serviceScope)
+		sum := sha256.Sum256([]byte(key))
+		identity = "api_key:" + hex.EncodeToString(sum[:8])
+		if scoped {
+			identity += serviceScope + service
+		}
 	}
-	return result == 1, nil
+	return rl.keyPrefix + identity, limit
 }
 
 // Middleware returns a Gin middleware that applies rate limiting
@@ -100,23 +386,65 @@ func (rl *RateLimiter) Middleware() gin.HandlerFunc {
 			return
 		}
 
-		// Use client IP as the rate limit key
-		key := "ratelimit:" + c.ClientIP()
+		// A chunked body has no size to charge up front, and would
+		// otherwise pay the route cost only however large it is
+		if rl.bytesPerToken > 0 && c.Request.ContentLength < 0 {
+			metrics.RateLimitDecisions.WithLabelValues("length_required").Inc()
+			c.AbortWithStatusJSON(http.StatusLengthRequired, gin.H{
+				"error": "Content-Length is required: request bodies are rate limited by size",
+			})
+			return
+		}
+
+		key, limit := rl.bucket(rl.Identify(c))
+		cost := rl.Cost(c)
 
-		allowed, err := rl.Allow(c.Request.Context(), key)
+		d, err := rl.take(c.Request.Context(), key, limit, cost)
+		if errors.Is(err, ErrCostExceedsCapacity) {
+			// Retrying would never succeed, so this is not a 429 and has no
+			// Retry-After; the limit tells the client how small to go
+			metrics.RateLimitDecisions.WithLabelValues("too_large").Inc()
+			c.Header("RateLimit-Limit", strconv.FormatInt(limit.Capacity, 10))
+			c.AbortWithStatusJSON(http.StatusRequestEntityTooLarge, gin.H{
+				"error":    "Request exceeds the rate limit capacity. Send smaller requests.",
+				"cost":     cost,
+				"capacity": limit.Capacity,
+			})
+			return
+		}
+		if err != nil && rl.policy == FailClosed {
+			// Redis is tried again once the breaker lets a probe through
+			retryAfter := ceilSeconds(max(rl.breaker.RetryAfter(), time.Second))
+			metrics.RateLimitDecisions.WithLabelValues("unavailable").Inc()
+			c.Header("Retry-After", strconv.FormatInt(retryAfter, 10))
+			c.AbortWithStatusJSON(http.StatusServiceUnavailable, gin.H{
+				"error":               "Rate limiter unavailable, retry later",
+				"retry_after_seconds": retryAfter,
+			})
+			return
+		}
 		if err != nil {
-			// On Redis error, fail open (allow request) but log the error
+			// Fail open: allow the request (take logged the outage)
+			metrics.RateLimitDecisions.WithLabelValues("error").Inc()
 			c.Next()
 			return
 		}
 
-		if !allowed {
+		prefix := ""
+		if d.Local {
+			prefix = "local_"
+		}
+		setHeaders(c, d)
+		if !d.Allowed {
+			metrics.RateLimitDecisions.WithLabelValues(prefix + "deny").Inc()
 			c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{
-				"error": "Rate limit exceeded. Try again later.",
+				"error":               "Rate limit exceeded. Try again later.",
+				"retry_after_seconds": ceilSeconds(d.RetryAfter),
 			})
 			return
 		}
 
+		metrics.RateLimitDecisions.WithLabelValues(prefix + "allow").Inc()
 		c.Next()
 	}
 }
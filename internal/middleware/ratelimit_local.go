@@ -0,0 +1,90 @@
+package middleware
+
+import (
+	"math"
+	"sync"
+	"time"
+
+	"github.com/Yupoer/logpulse/internal/config"
+)
+
+// localSweepInterval is how often full buckets are dropped from memory
+const localSweepInterval = time.Minute
+
+// localLimiter is the token bucket of tokenBucketScript kept in process
+// memory. It stands in for Redis while Redis is unreachable, with every
+// limit divided by the replica count so the replicas together admit about
+// what the shared bucket would.
+type localLimiter struct {
+	replicas int
+
+	mu        sync.Mutex
+	buckets   map[string]*localBucket
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+type localBucket struct {
+	tokens   float64
+	last     time.Time
+	capacity float64
+	rate     float64
+}
+
+func newLocalLimiter(replicas int) *localLimiter {
+	return &localLimiter{
+		replicas: max(replicas, 1),
+		buckets:  map[string]*localBucket{},
+		now:      time.Now,
+	}
+}
+
+// take consumes cost tokens from key's local bucket. A request costing
+// more than the local share of the capacity takes a full bucket instead,
+// so it is slowed down rather than never admitted.
+func (l *localLimiter) take(key string, limit config.RateLimitTier, cost int64) Decision {
+	capacity := float64(limit.Capacity) / float64(l.replicas)
+	rate := limit.Rate / float64(l.replicas)
+	requested := math.Min(float64(cost), capacity)
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	if now.Sub(l.lastSweep) >= localSweepInterval {
+		l.sweep(now)
+	}
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &localBucket{tokens: capacity, last: now}
+		l.buckets[key] = b
+	}
+	b.capacity, b.rate = capacity, rate
+	b.tokens = math.Min(capacity, b.tokens+now.Sub(b.last).Seconds()*rate)
+	b.last = now
+
+	d := Decision{Limit: int64(capacity)}
+	if b.tokens >= requested {
+		b.tokens -= requested
+		d.Allowed = true
+	} else {
+		d.RetryAfter = secondsToDuration((requested - b.tokens) / rate)
+	}
+	d.Remaining = int64(b.tokens)
+	d.Reset = secondsToDuration((capacity - b.tokens) / rate)
+	return d
+}
+
+// sweep drops buckets that have refilled; a missing bucket reads as full
+func (l *localLimiter) sweep(now time.Time) {
+	for key, b := range l.buckets {
+		if b.tokens+now.Sub(b.last).Seconds()*b.rate >= b.capacity {
+			delete(l.buckets, key)
+		}
+	}
+	l.lastSweep = now
+}
+
+func secondsToDuration(s float64) time.Duration {
+	return time.Duration(math.Ceil(s * float64(time.Second)))
+}
@@ -0,0 +1,160 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Yupoer/logpulse/internal/config"
+	"github.com/Yupoer/logpulse/internal/metrics"
+	"github.com/Yupoer/logpulse/internal/resilience"
+)
+
+func newFailoverLimiter(t *testing.T, policy string, breaker *resilience.Breaker) (*gin.Engine, *miniredis.Miniredis) {
+	t.Helper()
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr(), MaxRetries: -1, DialerRetries: 1})
+	t.Cleanup(func() { _ = client.Close() })
+	rl, err := NewRateLimiter(client, config.RateLimitConfig{
+		Enabled:       true,
+		Capacity:      4,
+		Rate:          0.002,
+		FailurePolicy: policy,
+		Replicas:      2,
+	}, breaker)
+	require.NoError(t, err)
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(rl.Middleware())
+	r.GET("/ping", func(c *gin.Context) { c.Status(http.StatusOK) })
+	return r, mr
+}
+
+func ping(r *gin.Engine) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/ping", nil))
+	return w
+}
+
+func TestRateLimiter_LocalFallback(t *testing.T) {
+	r, mr := newFailoverLimiter(t, FailLocal, nil)
+	mr.Close()
+	denied := testutil.ToFloat64(metrics.RateLimitDecisions.WithLabelValues("local_deny"))
+
+	// Capacity 4 split across 2 replicas
+	codes := []int{ping(r).Code, ping(r).Code}
+	w := ping(r)
+
+	assert.Equal(t, []int{200, 200}, codes)
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, "2", w.Header().Get("RateLimit-Limit"))
+	retryAfter, err := strconv.Atoi(w.Header().Get("Retry-After"))
+	require.NoError(t, err)
+	assert.InDelta(t, 1000, retryAfter, 1, "1 token at 0.001/s per replica")
+	assert.Equal(t, denied+1, testutil.ToFloat64(metrics.RateLimitDecisions.WithLabelValues("local_deny")))
+}
+
+func TestRateLimiter_SwitchesBackWhenRedisRecovers(t *testing.T) {
+	breaker := resilience.NewBreaker("ratelimit", 1, 20*time.Millisecond)
+	r, mr := newFailoverLimiter(t, FailLocal, breaker)
+	addr := mr.Addr()
+
+	mr.Close()
+	assert.Equal(t, http.StatusOK, ping(r).Code)
+	assert.Equal(t, resilience.StateOpen, breaker.State())
+	assert.Equal(t, "2", ping(r).Header().Get("RateLimit-Limit"), "local bucket while open")
+
+	require.NoError(t, mr.StartAddr(addr))
+	time.Sleep(30 * time.Millisecond) // Past the open timeout, the next call probes Redis
+
+	w := ping(r)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "4", w.Header().Get("RateLimit-Limit"), "shared bucket again")
+	assert.Equal(t, resilience.StateClosed, breaker.State())
+}
+
+func TestRateLimiter_FailurePolicies(t *testing.T) {
+	t.Run("Open", func(t *testing.T) {
+		r, mr := newFailoverLimiter(t, FailOpen, nil)
+		mr.Close()
+
+		for i := 0; i < 5; i++ {
+			w := ping(r)
+			assert.Equal(t, http.StatusOK, w.Code)
+			assert.Empty(t, w.Header().Get("RateLimit-Limit"))
+		}
+	})
+
+	t.Run("Closed", func(t *testing.T) {
+		r, mr := newFailoverLimiter(t, FailClosed, nil)
+		mr.Close()
+
+		w := ping(r)
+		assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+		assert.Equal(t, "1", w.Header().Get("Retry-After"))
+		assert.JSONEq(t, `{"error":"Rate limiter unavailable, retry later","retry_after_seconds":1}`, w.Body.String())
+	})
+
+	t.Run("ClosedWhileBreakerOpen", func(t *testing.T) {
+		r, mr := newFailoverLimiter(t, FailClosed, resilience.NewBreaker("ratelimit", 1, 30*time.Second))
+		mr.Close()
+
+		ping(r) // Opens the breaker
+		w := ping(r)
+		assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+		assert.Equal(t, "30", w.Header().Get("Retry-After"))
+	})
+
+	t.Run("Unknown", func(t *testing.T) {
+		_, err := NewRateLimiter(nil, config.RateLimitConfig{FailurePolicy: "maybe"}, nil)
+		assert.ErrorContains(t, err, `unknown rate limit failure policy "maybe"`)
+	})
+}
+
+func TestLocalLimiter_RefillsAndSweeps(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	l := newLocalLimiter(4)
+	l.now = func() time.Time { return now }
+	limit := config.RateLimitTier{Capacity: 8, Rate: 4} // 2 tokens at 1/s per replica
+
+	assert.True(t, l.take("a", limit, 1).Allowed)
+	assert.True(t, l.take("a", limit, 1).Allowed)
+	d := l.take("a", limit, 1)
+	assert.False(t, d.Allowed)
+	assert.Equal(t, time.Second, d.RetryAfter)
+
+	now = now.Add(time.Second)
+	assert.True(t, l.take("a", limit, 1).Allowed)
+
+	// Costlier than the local share: takes a full bucket rather than failing forever
+	assert.True(t, l.take("b", limit, 5).Allowed)
+	assert.False(t, l.take("b", limit, 1).Allowed)
+
+	now = now.Add(localSweepInterval)
+	l.take("c", limit, 1)
+	assert.Len(t, l.buckets, 1, "refilled buckets dropped")
+}
+
+func TestRateLimiter_AllowNLocal(t *testing.T) {
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr(), MaxRetries: -1, DialerRetries: 1})
+	t.Cleanup(func() { _ = client.Close() })
+	rl, err := NewRateLimiter(client, config.RateLimitConfig{Enabled: true, Capacity: 2, Rate: 1, FailurePolicy: FailLocal}, nil)
+	require.NoError(t, err)
+	mr.Close()
+
+	allowed, err := rl.Allow(context.Background(), "ratelimit:any")
+	require.NoError(t, err)
+	assert.True(t, allowed)
+}
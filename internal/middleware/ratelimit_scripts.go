@@ -0,0 +1,110 @@
+package middleware
+
+// The scripts below are drop-in alternatives to tokenBucketScript: same
+// KEYS and ARGV, same reply, so RateLimiter only picks which one to run.
+// "capacity" is the largest burst and "rate" the sustained requests per
+// second in all of them.
+
+// GCRA (generic cell rate algorithm) Lua Script
+// Stores one number per key, the theoretical arrival time (TAT): when the
+// client would have caught up had it sent at exactly rate. A request is
+// allowed if the TAT, pushed back by its cost, stays within capacity
+// intervals of now. Same limits as the token bucket, but spent tokens
+// come back one interval at a time rather than continuously.
+const gcraScript = `
+-- KEYS[1] = rate limit key (e.g., "ratelimit:gcra:ip:192.168.1.1")
+-- ARGV[1] = capacity (burst size)
+-- ARGV[2] = rate (requests per second)
+-- ARGV[3] = now (current timestamp in milliseconds)
+-- ARGV[4] = requested (the request's cost, at most capacity)
+
+local key = KEYS[1]
+local capacity = tonumber(ARGV[1])
+local rate = tonumber(ARGV[2])
+local now = tonumber(ARGV[3])
+local requested = tonumber(ARGV[4])
+local eps = 1e-6  -- Float noise from the division below
+
+local interval = 1000 / rate            -- ms per request
+local tolerance = capacity * interval   -- How far the TAT may run ahead of now
+
+local tat = math.max(tonumber(redis.call("GET", key)) or now, now)
+local new_tat = tat + requested * interval
+local allow_at = new_tat - tolerance
+
+if allow_at - now > eps then
+    return {0, math.floor((tolerance - (tat - now)) / interval + eps), math.ceil(tat - now), math.ceil(allow_at - now)}
+end
+
+redis.call("SET", key, new_tat, "PX", math.max(math.ceil(new_tat - now), 1))  -- Expires once caught up
+return {1, math.floor((tolerance - (new_tat - now)) / interval + eps), math.ceil(new_tat - now), 0}
+`
+
+// Sliding Window Counter Lua Script
+// Counts requests in fixed windows of capacity/rate seconds and weighs the
+// previous window by how much of it still overlaps the sliding window that
+// ends now. No burst at a window edge can exceed capacity, unlike a fixed
+// window, while storing two counters instead of a log of timestamps.
+const slidingWindowScript = `
+-- KEYS[1] = rate limit key (e.g., "ratelimit:sw:ip:192.168.1.1")
+-- ARGV[1] = capacity (requests per window)
+-- ARGV[2] = rate (requests per second; the window is capacity / rate seconds)
+-- ARGV[3] = now (current timestamp in milliseconds)
+-- ARGV[4] = requested (the request's cost, at most capacity)
+
+local key = KEYS[1]
+local capacity = tonumber(ARGV[1])
+local rate = tonumber(ARGV[2])
+local now = tonumber(ARGV[3])
+local requested = tonumber(ARGV[4])
+local eps = 1e-6
+
+local window = capacity * 1000 / rate  -- ms
+local idx = math.floor(now / window)
+
+local data = redis.call("HMGET", key, "window", "current", "previous")
+local stored = tonumber(data[1])
+local current = tonumber(data[2]) or 0
+local previous = tonumber(data[3]) or 0
+if stored == idx - 1 then
+    previous = current
+    current = 0
+elseif stored ~= idx then
+    previous = 0
+    current = 0
+end
+
+local start = idx * window
+local used = previous * (1 - (now - start) / window) + current
+
+local allowed = 0
+local retry_ms = 0
+if used + requested <= capacity + eps then
+    allowed = 1
+    current = current + requested
+    used = used + requested
+    redis.call("HMSET", key, "window", idx, "current", current, "previous", previous)
+    redis.call("PEXPIRE", key, math.ceil(2 * window))  -- current counts until the end of the next window
+elseif current + requested <= capacity then
+    -- Wait for the previous window's share to slide out far enough
+    local e = window * (1 - (capacity - current - requested) / previous)
+    retry_ms = math.ceil(start + e - now)
+else
+    -- Wait until the next window, where this one's count is the previous
+    local e = 0
+    if current > 0 then
+        e = math.max(0, window * (1 - (capacity - requested) / current))
+    end
+    retry_ms = math.ceil(start + window + e - now)
+end
+
+-- Until nothing counts any more
+local reset_ms = 0
+if current > 0 then
+    reset_ms = math.ceil(start + 2 * window - now)
+elseif previous > 0 then
+    reset_ms = math.ceil(start + window - now)
+end
+
+return {allowed, math.max(0, math.floor(capacity - used + eps)), reset_ms, retry_ms}
+`
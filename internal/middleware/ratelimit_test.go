@@ -2,48 +2,168 @@ package middleware
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/Yupoer/logpulse/internal/config"
 	"github.com/alicebob/miniredis/v2"
+	"github.com/gin-gonic/gin"
 	"github.com/redis/go-redis/v9"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
-func TestRateLimiter_Allow(t *testing.T) {
-	// Setup miniredis (in-memory Redis for testing)
-	mr, err := miniredis.Run()
-	if err != nil {
-		t.Fatal(err)
-	}
-	defer mr.Close()
+// algorithmSuite holds the checks every rate limit algorithm must pass.
+// Each runs on a fresh miniredis with capacity 5 at 10 requests/sec and a
+// clock the test moves by hand.
+var algorithmSuite = []struct {
+	name string
+	run  func(t *testing.T, rl *RateLimiter, clock *time.Time, mr *miniredis.Miniredis)
+}{
+	{"AllowsBurstThenDenies", func(t *testing.T, rl *RateLimiter, _ *time.Time, _ *miniredis.Miniredis) {
+		ctx := context.Background()
+		key := "ratelimit:test-ip"
 
-	client := redis.NewClient(&redis.Options{
-		Addr: mr.Addr(),
-	})
-	defer client.Close()
-
-	cfg := config.RateLimitConfig{
-		Enabled:  true,
-		Capacity: 5,  // Allow 5 burst requests
-		Rate:     10, // 10 tokens/sec refill
-	}
-
-	rl := NewRateLimiter(client, cfg)
-	ctx := context.Background()
-	key := "ratelimit:test-ip"
+		// Test: First 5 requests should be allowed (burst)
+		for i := 0; i < 5; i++ {
+			allowed, err := rl.Allow(ctx, key)
+			assert.NoError(t, err)
+			assert.True(t, allowed, "Request %d should be allowed", i+1)
+		}
 
-	// Test: First 5 requests should be allowed (burst)
-	for i := 0; i < 5; i++ {
+		// Test: 6th request should be denied (bucket empty)
 		allowed, err := rl.Allow(ctx, key)
 		assert.NoError(t, err)
-		assert.True(t, allowed, "Request %d should be allowed", i+1)
-	}
+		assert.False(t, allowed, "6th request should be denied")
+	}},
+	{"KeysAreIndependent", func(t *testing.T, rl *RateLimiter, _ *time.Time, _ *miniredis.Miniredis) {
+		ctx := context.Background()
+		for i := 0; i < 5; i++ {
+			_, err := rl.Allow(ctx, "ratelimit:a")
+			require.NoError(t, err)
+		}
+
+		allowed, err := rl.Allow(ctx, "ratelimit:b")
+		require.NoError(t, err)
+		assert.True(t, allowed)
+	}},
+	{"ReportsRemaining", func(t *testing.T, rl *RateLimiter, _ *time.Time, _ *miniredis.Miniredis) {
+		for want := int64(4); want >= 0; want-- {
+			d, err := rl.take(context.Background(), "ratelimit:r", rl.limit, 1)
+			require.NoError(t, err)
+			assert.True(t, d.Allowed)
+			assert.Equal(t, int64(5), d.Limit)
+			assert.Equal(t, want, d.Remaining)
+		}
+	}},
+	{"AllowedAfterRetryAfter", func(t *testing.T, rl *RateLimiter, clock *time.Time, _ *miniredis.Miniredis) {
+		ctx := context.Background()
+		for i := 0; i < 5; i++ {
+			_, err := rl.take(ctx, "ratelimit:r", rl.limit, 1)
+			require.NoError(t, err)
+		}
+		d, err := rl.take(ctx, "ratelimit:r", rl.limit, 1)
+		require.NoError(t, err)
+		require.False(t, d.Allowed)
+		require.Positive(t, d.RetryAfter)
+
+		*clock = clock.Add(d.RetryAfter - 2*time.Millisecond)
+		d2, err := rl.take(ctx, "ratelimit:r", rl.limit, 1)
+		require.NoError(t, err)
+		assert.False(t, d2.Allowed, "still denied just before Retry-After")
+
+		*clock = clock.Add(2 * time.Millisecond)
+		d2, err = rl.take(ctx, "ratelimit:r", rl.limit, 1)
+		require.NoError(t, err)
+		assert.True(t, d2.Allowed, "allowed once Retry-After has passed")
+	}},
+	{"FullCapacityAfterReset", func(t *testing.T, rl *RateLimiter, clock *time.Time, _ *miniredis.Miniredis) {
+		ctx := context.Background()
+		var d Decision
+		for i := 0; i < 5; i++ {
+			var err error
+			d, err = rl.take(ctx, "ratelimit:r", rl.limit, 1)
+			require.NoError(t, err)
+		}
+
+		*clock = clock.Add(d.Reset)
+		for i := 0; i < 5; i++ {
+			allowed, err := rl.Allow(ctx, "ratelimit:r")
+			require.NoError(t, err)
+			assert.True(t, allowed, "Request %d after reset", i+1)
+		}
+	}},
+	{"SustainedRate", func(t *testing.T, rl *RateLimiter, clock *time.Time, _ *miniredis.Miniredis) {
+		// Hammer for 10s: at most the burst plus 10s at 10/s gets through.
+		// The sliding window counter, which weighs the previous window
+		// linearly, settles at 4 of 5 per window under constant pressure.
+		allowed := 0
+		for i := 0; i < 1000; i++ {
+			ok, err := rl.Allow(context.Background(), "ratelimit:r")
+			require.NoError(t, err)
+			if ok {
+				allowed++
+			}
+			*clock = clock.Add(10 * time.Millisecond)
+		}
+		assert.GreaterOrEqual(t, allowed, 80)
+		assert.LessOrEqual(t, allowed, 105)
+	}},
+	{"WeightedCost", func(t *testing.T, rl *RateLimiter, _ *time.Time, _ *miniredis.Miniredis) {
+		ctx := context.Background()
+		allowed, err := rl.AllowN(ctx, "ratelimit:n", 3)
+		require.NoError(t, err)
+		assert.True(t, allowed)
+		allowed, err = rl.AllowN(ctx, "ratelimit:n", 3)
+		require.NoError(t, err)
+		assert.False(t, allowed, "only 2 left")
+		allowed, err = rl.AllowN(ctx, "ratelimit:n", 2)
+		require.NoError(t, err)
+		assert.True(t, allowed)
+
+		_, err = rl.AllowN(ctx, "ratelimit:n", 6)
+		assert.ErrorIs(t, err, ErrCostExceedsCapacity)
+	}},
+	{"KeyExpires", func(t *testing.T, rl *RateLimiter, _ *time.Time, mr *miniredis.Miniredis) {
+		_, err := rl.Allow(context.Background(), "ratelimit:r")
+		require.NoError(t, err)
+
+		ttl := mr.TTL("ratelimit:r")
+		assert.Positive(t, ttl)
+		assert.LessOrEqual(t, ttl, time.Second, "no longer than a full refill (twice the window for sliding_window)")
+	}},
+}
+
+func TestRateLimiter_Algorithms(t *testing.T) {
+	for _, algorithm := range []string{AlgorithmTokenBucket, AlgorithmGCRA, AlgorithmSlidingWindow} {
+		t.Run(algorithm, func(t *testing.T) {
+			for _, tc := range algorithmSuite {
+				t.Run(tc.name, func(t *testing.T) {
+					// Setup miniredis (in-memory Redis for testing)
+					mr := miniredis.RunT(t)
+					client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+					t.Cleanup(func() { _ = client.Close() })
+
+					rl, err := NewRateLimiter(client, config.RateLimitConfig{
+						Enabled:   true,
+						Algorithm: algorithm,
+						Capacity:  5,  // Allow 5 burst requests
+						Rate:      10, // 10 requests/sec sustained
+					}, nil)
+					require.NoError(t, err)
+					clock := time.UnixMilli(1_700_000_000_000)
+					rl.now = func() time.Time { return clock }
 
-	// Test: 6th request should be denied (bucket empty)
-	allowed, err := rl.Allow(ctx, key)
-	assert.NoError(t, err)
-	assert.False(t, allowed, "6th request should be denied")
+					tc.run(t, rl, &clock, mr)
+				})
+			}
+		})
+	}
 }
 
 func TestRateLimiter_Disabled(t *testing.T) {
@@ -64,7 +184,8 @@ func TestRateLimiter_Disabled(t *testing.T) {
 		Rate:     1,
 	}
 
-	rl := NewRateLimiter(client, cfg)
+	rl, err := NewRateLimiter(client, cfg, nil)
+	require.NoError(t, err)
 	ctx := context.Background()
 
 	// When disabled, all requests should be allowed
@@ -74,3 +195,373 @@ func TestRateLimiter_Disabled(t *testing.T) {
 		assert.True(t, allowed)
 	}
 }
+
+func TestSlidingWindow_NoDoubleBurstAtWindowEdge(t *testing.T) {
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { _ = client.Close() })
+	rl, err := NewRateLimiter(client, config.RateLimitConfig{
+		Enabled: true, Algorithm: AlgorithmSlidingWindow, Capacity: 5, Rate: 10, // 500ms windows
+	}, nil)
+	require.NoError(t, err)
+	clock := time.UnixMilli(1_700_000_000_450) // 50ms before a window ends
+	rl.now = func() time.Time { return clock }
+	ctx := context.Background()
+
+	for i := 0; i < 5; i++ {
+		allowed, err := rl.Allow(ctx, "ratelimit:edge")
+		require.NoError(t, err)
+		require.True(t, allowed)
+	}
+
+	// 100ms later, in the next window: a fixed window would allow 5 more
+	clock = clock.Add(100 * time.Millisecond)
+	allowed := 0
+	for i := 0; i < 5; i++ {
+		ok, err := rl.Allow(ctx, "ratelimit:edge")
+		require.NoError(t, err)
+		if ok {
+			allowed++
+		}
+	}
+	assert.Equal(t, 0, allowed, "the previous window still counts 90%")
+}
+
+func TestNewRateLimiter_RejectsUnknownAlgorithm(t *testing.T) {
+	_, err := NewRateLimiter(nil, config.RateLimitConfig{Algorithm: "leaky"}, nil)
+	assert.ErrorContains(t, err, `unknown rate limit algorithm "leaky"`)
+}
+
+// serveLimited sends n GET /ping requests with headers through rl and
+// returns their status codes
+func serveLimited(rl *RateLimiter, n int, remoteAddr string, headers map[string]string) []int {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(rl.Middleware())
+	r.GET("/ping", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	codes := make([]int, n)
+	for i := range codes {
+		req := httptest.NewRequest(http.MethodGet, "/ping", nil)
+		req.RemoteAddr = remoteAddr
+		for k, v := range headers {
+			req.Header.Set(k, v)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		codes[i] = w.Code
+	}
+	return codes
+}
+
+func newTieredLimiter(t *testing.T) (*RateLimiter, *miniredis.Miniredis) {
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { _ = client.Close() })
+
+	rl, err := NewRateLimiter(client, config.RateLimitConfig{
+		Enabled:  true,
+		Capacity: 2,
+		Rate:     0.001,
+		APIKeys: map[string]string{
+			"key-a": "", "key-b": "", "pro-key": "", "s3cr3t-key": "",
+			"acme-1": "acme", "acme-2": "acme",
+		},
+		Identity: []string{"tenant", "api_key"},
+		Tiers:    map[string]config.RateLimitTier{"pro": {Capacity: 5, Rate: 0.001}},
+		Overrides: map[string]string{
+			"api_key:pro-key":               "pro",
+			"tenant:acme":                   "pro",
+			"tenant:acme:service:checkout":  "pro",
+			"api_key:key-a:service:billing": "pro",
+		},
+	}, nil)
+	require.NoError(t, err)
+	return rl, mr
+}
+
+func TestRateLimiter_BucketPerIdentity(t *testing.T) {
+	rl, _ := newTieredLimiter(t)
+
+	// Same IP, different keys: each gets its own bucket
+	a := serveLimited(rl, 3, "10.0.0.1:1234", map[string]string{HeaderAPIKey: "key-a"})
+	b := serveLimited(rl, 3, "10.0.0.1:1234", map[string]string{HeaderAPIKey: "key-b"})
+
+	assert.Equal(t, []int{200, 200, 429}, a)
+	assert.Equal(t, []int{200, 200, 429}, b)
+}
+
+func TestRateLimiter_OverrideTier(t *testing.T) {
+	rl, _ := newTieredLimiter(t)
+
+	key := serveLimited(rl, 6, "10.0.0.1:1234", map[string]string{HeaderAPIKey: "pro-key"})
+	assert.Equal(t, []int{200, 200, 200, 200, 200, 429}, key)
+
+	// The tenant's keys share its bucket
+	tenant := append(
+		serveLimited(rl, 3, "10.0.0.2:1234", map[string]string{HeaderAPIKey: "acme-1"}),
+		serveLimited(rl, 3, "10.0.0.3:1234", map[string]string{HeaderAPIKey: "acme-2"})...,
+	)
+	assert.Equal(t, []int{200, 200, 200, 200, 200, 429}, tenant)
+}
+
+func TestRateLimiter_IdentityOrderAndIPFallback(t *testing.T) {
+	rl, _ := newTieredLimiter(t)
+	identify := func(remoteAddr string, headers map[string]string) string {
+		c, _ := gin.CreateTestContext(httptest.NewRecorder())
+		c.Request = httptest.NewRequest(http.MethodGet, "/ping", nil)
+		c.Request.RemoteAddr = remoteAddr
+		for k, v := range headers {
+			c.Request.Header.Set(k, v)
+		}
+		return rl.Identify(c)
+	}
+
+	assert.Equal(t, "tenant:acme", identify("10.0.0.1:1234", map[string]string{HeaderAPIKey: "acme-1"}))
+	// A key without a tenant falls through to the next identity
+	assert.Equal(t, "api_key:key-a", identify("10.0.0.1:1234", map[string]string{HeaderAPIKey: "key-a"}))
+	assert.Equal(t, "ip:10.0.0.1", identify("10.0.0.1:1234", nil))
+
+	// Unknown keys and client-chosen headers don't buy a bucket of their own
+	assert.Equal(t, "ip:10.0.0.1", identify("10.0.0.1:1234", map[string]string{HeaderAPIKey: "made-up"}))
+	assert.Equal(t, "ip:10.0.0.1", identify("10.0.0.1:1234", map[string]string{"X-Tenant-ID": "acme", "X-Service-Name": "checkout"}))
+
+	// Anonymous clients behind one IP share its bucket, whatever key they invent
+	codes := append(
+		serveLimited(rl, 2, "10.0.0.9:1234", map[string]string{HeaderAPIKey: "random-1"}),
+		serveLimited(rl, 1, "10.0.0.9:1234", map[string]string{HeaderAPIKey: "random-2"})...,
+	)
+	assert.Equal(t, []int{200, 200, 429}, codes)
+}
+
+func TestRateLimiter_ServiceScopedUnderKey(t *testing.T) {
+	rl, mr := newTieredLimiter(t)
+	identify := func(headers map[string]string) string {
+		c, _ := gin.CreateTestContext(httptest.NewRecorder())
+		c.Request = httptest.NewRequest(http.MethodGet, "/ping", nil)
+		c.Request.RemoteAddr = "10.0.0.1:1234"
+		for k, v := range headers {
+			c.Request.Header.Set(k, v)
+		}
+		return rl.Identify(c)
+	}
+
+	// An overridden service gets its own bucket under the key or tenant
+	assert.Equal(t, "tenant:acme:service:checkout", identify(map[string]string{HeaderAPIKey: "acme-1", HeaderService: "checkout"}))
+	assert.Equal(t, "api_key:key-a:service:billing", identify(map[string]string{HeaderAPIKey: "key-a", HeaderService: "billing"}))
+
+	// Any other service shares its owner's bucket, and without a key the
+	// header means nothing
+	assert.Equal(t, "tenant:acme", identify(map[string]string{HeaderAPIKey: "acme-1", HeaderService: "made-up"}))
+	assert.Equal(t, "api_key:key-b", identify(map[string]string{HeaderAPIKey: "key-b", HeaderService: "billing"}))
+	assert.Equal(t, "ip:10.0.0.1", identify(map[string]string{HeaderService: "checkout"}))
+
+	// Renaming the service does not reset the owner's bucket
+	codes := append(
+		serveLimited(rl, 2, "10.0.0.1:1234", map[string]string{HeaderAPIKey: "key-b", HeaderService: "one"}),
+		serveLimited(rl, 1, "10.0.0.1:1234", map[string]string{HeaderAPIKey: "key-b", HeaderService: "two"})...,
+	)
+	assert.Equal(t, []int{200, 200, 429}, codes)
+
+	// The service bucket takes the override's tier and keeps the key hashed
+	billing := serveLimited(rl, 6, "10.0.0.1:1234", map[string]string{HeaderAPIKey: "key-a", HeaderService: "billing"})
+	assert.Equal(t, []int{200, 200, 200, 200, 200, 429}, billing)
+	assert.Contains(t, mr.Keys(), "ratelimit:api_key:"+hashedKey("key-a")+":service:billing")
+}
+
+func hashedKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:8])
+}
+
+func TestRateLimiter_ClientIPFromTrustedProxiesOnly(t *testing.T) {
+	rl, _ := newTieredLimiter(t)
+	identify := func(trusted []string, remoteAddr, forwardedFor string) string {
+		r := gin.New()
+		require.NoError(t, r.SetTrustedProxies(trusted))
+		var id string
+		r.GET("/ping", func(c *gin.Context) { id = rl.Identify(c) })
+		req := httptest.NewRequest(http.MethodGet, "/ping", nil)
+		req.RemoteAddr = remoteAddr
+		req.Header.Set("X-Forwarded-For", forwardedFor)
+		r.ServeHTTP(httptest.NewRecorder(), req)
+		return id
+	}
+
+	// Behind the trusted proxy, the client IP is the one it forwarded
+	assert.Equal(t, "ip:203.0.113.7", identify([]string{"172.28.0.10"}, "172.28.0.10:5000", "198.51.100.1, 203.0.113.7"))
+	// Anyone else's X-Forwarded-For is ignored
+	assert.Equal(t, "ip:203.0.113.9", identify([]string{"172.28.0.10"}, "203.0.113.9:5000", "198.51.100.1"))
+	assert.Equal(t, "ip:172.28.0.10", identify(nil, "172.28.0.10:5000", "198.51.100.1"))
+}
+
+func TestRateLimiter_HashesAPIKeys(t *testing.T) {
+	rl, mr := newTieredLimiter(t)
+
+	serveLimited(rl, 1, "10.0.0.1:1234", map[string]string{HeaderAPIKey: "s3cr3t-key"})
+
+	keys := mr.Keys()
+	require.Len(t, keys, 1)
+	assert.Regexp(t, `^ratelimit:api_key:[0-9a-f]{16}$`, keys[0])
+	assert.NotContains(t, keys[0], "s3cr3t")
+}
+
+func TestNewRateLimiter_RejectsUnknownTier(t *testing.T) {
+	_, err := NewRateLimiter(nil, config.RateLimitConfig{
+		Overrides: map[string]string{"api_key:abc": "gold"},
+	}, nil)
+	assert.ErrorContains(t, err, `unknown tier "gold"`)
+
+	_, err = NewRateLimiter(nil, config.RateLimitConfig{Identity: []string{"service"}}, nil)
+	assert.ErrorContains(t, err, `unknown rate limit identity "service"`)
+
+	_, err = NewRateLimiter(nil, config.RateLimitConfig{
+		Tiers:     map[string]config.RateLimitTier{"pro": {Capacity: 5, Rate: 1}},
+		Overrides: map[string]string{"api_key:abc": "pro"},
+	}, nil)
+	assert.ErrorContains(t, err, "not in RATE_LIMIT_API_KEYS")
+
+	_, err = NewRateLimiter(nil, config.RateLimitConfig{
+		Tiers:     map[string]config.RateLimitTier{"pro": {Capacity: 5, Rate: 1}},
+		Overrides: map[string]string{"service:checkout": "pro"},
+	}, nil)
+	assert.ErrorContains(t, err, `override for "service:checkout"`)
+
+	_, err = NewRateLimiter(nil, config.RateLimitConfig{
+		Tiers:     map[string]config.RateLimitTier{"pro": {Capacity: 5, Rate: 1}},
+		Overrides: map[string]string{"ip:10.0.0.1:service:checkout": "pro"},
+	}, nil)
+	assert.ErrorContains(t, err, "services are scoped to an api_key: or tenant: identity")
+}
+
+func TestRateLimiter_Headers(t *testing.T) {
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { _ = client.Close() })
+	rl, err := NewRateLimiter(client, config.RateLimitConfig{Enabled: true, Capacity: 2, Rate: 0.5}, nil)
+	require.NoError(t, err)
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(rl.Middleware())
+	r.GET("/ping", func(c *gin.Context) { c.Status(http.StatusOK) })
+	send := func() *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/ping", nil))
+		return w
+	}
+
+	w := send()
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "2", w.Header().Get("RateLimit-Limit"))
+	assert.Equal(t, "1", w.Header().Get("RateLimit-Remaining"))
+	assert.Equal(t, "2", w.Header().Get("RateLimit-Reset")) // 1 token at 0.5/s
+	assert.Empty(t, w.Header().Get("Retry-After"))
+
+	send()
+	w = send()
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, "0", w.Header().Get("RateLimit-Remaining"))
+	assert.Equal(t, "4", w.Header().Get("RateLimit-Reset"))
+	assert.Equal(t, "2", w.Header().Get("Retry-After"))
+	assert.JSONEq(t, `{"error":"Rate limit exceeded. Try again later.","retry_after_seconds":2}`, w.Body.String())
+}
+
+func TestRateLimiter_KeyExpiresOnceFull(t *testing.T) {
+	rl, mr := newTieredLimiter(t) // Capacity 2 at 0.001 tokens/s
+
+	serveLimited(rl, 1, "10.0.0.1:1234", nil)
+
+	// Refilling 1 token takes 1000s, well past a fixed 60s TTL
+	ttl := mr.TTL("ratelimit:ip:10.0.0.1")
+	assert.InDelta(t, 1000*time.Second, ttl, float64(time.Second))
+}
+
+func TestRateLimiter_WeightedCost(t *testing.T) {
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { _ = client.Close() })
+	rl, err := NewRateLimiter(client, config.RateLimitConfig{
+		Enabled:       true,
+		Capacity:      10,
+		Rate:          0.001,
+		RouteCosts:    map[string]int64{"GET /logs/search": 4, "GET /ping": 0},
+		BytesPerToken: 1000,
+	}, nil)
+	require.NoError(t, err)
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(rl.Middleware())
+	ok := func(c *gin.Context) { c.Status(http.StatusOK) }
+	r.GET("/ping", ok)
+	r.GET("/logs/search", ok)
+	r.POST("/logs", ok)
+	send := func(method, path string, bodyBytes int) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(method, path, strings.NewReader(strings.Repeat("x", bodyBytes))))
+		return w
+	}
+
+	w := send(http.MethodGet, "/ping", 0)
+	assert.Equal(t, "10", w.Header().Get("RateLimit-Remaining"), "free route")
+
+	w = send(http.MethodGet, "/logs/search", 0)
+	assert.Equal(t, "6", w.Header().Get("RateLimit-Remaining"))
+
+	w = send(http.MethodPost, "/logs", 2500) // 1 + 2 for the body
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "3", w.Header().Get("RateLimit-Remaining"))
+
+	w = send(http.MethodGet, "/logs/search", 0)
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, "1000", w.Header().Get("Retry-After"), "1 token short at 0.001/s")
+}
+
+func TestRateLimiter_RejectsChunkedBodiesWhileChargingBytes(t *testing.T) {
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { _ = client.Close() })
+	chunked := func(bytesPerToken int64) *httptest.ResponseRecorder {
+		rl, err := NewRateLimiter(client, config.RateLimitConfig{Enabled: true, Capacity: 5, Rate: 1, BytesPerToken: bytesPerToken}, nil)
+		require.NoError(t, err)
+		r := gin.New()
+		r.Use(rl.Middleware())
+		r.POST("/logs", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+		req := httptest.NewRequest(http.MethodPost, "/logs", strings.NewReader(strings.Repeat("x", 1<<20)))
+		req.ContentLength = -1 // As parsed from Transfer-Encoding: chunked
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	w := chunked(100)
+	assert.Equal(t, http.StatusLengthRequired, w.Code)
+	assert.Empty(t, mr.Keys(), "no tokens taken")
+
+	// Without a byte cost there is nothing to charge
+	assert.Equal(t, http.StatusOK, chunked(0).Code)
+}
+
+func TestRateLimiter_RejectsCostAboveCapacity(t *testing.T) {
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { _ = client.Close() })
+	rl, err := NewRateLimiter(client, config.RateLimitConfig{Enabled: true, Capacity: 5, Rate: 1, BytesPerToken: 100}, nil)
+	require.NoError(t, err)
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(rl.Middleware())
+	r.POST("/logs", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/logs", strings.NewReader(strings.Repeat("x", 1000))))
+
+	assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+	assert.JSONEq(t, `{"error":"Request exceeds the rate limit capacity. Send smaller requests.","cost":11,"capacity":5}`, w.Body.String())
+	assert.Equal(t, "5", w.Header().Get("RateLimit-Limit"))
+	assert.Empty(t, w.Header().Get("Retry-After"))
+	assert.Empty(t, mr.Keys(), "no tokens taken")
+}
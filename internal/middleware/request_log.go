@@ -0,0 +1,70 @@
+package middleware
+
+import (
+	"log/slog"
+	"time"
+
+	"github.com/Yupoer/logpulse/internal/logging"
+	"github.com/gin-gonic/gin"
+)
+
+// maxRequestIDLen bounds client-supplied request IDs, which end up in every
+// log line about the request
+const maxRequestIDLen = 128
+
+// RequestID takes the request ID from the X-Request-ID header, or generates
+// one, puts it in the request context and echoes it in the response
+func RequestID() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.GetHeader(logging.HeaderRequestID)
+		if !validRequestID(id) {
+			id = logging.NewRequestID()
+		}
+		c.Request = c.Request.WithContext(logging.WithRequestID(c.Request.Context(), id))
+		c.Header(logging.HeaderRequestID, id)
+		c.Next()
+	}
+}
+
+// validRequestID accepts non-empty printable ASCII, so a client can't break
+// up log lines or flood them
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLen {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] < 0x21 || id[i] > 0x7e {
+			return false
+		}
+	}
+	return true
+}
+
+// AccessLog writes one log line per request, replacing Gin's text logger.
+// Server errors are logged at error level, client errors at warn.
+func AccessLog() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		status := c.Writer.Status()
+		level := slog.LevelInfo
+		switch {
+		case status >= 500:
+			level = slog.LevelError
+		case status >= 400:
+			level = slog.LevelWarn
+		}
+		attrs := []slog.Attr{
+			slog.String("method", c.Request.Method),
+			slog.String("path", c.Request.URL.Path),
+			slog.Int("status", status),
+			slog.Duration("latency", time.Since(start)),
+			slog.String("client_ip", c.ClientIP()),
+		}
+		if len(c.Errors) > 0 {
+			attrs = append(attrs, slog.String("errors", c.Errors.String()))
+		}
+		slog.LogAttrs(c.Request.Context(), level, "Request handled", attrs...)
+	}
+}
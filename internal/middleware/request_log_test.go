@@ -0,0 +1,76 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/Yupoer/logpulse/internal/config"
+	"github.com/Yupoer/logpulse/internal/logging"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// captureLogs sends the default slog logger to a buffer for the rest of the test
+func captureLogs(t *testing.T) *bytes.Buffer {
+	var buf bytes.Buffer
+	h, err := logging.NewHandler(config.LogConfig{Level: "debug", Format: "json"}, &buf)
+	require.NoError(t, err)
+	prev := slog.Default()
+	slog.SetDefault(slog.New(h))
+	t.Cleanup(func() { slog.SetDefault(prev) })
+	return &buf
+}
+
+func newRequestLogRouter() *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(RequestID(), AccessLog())
+	r.GET("/logs/:id", func(c *gin.Context) {
+		slog.InfoContext(c.Request.Context(), "handler ran")
+		c.Status(http.StatusNotFound)
+	})
+	return r
+}
+
+func TestRequestID_PropagatesClientID(t *testing.T) {
+	logs := captureLogs(t)
+	r := newRequestLogRouter()
+
+	req := httptest.NewRequest(http.MethodGet, "/logs/1", nil)
+	req.Header.Set(logging.HeaderRequestID, "client-id-42")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, "client-id-42", w.Header().Get(logging.HeaderRequestID))
+	lines := strings.Split(strings.TrimSpace(logs.String()), "\n")
+	require.Len(t, lines, 2)
+	for _, line := range lines {
+		var record map[string]any
+		require.NoError(t, json.Unmarshal([]byte(line), &record))
+		assert.Equal(t, "client-id-42", record["request_id"])
+	}
+	assert.Contains(t, lines[1], `"level":"WARN"`) // 404
+	assert.Contains(t, lines[1], `"status":404`)
+}
+
+func TestRequestID_GeneratesInvalidOrMissingID(t *testing.T) {
+	captureLogs(t)
+	r := newRequestLogRouter()
+
+	for _, id := range []string{"", "line\nbreak", strings.Repeat("x", maxRequestIDLen+1)} {
+		req := httptest.NewRequest(http.MethodGet, "/logs/1", nil)
+		req.Header.Set(logging.HeaderRequestID, id)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		got := w.Header().Get(logging.HeaderRequestID)
+		assert.NotEmpty(t, got)
+		assert.NotEqual(t, id, got)
+	}
+}
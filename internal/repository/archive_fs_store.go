@@ -0,0 +1,67 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/Yupoer/logpulse/internal/domain"
+)
+
+type fsArchiveStore struct {
+	root string
+}
+
+// NewFSArchiveStore stores archive objects as files under root.
+// Keys use forward slashes and map to sub-directories.
+func NewFSArchiveStore(root string) (domain.ArchiveStore, error) {
+	if err := os.MkdirAll(root, 0o755); err != nil {
+		return nil, err
+	}
+	return &fsArchiveStore{root: root}, nil
+}
+
+func (s *fsArchiveStore) Put(ctx context.Context, key string, r io.Reader, size int64) error {
+	path := filepath.Join(s.root, filepath.FromSlash(key))
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+
+	// Write to a temp file and rename, so readers never see a partial object
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer func() { _ = os.Remove(tmp.Name()) }()
+
+	if _, err := io.Copy(tmp, r); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	// Archived objects are immutable
+	if err := os.Chmod(tmp.Name(), 0o444); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+func (s *fsArchiveStore) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	f, err := os.Open(filepath.Join(s.root, filepath.FromSlash(key)))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, domain.ErrArchiveObjectNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return f, nil
+}
@@ -0,0 +1,68 @@
+package repository
+
+import (
+	"context"
+	"io"
+	"strings"
+
+	"github.com/Yupoer/logpulse/internal/config"
+	"github.com/Yupoer/logpulse/internal/domain"
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+)
+
+type s3ArchiveStore struct {
+	client *minio.Client
+	bucket string
+}
+
+// NewS3ArchiveStore stores archive objects in an S3-compatible bucket
+// (AWS S3, MinIO, Ceph RGW, ...).
+func NewS3ArchiveStore(ctx context.Context, cfg config.ArchiveConfig) (domain.ArchiveStore, error) {
+	client, err := minio.New(cfg.S3Endpoint, &minio.Options{
+		Creds:  credentials.NewStaticV4(cfg.S3AccessKey, cfg.S3SecretKey, ""),
+		Secure: cfg.S3UseSSL,
+		Region: cfg.S3Region,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Fail Fast
+	exists, err := client.BucketExists(ctx, cfg.S3Bucket)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		if err := client.MakeBucket(ctx, cfg.S3Bucket, minio.MakeBucketOptions{Region: cfg.S3Region}); err != nil {
+			return nil, err
+		}
+	}
+
+	return &s3ArchiveStore{client: client, bucket: cfg.S3Bucket}, nil
+}
+
+func (s *s3ArchiveStore) Put(ctx context.Context, key string, r io.Reader, size int64) error {
+	_, err := s.client.PutObject(ctx, s.bucket, key, r, size, minio.PutObjectOptions{
+		ContentType: contentTypeForKey(key),
+	})
+	return err
+}
+
+func (s *s3ArchiveStore) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	// StatObject first: GetObject is lazy and only fails on the first Read
+	if _, err := s.client.StatObject(ctx, s.bucket, key, minio.StatObjectOptions{}); err != nil {
+		if minio.ToErrorResponse(err).Code == minio.NoSuchKey {
+			return nil, domain.ErrArchiveObjectNotFound
+		}
+		return nil, err
+	}
+	return s.client.GetObject(ctx, s.bucket, key, minio.GetObjectOptions{})
+}
+
+func contentTypeForKey(key string) string {
+	if strings.HasSuffix(key, ".json") {
+		return "application/json"
+	}
+	return "application/gzip"
+}
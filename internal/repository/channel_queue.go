@@ -0,0 +1,87 @@
+package repository
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	"github.com/Yupoer/logpulse/internal/domain"
+	"github.com/Yupoer/logpulse/internal/envelope"
+	"github.com/Yupoer/logpulse/internal/logging"
+	"github.com/Yupoer/logpulse/internal/tracing"
+)
+
+// ChannelQueue is a bounded in-process queue for single-process deployments
+// (role all) that run without Kafka or Redis Streams. Nothing is persisted:
+// logs still buffered when the process exits are lost.
+type ChannelQueue struct {
+	messages chan *queueMessage
+	encoder  envelope.Encoder
+	offset   atomic.Int64 // Sequence number, only used in log lines
+}
+
+func NewChannelQueue(size int, encoder envelope.Encoder) *ChannelQueue {
+	return &ChannelQueue{messages: make(chan *queueMessage, size), encoder: encoder}
+}
+
+// Producer returns a domain.LogProducer feeding the queue. SendLog blocks
+// while the queue is full, until ctx is done.
+func (q *ChannelQueue) Producer() domain.LogProducer {
+	return &channelProducer{queue: q}
+}
+
+type channelProducer struct {
+	queue *ChannelQueue
+}
+
+func (p *channelProducer) SendLog(ctx context.Context, entry *domain.LogEntry) error {
+	// Encoded like on the other backends, so the consumer sees the same bytes
+	bytes, err := p.queue.encoder.Encode(entry, time.Now())
+	if err != nil {
+		return err
+	}
+	span, carrier := startSendSpan(ctx, "channel", "channel")
+	msg := &queueMessage{
+		Topic:       "channel",
+		Offset:      p.queue.offset.Add(1) - 1,
+		Key:         []byte(entry.ServiceName),
+		Value:       bytes,
+		ContentType: p.queue.encoder.ContentType,
+		RequestID:   logging.RequestID(ctx),
+		Trace:       carrier,
+	}
+	select {
+	case p.queue.messages <- msg:
+		err = nil
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+	tracing.End(span, err)
+	return err
+}
+
+// Close is a no-op; the consumer stops with its context, not the producer
+func (p *channelProducer) Close() error { return nil }
+
+// ChannelConsumer drains a ChannelQueue. There is nothing to commit: a log
+// counts as delivered once it is taken off the channel.
+type ChannelConsumer struct {
+	*queueWorker
+
+	queue *ChannelQueue // Set by Subscribe, used by Run
+}
+
+func NewChannelConsumer(mysqlRepo domain.LogRepository, esRepo domain.LogSearchRepository, deadLetters domain.DeadLetterQueue, maxAttempts int, res ConsumerResilience) *ChannelConsumer {
+	return &ChannelConsumer{queueWorker: newQueueWorker(mysqlRepo, esRepo, deadLetters, maxAttempts, res)}
+}
+
+// Subscribe sets the queue Run drains
+func (c *ChannelConsumer) Subscribe(queue *ChannelQueue) *ChannelConsumer {
+	c.queue = queue
+	return c
+}
+
+// Run implements domain.LogConsumer
+func (c *ChannelConsumer) Run(ctx context.Context) {
+	c.consume(ctx, 0, c.queue.messages, func([]*queueMessage) error { return nil })
+}
@@ -0,0 +1,99 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/Yupoer/logpulse/internal/config"
+	"github.com/Yupoer/logpulse/internal/domain"
+	"github.com/glebarez/sqlite"
+	"gorm.io/driver/mysql"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+)
+
+const (
+	DriverMySQL    = "mysql"
+	DriverPostgres = "postgres"
+	DriverSQLite   = "sqlite"
+)
+
+// RelationalBackend bundles the GORM handle, LogRepository and schema
+// manager of the SQL backend selected by config.
+type RelationalBackend struct {
+	DB     *gorm.DB
+	Logs   domain.LogRepository
+	Schema SchemaManager
+}
+
+// NewRelationalBackend opens cfg.DBDriver and wires the matching repository.
+// Partitioning is used where the backend supports it; otherwise the table is
+// managed by AutoMigrate and retention falls back to deletes.
+func NewRelationalBackend(cfg *config.Config) (*RelationalBackend, error) {
+	switch cfg.DBDriver {
+	case DriverMySQL:
+		db, err := openGorm(mysql.Open(cfg.DBUrl))
+		if err != nil {
+			return nil, err
+		}
+		var schema SchemaManager = &autoMigrateSchema{db: db}
+		if cfg.Partition.Enabled {
+			schema = NewMySQLPartitionManager(db, cfg.Partition)
+		}
+		return &RelationalBackend{DB: db, Logs: NewLogRepository(db, DriverMySQL), Schema: schema}, nil
+
+	case DriverPostgres:
+		db, err := openGorm(postgres.Open(cfg.DBUrl))
+		if err != nil {
+			return nil, err
+		}
+		var schema SchemaManager = &autoMigrateSchema{db: db}
+		if cfg.Partition.Enabled {
+			schema = NewPostgresPartitionManager(db, cfg.Partition)
+		}
+		return &RelationalBackend{DB: db, Logs: NewLogRepository(db, DriverPostgres), Schema: schema}, nil
+
+	case DriverSQLite:
+		db, err := openGorm(sqlite.Open(cfg.DBUrl))
+		if err != nil {
+			return nil, err
+		}
+		// SQLite allows a single writer; WAL keeps readers from blocking on it
+		if err := db.Exec("PRAGMA journal_mode=WAL").Error; err != nil {
+			return nil, err
+		}
+		schema := &autoMigrateSchema{db: db}
+		if cfg.Partition.Enabled {
+			schema.retentionDays = cfg.Partition.RetentionDays
+		}
+		return &RelationalBackend{DB: db, Logs: NewLogRepository(db, DriverSQLite), Schema: schema}, nil
+
+	default:
+		return nil, fmt.Errorf("unsupported DB_DRIVER %q", cfg.DBDriver)
+	}
+}
+
+// autoMigrateSchema manages log_entries through GORM's AutoMigrate, for
+// backends (or configs) without partitioning. Expired rows are deleted
+// when retentionDays is set.
+type autoMigrateSchema struct {
+	db            *gorm.DB
+	retentionDays int
+}
+
+func (s *autoMigrateSchema) Migrate(ctx context.Context) error {
+	// Warning: AutoMigrate should be avoided in production
+	return s.db.WithContext(ctx).AutoMigrate(&domain.LogEntry{})
+}
+
+func (s *autoMigrateSchema) Maintain(ctx context.Context, now time.Time) error {
+	if s.retentionDays <= 0 {
+		return nil
+	}
+	return s.db.WithContext(ctx).
+		Unscoped().
+		Where("timestamp < ?", retentionCutoff(now, s.retentionDays)).
+		Delete(&domain.LogEntry{}).
+		Error
+}
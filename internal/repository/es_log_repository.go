@@ -5,20 +5,45 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
-	"log"
+	"log/slog"
+	"time"
 
 	"github.com/Yupoer/logpulse/internal/domain"
+	"github.com/Yupoer/logpulse/internal/metrics"
 	"github.com/elastic/go-elasticsearch/v8"
 	"github.com/elastic/go-elasticsearch/v8/esapi"
 )
 
+// liveIndex is the index written by the consumer and queried by /logs/search
+const liveIndex = "logs"
+
 type esLogRepository struct {
 	client *elasticsearch.Client
 }
 
 func NewESLogRepository(address string) (domain.LogSearchRepository, error) {
+	client, err := newESClient(address)
+	if err != nil {
+		return nil, err
+	}
+	return &esLogRepository{client: client}, nil
+}
+
+// NewESIndexAdmin returns the index management side of the ES repository
+// (used for archive rehydration and reindexing).
+func NewESIndexAdmin(address string) (domain.LogIndexAdmin, error) {
+	client, err := newESClient(address)
+	if err != nil {
+		return nil, err
+	}
+	return &esLogRepository{client: client}, nil
+}
+
+func newESClient(address string) (*elasticsearch.Client, error) {
 	cfg := elasticsearch.Config{
 		Addresses: []string{address},
+		// Spans for every request, from the global provider set up by tracing.Setup
+		Instrumentation: elasticsearch.NewOpenTelemetryInstrumentation(nil, false),
 	}
 	client, err := elasticsearch.NewClient(cfg)
 	if err != nil {
@@ -32,10 +57,26 @@ func NewESLogRepository(address string) (domain.LogSearchRepository, error) {
 	}
 	defer func() { _ = res.Body.Close() }()
 
-	return &esLogRepository{client: client}, nil
+	return client, nil
+}
+
+func (r *esLogRepository) Ping(ctx context.Context) error {
+	res, err := r.client.Ping(r.client.Ping.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer func() { _ = res.Body.Close() }()
+	if res.IsError() {
+		return fmt.Errorf("elasticsearch ping: %s", res.Status())
+	}
+	return nil
 }
 
 func (r *esLogRepository) BulkIndex(ctx context.Context, entries []*domain.LogEntry) error {
+	return r.BulkIndexInto(ctx, liveIndex, entries)
+}
+
+func (r *esLogRepository) BulkIndexInto(ctx context.Context, index string, entries []*domain.LogEntry) error {
 	if len(entries) == 0 {
 		return nil
 	}
@@ -45,13 +86,18 @@ func (r *esLogRepository) BulkIndex(ctx context.Context, entries []*domain.LogEn
 	// Data:   { "field1" : "value1" } \n
 	for _, entry := range entries {
 		// 1. Action Line (Metadata)
-		meta := []byte(fmt.Sprintf(`{ "index" : { "_index" : "logs" } }%s`, "\n"))
+		// The DB primary key doubles as the document _id, so re-indexing the
+		// same entry (reindex, redelivery) overwrites instead of duplicating
+		meta := []byte(fmt.Sprintf(`{ "index" : { "_index" : %q } }%s`, index, "\n"))
+		if entry.ID != 0 {
+			meta = []byte(fmt.Sprintf(`{ "index" : { "_index" : %q, "_id" : "%d" } }%s`, index, entry.ID, "\n"))
+		}
 		buf.Write(meta)
 
 		// 2. Data Line (Content)
 		data, err := json.Marshal(entry)
 		if err != nil {
-			log.Printf("Failed to marshal log entry for ES: %v", err)
+			slog.Error("Failed to marshal log entry for ES", "id", entry.ID, "error", err)
 			continue
 		}
 		buf.Write(data)
@@ -73,22 +119,115 @@ func (r *esLogRepository) BulkIndex(ctx context.Context, entries []*domain.LogEn
 		return fmt.Errorf("bulk indexing failed: %s", res.String())
 	}
 
-	return nil
+	return checkBulkItems(res)
+}
+
+// checkBulkItems reports documents ES refused inside a successful bulk
+// response. If every failure is a client error (mapping conflict, bad
+// value) the error wraps domain.ErrLogRejected, since retrying won't help.
+func checkBulkItems(res *esapi.Response) error {
+	var body struct {
+		Errors bool `json:"errors"`
+		Items  []map[string]struct {
+			Status int `json:"status"`
+			Error  struct {
+				Type   string `json:"type"`
+				Reason string `json:"reason"`
+			} `json:"error"`
+		} `json:"items"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&body); err != nil {
+		return fmt.Errorf("decode bulk response: %w", err)
+	}
+	if !body.Errors {
+		return nil
+	}
+
+	failed, rejected := 0, 0
+	var firstReason string
+	for _, item := range body.Items {
+		for _, result := range item {
+			if result.Status < 300 {
+				continue
+			}
+			failed++
+			if result.Status >= 400 && result.Status < 500 && result.Status != 429 {
+				rejected++
+			}
+			if firstReason == "" {
+				firstReason = result.Error.Type + ": " + result.Error.Reason
+			}
+		}
+	}
+
+	if failed > 0 && rejected == failed {
+		return fmt.Errorf("%d of %d documents failed (%s): %w", failed, len(body.Items), firstReason, domain.ErrLogRejected)
+	}
+	return fmt.Errorf("%d of %d documents failed (%s)", failed, len(body.Items), firstReason)
+}
+
+func (r *esLogRepository) Search(ctx context.Context, query domain.LogSearchQuery) ([]*domain.LogEntry, error) {
+	return r.SearchIndex(ctx, liveIndex, query)
 }
 
-func (r *esLogRepository) Search(ctx context.Context, query string) ([]*domain.LogEntry, error) {
+func (r *esLogRepository) SearchIndex(ctx context.Context, index string, query domain.LogSearchQuery) ([]*domain.LogEntry, error) {
+	start := time.Now()
+	logs, err := r.searchIndex(ctx, index, query)
+	metrics.ESSearchDuration.WithLabelValues(metrics.Result(err)).Observe(time.Since(start).Seconds())
+	return logs, err
+}
+
+func (r *esLogRepository) searchIndex(ctx context.Context, index string, query domain.LogSearchQuery) ([]*domain.LogEntry, error) {
 	var buf bytes.Buffer
 
 	// Build ES Query DSL (Domain Specific Language)
-	// Search message and service_name fields
-	queryJSON := map[string]interface{}{
-		"query": map[string]interface{}{
+	// Keyword goes to scoring (must), structured filters don't affect relevance (filter)
+	must := []interface{}{}
+	if query.Query != "" {
+		// Search message and service_name fields
+		must = append(must, map[string]interface{}{
 			"multi_match": map[string]interface{}{
-				"query":  query,
+				"query":  query.Query,
 				"fields": []string{"message", "service_name", "level"},
 			},
+		})
+	}
+
+	filter := []interface{}{}
+	if query.ServiceName != "" {
+		filter = append(filter, map[string]interface{}{
+			"match_phrase": map[string]interface{}{"service_name": query.ServiceName},
+		})
+	}
+	if query.Level != "" {
+		filter = append(filter, map[string]interface{}{
+			"match": map[string]interface{}{"level": query.Level},
+		})
+	}
+	if !query.From.IsZero() || !query.To.IsZero() {
+		timeRange := map[string]interface{}{}
+		if !query.From.IsZero() {
+			timeRange["gte"] = query.From
+		}
+		if !query.To.IsZero() {
+			timeRange["lt"] = query.To
+		}
+		filter = append(filter, map[string]interface{}{
+			"range": map[string]interface{}{"timestamp": timeRange},
+		})
+	}
+
+	queryJSON := map[string]interface{}{
+		"query": map[string]interface{}{
+			"bool": map[string]interface{}{
+				"must":   must,
+				"filter": filter,
+			},
 		},
 	}
+	if query.Limit > 0 {
+		queryJSON["size"] = query.Limit
+	}
 
 	if err := json.NewEncoder(&buf).Encode(queryJSON); err != nil {
 		return nil, err
@@ -97,7 +236,7 @@ func (r *esLogRepository) Search(ctx context.Context, query string) ([]*domain.L
 	// Execute search
 	res, err := r.client.Search(
 		r.client.Search.WithContext(ctx),
-		r.client.Search.WithIndex("logs"),
+		r.client.Search.WithIndex(index),
 		r.client.Search.WithBody(&buf),
 		r.client.Search.WithTrackTotalHits(true),
 	)
@@ -138,3 +277,154 @@ func (r *esLogRepository) Search(ctx context.Context, query string) ([]*domain.L
 
 	return logs, nil
 }
+
+func (r *esLogRepository) CreateIndex(ctx context.Context, index string, body []byte) error {
+	opts := []func(*esapi.IndicesCreateRequest){r.client.Indices.Create.WithContext(ctx)}
+	if len(body) > 0 {
+		opts = append(opts, r.client.Indices.Create.WithBody(bytes.NewReader(body)))
+	}
+
+	res, err := r.client.Indices.Create(index, opts...)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = res.Body.Close() }()
+
+	if res.IsError() {
+		return fmt.Errorf("create index %s failed: %s", index, res.String())
+	}
+	return nil
+}
+
+func (r *esLogRepository) DeleteIndex(ctx context.Context, index string) error {
+	res, err := r.client.Indices.Delete([]string{index}, r.client.Indices.Delete.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer func() { _ = res.Body.Close() }()
+
+	if res.IsError() {
+		return fmt.Errorf("delete index %s failed: %s", index, res.String())
+	}
+	return nil
+}
+
+// ListIndices returns the names of indices matching a wildcard pattern (e.g. "logs-*")
+func (r *esLogRepository) ListIndices(ctx context.Context, pattern string) ([]string, error) {
+	res, err := r.client.Cat.Indices(
+		r.client.Cat.Indices.WithContext(ctx),
+		r.client.Cat.Indices.WithIndex(pattern),
+		r.client.Cat.Indices.WithFormat("json"),
+		r.client.Cat.Indices.WithH("index"),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = res.Body.Close() }()
+
+	if res.StatusCode == 404 {
+		return []string{}, nil
+	}
+	if res.IsError() {
+		return nil, fmt.Errorf("list indices failed: %s", res.String())
+	}
+
+	var rows []struct {
+		Index string `json:"index"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&rows); err != nil {
+		return nil, err
+	}
+
+	indices := make([]string, 0, len(rows))
+	for _, row := range rows {
+		indices = append(indices, row.Index)
+	}
+	return indices, nil
+}
+
+func (r *esLogRepository) SwitchAlias(ctx context.Context, alias, index string, replaceIndex bool) error {
+	actions := make([]map[string]interface{}, 0)
+
+	// Detach the alias from whatever it points at today
+	current, err := r.aliasTargets(ctx, alias)
+	if err != nil {
+		return err
+	}
+	for _, old := range current {
+		if old == index {
+			continue
+		}
+		actions = append(actions, map[string]interface{}{
+			"remove": map[string]interface{}{"index": old, "alias": alias},
+		})
+	}
+
+	if len(current) == 0 {
+		// No alias yet: the name may still be taken by a concrete index
+		res, err := r.client.Indices.Exists([]string{alias}, r.client.Indices.Exists.WithContext(ctx))
+		if err != nil {
+			return err
+		}
+		_ = res.Body.Close()
+		if res.StatusCode == 200 {
+			if !replaceIndex {
+				return fmt.Errorf("%s is a concrete index, refusing to replace it", alias)
+			}
+			actions = append(actions, map[string]interface{}{
+				"remove_index": map[string]interface{}{"index": alias},
+			})
+		}
+	}
+
+	actions = append(actions, map[string]interface{}{
+		"add": map[string]interface{}{"index": index, "alias": alias, "is_write_index": true},
+	})
+
+	var buf bytes.Buffer
+	if err := json.NewEncoder(&buf).Encode(map[string]interface{}{"actions": actions}); err != nil {
+		return err
+	}
+
+	// All actions in one _aliases request are applied atomically
+	res, err := r.client.Indices.UpdateAliases(&buf, r.client.Indices.UpdateAliases.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer func() { _ = res.Body.Close() }()
+
+	if res.IsError() {
+		return fmt.Errorf("switch alias %s failed: %s", alias, res.String())
+	}
+	return nil
+}
+
+// aliasTargets returns the indices alias currently points at (empty if it is not an alias)
+func (r *esLogRepository) aliasTargets(ctx context.Context, alias string) ([]string, error) {
+	res, err := r.client.Indices.GetAlias(
+		r.client.Indices.GetAlias.WithContext(ctx),
+		r.client.Indices.GetAlias.WithName(alias),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = res.Body.Close() }()
+
+	if res.StatusCode == 404 {
+		return []string{}, nil
+	}
+	if res.IsError() {
+		return nil, fmt.Errorf("get alias %s failed: %s", alias, res.String())
+	}
+
+	// Response: { "<index>": { "aliases": { "<alias>": {} } }, ... }
+	var result map[string]interface{}
+	if err := json.NewDecoder(res.Body).Decode(&result); err != nil {
+		return nil, err
+	}
+	indices := make([]string, 0, len(result))
+	for index := range result {
+		indices = append(indices, index)
+	}
+	return indices, nil
+}
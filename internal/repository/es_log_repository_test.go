@@ -0,0 +1,35 @@
+package repository
+
+import (
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/Yupoer/logpulse/internal/domain"
+	"github.com/elastic/go-elasticsearch/v8/esapi"
+	"github.com/stretchr/testify/assert"
+)
+
+func bulkResponse(body string) *esapi.Response {
+	return &esapi.Response{StatusCode: 200, Body: io.NopCloser(strings.NewReader(body))}
+}
+
+func TestCheckBulkItems(t *testing.T) {
+	assert.NoError(t, checkBulkItems(bulkResponse(`{"errors":false,"items":[{"index":{"status":201}}]}`)))
+
+	// Mapping conflicts can't be fixed by retrying
+	err := checkBulkItems(bulkResponse(`{"errors":true,"items":[
+		{"index":{"status":201}},
+		{"index":{"status":400,"error":{"type":"mapper_parsing_exception","reason":"failed to parse field [timestamp]"}}}
+	]}`))
+	assert.ErrorIs(t, err, domain.ErrLogRejected)
+	assert.Contains(t, err.Error(), "1 of 2 documents failed")
+
+	// Back-pressure is transient
+	err = checkBulkItems(bulkResponse(`{"errors":true,"items":[
+		{"index":{"status":400,"error":{"type":"mapper_parsing_exception","reason":"bad"}}},
+		{"index":{"status":429,"error":{"type":"es_rejected_execution_exception","reason":"queue full"}}}
+	]}`))
+	assert.Error(t, err)
+	assert.NotErrorIs(t, err, domain.ErrLogRejected)
+}
@@ -0,0 +1,36 @@
+package repository
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/Yupoer/logpulse/internal/config"
+	"github.com/Yupoer/logpulse/internal/domain"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestGormTracing_SpanPerStatement(t *testing.T) {
+	recorder := recordSpans(t)
+	backend, err := NewRelationalBackend(&config.Config{DBDriver: DriverSQLite, DBUrl: filepath.Join(t.TempDir(), "logpulse.db")})
+	require.NoError(t, err)
+	require.NoError(t, backend.Schema.Migrate(context.Background()))
+
+	ctx, parent := otel.Tracer("test").Start(context.Background(), "flush")
+	require.NoError(t, backend.Logs.Create(ctx, &domain.LogEntry{ServiceName: "payment-service", Message: "traced"}))
+	parent.End()
+
+	create := endedSpan(t, recorder, "gorm.create")
+	assert.Equal(t, trace.SpanKindClient, create.SpanKind())
+	assert.Equal(t, parent.SpanContext().SpanID(), create.Parent().SpanID())
+	var statement string
+	for _, attr := range create.Attributes() {
+		if attr.Key == "db.statement" {
+			statement = attr.Value.AsString()
+		}
+	}
+	assert.Contains(t, statement, "INSERT INTO")
+}
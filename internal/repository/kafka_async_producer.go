@@ -0,0 +1,210 @@
+package repository
+
+import (
+	"context"
+	"log/slog"
+	"sync/atomic"
+	"time"
+
+	"github.com/IBM/sarama"
+	"github.com/Yupoer/logpulse/internal/config"
+	"github.com/Yupoer/logpulse/internal/domain"
+	"github.com/Yupoer/logpulse/internal/envelope"
+	"github.com/Yupoer/logpulse/internal/logging"
+	"github.com/Yupoer/logpulse/internal/resilience"
+	"github.com/Yupoer/logpulse/internal/tracing"
+	"go.opentelemetry.io/otel/trace"
+	"golang.org/x/sync/semaphore"
+)
+
+// DeliveryErrorFunc is called for every log the async producer failed to
+// deliver after Sarama's own retries, unless a caller waiting for the ack
+// got the error instead
+type DeliveryErrorFunc func(entry *domain.LogEntry, err error)
+
+// ProducerStats counts async deliveries since startup
+type ProducerStats struct {
+	Delivered     int64 `json:"delivered"`
+	Failed        int64 `json:"failed"`
+	BufferedBytes int64 `json:"buffered_bytes"` // Encoded logs awaiting a broker ack
+}
+
+// asyncDelivery travels with a message as its Metadata
+type asyncDelivery struct {
+	entry     *domain.LogEntry
+	size      int64
+	ack       chan error  // Set when the caller waits for the broker ack
+	waiting   atomic.Bool // Claimed by whichever comes first: the report or the caller giving up
+	span      trace.Span  // Ends with the delivery report
+	requestID string
+}
+
+// KafkaAsyncProducer batches logs in the background instead of waiting for
+// a broker round trip per log. SendLog returns once the log is buffered,
+// unless the caller asked for an ack with domain.WithDeliveryAck.
+type KafkaAsyncProducer struct {
+	producer sarama.AsyncProducer
+	topic    string
+	encoder  envelope.Encoder
+	breaker  *resilience.Breaker
+	onError  DeliveryErrorFunc
+
+	buffered    *semaphore.Weighted // Bounds memory held by undelivered logs
+	maxBuffered int64
+
+	delivered     atomic.Int64
+	failed        atomic.Int64
+	bufferedBytes atomic.Int64
+
+	done chan struct{} // Closed once every delivery report is handled
+}
+
+// NewKafkaAsyncProducer sends batches once they reach cfg.BatchBytes or
+// have waited cfg.Linger. Failed deliveries are counted, fed to the breaker
+// and passed to onError (which may be nil).
+func NewKafkaAsyncProducer(brokers []string, topic string, cfg config.KafkaProducerConfig, encoder envelope.Encoder, breaker *resilience.Breaker, onError DeliveryErrorFunc) (*KafkaAsyncProducer, error) {
+	saramaConfig, err := newProducerConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+	saramaConfig.Producer.Flush.Frequency = cfg.Linger
+	saramaConfig.Producer.Flush.Bytes = cfg.BatchBytes
+
+	producer, err := sarama.NewAsyncProducer(brokers, saramaConfig)
+	if err != nil {
+		return nil, err
+	}
+	return newKafkaAsyncProducer(producer, topic, cfg.MaxBufferedBytes, encoder, breaker, onError), nil
+}
+
+func newKafkaAsyncProducer(producer sarama.AsyncProducer, topic string, maxBuffered int64, encoder envelope.Encoder, breaker *resilience.Breaker, onError DeliveryErrorFunc) *KafkaAsyncProducer {
+	if maxBuffered <= 0 {
+		maxBuffered = 64 << 20
+	}
+	p := &KafkaAsyncProducer{
+		producer:    producer,
+		topic:       topic,
+		encoder:     encoder,
+		breaker:     breaker,
+		onError:     onError,
+		buffered:    semaphore.NewWeighted(maxBuffered),
+		maxBuffered: maxBuffered,
+		done:        make(chan struct{}),
+	}
+	go p.handleDeliveries()
+	return p
+}
+
+func (p *KafkaAsyncProducer) SendLog(ctx context.Context, entry *domain.LogEntry) error {
+	bytes, err := p.encoder.Encode(entry, time.Now())
+	if err != nil {
+		return err
+	}
+	span, carrier := startSendSpan(ctx, "kafka", p.topic)
+
+	// Wait for buffer space; a log bigger than the whole buffer waits for all of it
+	delivery := &asyncDelivery{entry: entry, size: min(int64(len(bytes)), p.maxBuffered), span: span, requestID: logging.RequestID(ctx)}
+	if err := p.buffered.Acquire(ctx, delivery.size); err != nil {
+		tracing.End(span, err)
+		return err
+	}
+	if err := p.breaker.Allow(); err != nil {
+		p.buffered.Release(delivery.size)
+		tracing.End(span, err)
+		return err
+	}
+	p.bufferedBytes.Add(delivery.size)
+
+	ack := domain.DeliveryAckRequested(ctx)
+	if ack {
+		delivery.ack = make(chan error, 1)
+		delivery.waiting.Store(true)
+	}
+	p.producer.Input() <- &sarama.ProducerMessage{
+		Topic: p.topic,
+		// Same key as the sync producer, so per-service ordering is unchanged
+		Key:      sarama.StringEncoder(entry.ServiceName),
+		Value:    sarama.ByteEncoder(bytes),
+		Headers:  messageHeaders(ctx, p.encoder, carrier),
+		Metadata: delivery,
+	}
+	if !ack {
+		return nil
+	}
+
+	select {
+	case err := <-delivery.ack:
+		return err
+	case <-ctx.Done():
+		if delivery.waiting.CompareAndSwap(true, false) {
+			return ctx.Err() // Still delivered (or reported to onError) in the background
+		}
+		return <-delivery.ack // The report won the race and is on its way
+	}
+}
+
+// Close flushes buffered logs and waits for their delivery reports
+func (p *KafkaAsyncProducer) Close() error {
+	err := p.producer.Close()
+	<-p.done
+	return err
+}
+
+func (p *KafkaAsyncProducer) Stats() ProducerStats {
+	return ProducerStats{
+		Delivered:     p.delivered.Load(),
+		Failed:        p.failed.Load(),
+		BufferedBytes: p.bufferedBytes.Load(),
+	}
+}
+
+func (p *KafkaAsyncProducer) handleDeliveries() {
+	defer close(p.done)
+
+	successes, errs := p.producer.Successes(), p.producer.Errors()
+	for successes != nil || errs != nil {
+		select {
+		case msg, ok := <-successes:
+			if !ok {
+				successes = nil
+				continue
+			}
+			p.delivered.Add(1)
+			p.finish(msg, nil)
+
+		case perr, ok := <-errs:
+			if !ok {
+				errs = nil
+				continue
+			}
+			p.failed.Add(1)
+			attrs := []any{"topic", perr.Msg.Topic, "error", perr.Err}
+			if d, ok := perr.Msg.Metadata.(*asyncDelivery); ok && d.requestID != "" {
+				attrs = append(attrs, "request_id", d.requestID)
+			}
+			slog.Warn("Async delivery failed", attrs...)
+			p.finish(perr.Msg, perr.Err)
+		}
+	}
+}
+
+func (p *KafkaAsyncProducer) finish(msg *sarama.ProducerMessage, err error) {
+	p.breaker.Record(err == nil)
+	delivery, ok := msg.Metadata.(*asyncDelivery)
+	if !ok {
+		return
+	}
+	p.bufferedBytes.Add(-delivery.size)
+	p.buffered.Release(delivery.size)
+	tracing.End(delivery.span, err)
+
+	// A caller still waiting handles the error itself (e.g. spools the log),
+	// so it must not be passed to onError as well
+	if delivery.ack != nil && delivery.waiting.CompareAndSwap(true, false) {
+		delivery.ack <- err
+		return
+	}
+	if err != nil && p.onError != nil {
+		p.onError(delivery.entry, err)
+	}
+}
@@ -0,0 +1,110 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/IBM/sarama"
+	"github.com/IBM/sarama/mocks"
+	"github.com/Yupoer/logpulse/internal/domain"
+	"github.com/Yupoer/logpulse/internal/envelope"
+	"github.com/Yupoer/logpulse/internal/resilience"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+func newMockAsyncProducer(t *testing.T) *mocks.AsyncProducer {
+	cfg := mocks.NewTestConfig()
+	cfg.Producer.Return.Successes = true
+	return mocks.NewAsyncProducer(t, cfg)
+}
+
+func TestKafkaAsyncProducer_DeliversInBackground(t *testing.T) {
+	mock := newMockAsyncProducer(t)
+	mock.ExpectInputWithMessageCheckerFunctionAndSucceed(func(msg *sarama.ProducerMessage) error {
+		assert.Equal(t, envelope.ContentTypeJSON, producerHeader(msg.Headers, envelope.HeaderContentType))
+		return nil
+	})
+
+	p := newKafkaAsyncProducer(mock, "logs_topic", 1<<20, envelope.Encoder{ContentType: envelope.ContentTypeJSON}, nil, nil)
+	require.NoError(t, p.SendLog(context.Background(), &domain.LogEntry{ServiceName: "payment-service", Message: "ok"}))
+	require.NoError(t, p.Close())
+
+	assert.Equal(t, ProducerStats{Delivered: 1}, p.Stats())
+}
+
+func TestKafkaAsyncProducer_ReportsDeliveryErrors(t *testing.T) {
+	errBroker := errors.New("leader not available")
+	mock := newMockAsyncProducer(t)
+	mock.ExpectInputAndFail(errBroker)
+	mock.ExpectInputAndFail(errBroker)
+
+	var mu sync.Mutex
+	var failed []string
+	onError := func(entry *domain.LogEntry, err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		assert.ErrorIs(t, err, errBroker)
+		failed = append(failed, entry.Message)
+	}
+	breaker := resilience.NewBreaker("kafka", 2, time.Hour)
+	p := newKafkaAsyncProducer(mock, "logs_topic", 1<<20, envelope.Encoder{ContentType: envelope.ContentTypeJSON}, breaker, onError)
+
+	// Fire-and-forget: SendLog succeeds, the failure arrives through the callback
+	require.NoError(t, p.SendLog(context.Background(), &domain.LogEntry{Message: "lost"}))
+
+	// A caller that asks for an ack sees the delivery error, and the
+	// callback doesn't, so the log isn't spooled twice
+	err := p.SendLog(domain.WithDeliveryAck(context.Background()), &domain.LogEntry{Message: "acked"})
+	assert.ErrorIs(t, err, errBroker)
+	require.NoError(t, p.Close())
+
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal(t, []string{"lost"}, failed)
+	assert.Equal(t, int64(2), p.Stats().Failed)
+	assert.Equal(t, int64(0), p.Stats().BufferedBytes)
+	// Delivery failures count against the breaker like sync send failures
+	assert.Equal(t, resilience.StateOpen, breaker.State())
+}
+
+func TestKafkaAsyncProducer_BlocksWhenBufferIsFull(t *testing.T) {
+	mock := newMockAsyncProducer(t)
+	p := newKafkaAsyncProducer(mock, "logs_topic", 64, envelope.Encoder{ContentType: envelope.ContentTypeJSON}, nil, nil)
+
+	// Everything is awaiting delivery already
+	require.NoError(t, p.buffered.Acquire(context.Background(), 64))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	err := p.SendLog(ctx, &domain.LogEntry{Message: "waits"})
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+
+	p.buffered.Release(64)
+	require.NoError(t, p.Close())
+}
+
+func TestKafkaAsyncProducer_AbandonedAckGoesToCallback(t *testing.T) {
+	errBroker := errors.New("leader not available")
+	var failed []string
+	onError := func(entry *domain.LogEntry, err error) { failed = append(failed, entry.Message) }
+	p := newKafkaAsyncProducer(newMockAsyncProducer(t), "logs_topic", 1<<20, envelope.Encoder{ContentType: envelope.ContentTypeJSON}, nil, onError)
+	defer func() { require.NoError(t, p.Close()) }()
+
+	// The caller gave up waiting (waiting is false), so nobody else handles it
+	abandoned := &asyncDelivery{entry: &domain.LogEntry{Message: "abandoned"}, ack: make(chan error, 1), span: noop.Span{}}
+	p.finish(&sarama.ProducerMessage{Metadata: abandoned}, errBroker)
+	assert.Equal(t, []string{"abandoned"}, failed)
+	assert.Empty(t, abandoned.ack)
+
+	// A caller still waiting gets the error instead of the callback
+	waiting := &asyncDelivery{entry: &domain.LogEntry{Message: "waiting"}, ack: make(chan error, 1), span: noop.Span{}}
+	waiting.waiting.Store(true)
+	p.finish(&sarama.ProducerMessage{Metadata: waiting}, errBroker)
+	assert.ErrorIs(t, <-waiting.ack, errBroker)
+	assert.Equal(t, []string{"abandoned"}, failed)
+}
@@ -2,25 +2,37 @@ package repository
 
 import (
 	"context"
-	"encoding/json"
-	"log"
-	"time"
+	"log/slog"
 
 	"github.com/IBM/sarama"
 	"github.com/Yupoer/logpulse/internal/domain"
+	"github.com/Yupoer/logpulse/internal/envelope"
+	"github.com/Yupoer/logpulse/internal/resilience"
 )
 
 type KafkaConsumer struct {
-	mysqlRepo domain.LogRepository
-	esRepo    domain.LogSearchRepository
+	*queueWorker
+
+	// Set by Subscribe, used by Run
+	brokers []string
+	topic   string
+	groupID string
 }
 
 // Updated Constructor
-func NewKafkaConsumer(mysqlRepo domain.LogRepository, esRepo domain.LogSearchRepository) *KafkaConsumer {
-	return &KafkaConsumer{
-		mysqlRepo: mysqlRepo,
-		esRepo:    esRepo,
-	}
+func NewKafkaConsumer(mysqlRepo domain.LogRepository, esRepo domain.LogSearchRepository, deadLetters domain.DeadLetterQueue, maxAttempts int, res ConsumerResilience) *KafkaConsumer {
+	return &KafkaConsumer{queueWorker: newQueueWorker(mysqlRepo, esRepo, deadLetters, maxAttempts, res)}
+}
+
+// Subscribe sets the consumer group Run joins
+func (c *KafkaConsumer) Subscribe(brokers []string, topic, groupID string) *KafkaConsumer {
+	c.brokers, c.topic, c.groupID = brokers, topic, groupID
+	return c
+}
+
+// Run implements domain.LogConsumer
+func (c *KafkaConsumer) Run(ctx context.Context) {
+	c.StartConsumerGroup(ctx, c.brokers, c.topic, c.groupID)
 }
 
 func (c *KafkaConsumer) StartConsumerGroup(ctx context.Context, brokers []string, topic string, groupID string) {
@@ -28,18 +40,32 @@ func (c *KafkaConsumer) StartConsumerGroup(ctx context.Context, brokers []string
 	config.Consumer.Group.Rebalance.GroupStrategies = []sarama.BalanceStrategy{sarama.NewBalanceStrategyRoundRobin()}
 	config.Consumer.Offsets.Initial = sarama.OffsetOldest
 
-	client, err := sarama.NewConsumerGroup(brokers, groupID, config)
-	if err != nil {
-		log.Printf("Error creating consumer group client: %v", err)
-		return
+	var client sarama.ConsumerGroup
+	for attempt := 1; ; attempt++ {
+		var err error
+		client, err = sarama.NewConsumerGroup(brokers, groupID, config)
+		if err == nil {
+			break
+		}
+		delay := c.resilience.Backoff.Delay(attempt)
+		slog.Warn("Error creating consumer group client, retrying", "retry_in", delay, "error", err)
+		if resilience.Sleep(ctx, delay) != nil {
+			return
+		}
 	}
+	defer func() { _ = client.Close() }()
 
+	failures := 0
 	for {
 		// Consume is blocking, but our ConsumeClaim now handles the batch logic
 		if err := client.Consume(ctx, []string{topic}, c); err != nil {
-			log.Printf("Error from consumer: %v", err)
-			// Small backoff to avoid tight loop on error
-			time.Sleep(2 * time.Second)
+			failures++
+			delay := c.resilience.Backoff.Delay(failures)
+			slog.Warn("Error from consumer, retrying", "topic", topic, "retry_in", delay, "error", err)
+			// Back off to avoid tight loop on error
+			_ = resilience.Sleep(ctx, delay)
+		} else {
+			failures = 0 // Session ended normally (rebalance)
 		}
 		if ctx.Err() != nil {
 			return
@@ -50,74 +76,35 @@ func (c *KafkaConsumer) StartConsumerGroup(ctx context.Context, brokers []string
 func (c *KafkaConsumer) Setup(sarama.ConsumerGroupSession) error   { return nil }
 func (c *KafkaConsumer) Cleanup(sarama.ConsumerGroupSession) error { return nil }
 
-// ConsumeClaim implements the Batch Processing Logic
+// ConsumeClaim feeds the claim to the shared batching worker. Offsets are
+// marked only after a batch is stored, see queueWorker.consume.
 func (c *KafkaConsumer) ConsumeClaim(session sarama.ConsumerGroupSession, claim sarama.ConsumerGroupClaim) error {
-	const batchSize = 100
-	const flushInterval = 1 * time.Second
-
-	// Buffer to hold logs
-	batch := make([]*domain.LogEntry, 0, batchSize)
-
-	// Ticker for time-based flush
-	ticker := time.NewTicker(flushInterval)
-	defer ticker.Stop()
+	consumeFrom(session.Context(), c.queueWorker, claim.Partition(), claim.Messages(), fromSaramaMessage, func(batch []*queueMessage) error {
+		session.MarkMessage(batch[len(batch)-1].raw.(*sarama.ConsumerMessage), "")
+		return nil
+	})
+	return nil
+}
 
-	// Helper function to flush batch to ES
-	flush := func() {
-		if len(batch) == 0 {
-			return
-		}
-		// Write to ES
-		if err := c.esRepo.BulkIndex(context.Background(), batch); err != nil {
-			log.Printf("Failed to bulk index to ES: %v", err)
-		} else {
-			log.Printf("[Worker] Bulk Indexed %d logs to ES", len(batch))
-		}
-		// Reset buffer (keep capacity)
-		batch = batch[:0]
+func fromSaramaMessage(msg *sarama.ConsumerMessage) *queueMessage {
+	return &queueMessage{
+		Topic:       msg.Topic,
+		Partition:   msg.Partition,
+		Offset:      msg.Offset,
+		Key:         msg.Key,
+		Value:       msg.Value,
+		ContentType: headerValue(msg.Headers, envelope.HeaderContentType),
+		RequestID:   headerValue(msg.Headers, envelope.HeaderRequestID),
+		Trace:       traceFromHeaders(msg.Headers),
+		raw:         msg,
 	}
+}
 
-	for {
-		select {
-		case msg, ok := <-claim.Messages():
-			if !ok {
-				flush() // Channel closed, flush remaining
-				return nil
-			}
-
-			// 1. Unmarshal
-			var entry domain.LogEntry
-			if err := json.Unmarshal(msg.Value, &entry); err != nil {
-				log.Printf("Failed to unmarshal log: %v", err)
-				session.MarkMessage(msg, "") // Skip bad message
-				continue
-			}
-
-			// 2. Write to MySQL (Sync backup) - 保持逐筆寫入以確保資料安全性 (MVP)
-			if err := c.mysqlRepo.Create(context.Background(), &entry); err != nil {
-				log.Printf("Failed to save log to DB: %v", err)
-			}
-
-			// 3. Add to Batch for ES
-			batch = append(batch, &entry)
-
-			// 4. Check Batch Size
-			if len(batch) >= batchSize {
-				flush()
-				// Only mark offset after successful processing?
-				// For simplicity, we mark here. ideally should be after flush success.
-			}
-
-			session.MarkMessage(msg, "")
-
-		case <-ticker.C:
-			// 5. Time Trigger
-			flush()
-
-		case <-session.Context().Done():
-			// 6. Graceful Shutdown
-			flush()
-			return nil
+func headerValue(headers []*sarama.RecordHeader, key string) string {
+	for _, h := range headers {
+		if h != nil && string(h.Key) == key {
+			return string(h.Value)
 		}
 	}
+	return ""
 }
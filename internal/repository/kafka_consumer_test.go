@@ -0,0 +1,441 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/IBM/sarama"
+	"github.com/Yupoer/logpulse/internal/domain"
+	"github.com/Yupoer/logpulse/internal/envelope"
+	"github.com/Yupoer/logpulse/internal/metrics"
+	"github.com/Yupoer/logpulse/internal/resilience"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// --- Fakes ---
+
+type fakeSession struct {
+	ctx context.Context
+
+	mu     sync.Mutex
+	marked []int64
+}
+
+func (s *fakeSession) Claims() map[string][]int32 { return nil }
+func (s *fakeSession) MemberID() string           { return "test-member" }
+func (s *fakeSession) GenerationID() int32        { return 1 }
+func (s *fakeSession) MarkOffset(topic string, partition int32, offset int64, metadata string) {
+}
+func (s *fakeSession) Commit() {}
+func (s *fakeSession) ResetOffset(topic string, partition int32, offset int64, metadata string) {
+}
+func (s *fakeSession) MarkMessage(msg *sarama.ConsumerMessage, metadata string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.marked = append(s.marked, msg.Offset)
+}
+func (s *fakeSession) Context() context.Context { return s.ctx }
+
+func (s *fakeSession) markedOffsets() []int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]int64(nil), s.marked...)
+}
+
+type fakeClaim struct {
+	messages chan *sarama.ConsumerMessage
+}
+
+func (c *fakeClaim) Topic() string                            { return "logs" }
+func (c *fakeClaim) Partition() int32                         { return 0 }
+func (c *fakeClaim) InitialOffset() int64                     { return 0 }
+func (c *fakeClaim) HighWaterMarkOffset() int64               { return 0 }
+func (c *fakeClaim) Messages() <-chan *sarama.ConsumerMessage { return c.messages }
+
+// countingLogRepo assigns sequential IDs; other methods are not used by the consumer
+type countingLogRepo struct {
+	domain.LogRepository
+
+	mu      sync.Mutex
+	creates int
+}
+
+func (r *countingLogRepo) Create(ctx context.Context, entry *domain.LogEntry) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.creates++
+	entry.ID = uint(r.creates)
+	return nil
+}
+
+// flakyESRepo fails the first failures bulk requests (or all of them when negative)
+type flakyESRepo struct {
+	domain.LogSearchRepository
+
+	mu       sync.Mutex
+	failures int
+	calls    int
+	indexed  map[uint]bool
+}
+
+func (r *flakyESRepo) BulkIndex(ctx context.Context, entries []*domain.LogEntry) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.calls++
+	if r.failures < 0 || r.calls <= r.failures {
+		return errors.New("es unavailable")
+	}
+	if r.indexed == nil {
+		r.indexed = map[uint]bool{}
+	}
+	for _, e := range entries {
+		r.indexed[e.ID] = true
+	}
+	return nil
+}
+
+func (r *flakyESRepo) callCount() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.calls
+}
+
+// memDeadLetters records published dead letters
+type memDeadLetters struct {
+	domain.DeadLetterQueue
+
+	mu      sync.Mutex
+	letters []*domain.DeadLetter
+}
+
+func (q *memDeadLetters) Publish(ctx context.Context, letter *domain.DeadLetter) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.letters = append(q.letters, letter)
+	return nil
+}
+
+func (q *memDeadLetters) published() []*domain.DeadLetter {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return append([]*domain.DeadLetter(nil), q.letters...)
+}
+
+// rejectingESRepo refuses any batch containing a message equal to reject
+type rejectingESRepo struct {
+	domain.LogSearchRepository
+
+	reject  string
+	indexed []string
+}
+
+func (r *rejectingESRepo) BulkIndex(ctx context.Context, entries []*domain.LogEntry) error {
+	for _, e := range entries {
+		if e.Message == r.reject {
+			return fmt.Errorf("1 of %d documents failed (mapper_parsing_exception): %w", len(entries), domain.ErrLogRejected)
+		}
+	}
+	for _, e := range entries {
+		r.indexed = append(r.indexed, e.Message)
+	}
+	return nil
+}
+
+func newTestConsumer(logRepo domain.LogRepository, esRepo domain.LogSearchRepository) *KafkaConsumer {
+	return newTestConsumerWithDLQ(logRepo, esRepo, nil)
+}
+
+func newTestConsumerWithDLQ(logRepo domain.LogRepository, esRepo domain.LogSearchRepository, dlq domain.DeadLetterQueue) *KafkaConsumer {
+	c := NewKafkaConsumer(logRepo, esRepo, dlq, 2, ConsumerResilience{
+		Backoff: resilience.Backoff{Initial: time.Millisecond, Max: 5 * time.Millisecond},
+	})
+	c.batchSize = 3
+	c.flushInterval = time.Hour // Only size-triggered and shutdown flushes
+	return c
+}
+
+func logMessage(t *testing.T, offset int64) *sarama.ConsumerMessage {
+	return logMessageWith(t, offset, "ok")
+}
+
+func logMessageWith(t *testing.T, offset int64, message string) *sarama.ConsumerMessage {
+	value, err := json.Marshal(domain.LogEntry{ServiceName: "payment-service", Level: "INFO", Message: message})
+	require.NoError(t, err)
+	return &sarama.ConsumerMessage{Topic: "logs", Offset: offset, Key: []byte("payment-service"), Value: value}
+}
+
+// --- Tests ---
+
+func TestConsumeClaim_RetriesFailedFlushBeforeMarking(t *testing.T) {
+	logRepo := &countingLogRepo{}
+	esRepo := &flakyESRepo{failures: 2}
+	consumer := newTestConsumer(logRepo, esRepo)
+	consumer.maxAttempts = 3 // Recovers before entries are isolated
+	esFailures := testutil.ToFloat64(metrics.ConsumerFlushFailures.WithLabelValues("logs", "es"))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	session := &fakeSession{ctx: ctx}
+	claim := &fakeClaim{messages: make(chan *sarama.ConsumerMessage, 3)}
+	for i := int64(0); i < 3; i++ {
+		claim.messages <- logMessage(t, i)
+	}
+	close(claim.messages)
+
+	require.NoError(t, consumer.ConsumeClaim(session, claim))
+
+	assert.Equal(t, 3, esRepo.callCount())
+	assert.Len(t, esRepo.indexed, 3)
+	// Retries reuse the saved rows instead of inserting duplicates
+	assert.Equal(t, 3, logRepo.creates)
+	assert.Equal(t, []int64{2}, session.markedOffsets())
+
+	stats := consumer.Stats()
+	assert.Equal(t, int64(2), stats.ESErrors)
+	assert.Equal(t, esFailures+2, testutil.ToFloat64(metrics.ConsumerFlushFailures.WithLabelValues("logs", "es")))
+	assert.Equal(t, int64(0), stats.DBErrors)
+	assert.Equal(t, int64(3), stats.FlushedTotal)
+	assert.False(t, stats.LastFlushAt.IsZero())
+	// The claim has ended, so nothing is reported as buffered
+	assert.Equal(t, 0, stats.Claims)
+	assert.Equal(t, 0, stats.BatchFill)
+}
+
+func TestConsumeClaim_DoesNotMarkWhenFlushNeverSucceeds(t *testing.T) {
+	esRepo := &flakyESRepo{failures: -1}
+	consumer := newTestConsumer(&countingLogRepo{}, esRepo)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	session := &fakeSession{ctx: ctx}
+	claim := &fakeClaim{messages: make(chan *sarama.ConsumerMessage, 4)}
+	for i := int64(0); i < 4; i++ {
+		claim.messages <- logMessage(t, i)
+	}
+
+	done := make(chan error, 1)
+	go func() { done <- consumer.ConsumeClaim(session, claim) }()
+
+	// The partition stays paused on the failing batch
+	require.Eventually(t, func() bool { return esRepo.callCount() >= 3 }, time.Second, time.Millisecond)
+	assert.Len(t, claim.messages, 1)
+
+	// Rebalance: the consumer gives up without committing, so every message is redelivered
+	cancel()
+	select {
+	case err := <-done:
+		require.NoError(t, err)
+	case <-time.After(time.Second):
+		t.Fatal("ConsumeClaim did not return after the session ended")
+	}
+	assert.Empty(t, session.markedOffsets())
+}
+
+func TestConsumeClaim_SkipsPoisonMessageWithBatch(t *testing.T) {
+	esRepo := &flakyESRepo{}
+	consumer := newTestConsumer(&countingLogRepo{}, esRepo)
+
+	session := &fakeSession{ctx: context.Background()}
+	claim := &fakeClaim{messages: make(chan *sarama.ConsumerMessage, 2)}
+	claim.messages <- logMessage(t, 0)
+	claim.messages <- &sarama.ConsumerMessage{Topic: "logs", Offset: 1, Value: []byte("not json")}
+	close(claim.messages)
+
+	require.NoError(t, consumer.ConsumeClaim(session, claim))
+
+	assert.Len(t, esRepo.indexed, 1)
+	assert.Equal(t, []int64{1}, session.markedOffsets())
+}
+
+func TestConsumeClaim_DeadLettersPoisonMessage(t *testing.T) {
+	dlq := &memDeadLetters{}
+	consumer := newTestConsumerWithDLQ(&countingLogRepo{}, &flakyESRepo{}, dlq)
+
+	session := &fakeSession{ctx: context.Background()}
+	claim := &fakeClaim{messages: make(chan *sarama.ConsumerMessage, 2)}
+	claim.messages <- &sarama.ConsumerMessage{Topic: "logs", Partition: 0, Offset: 0, Value: []byte("not json")}
+	claim.messages <- logMessage(t, 1)
+	close(claim.messages)
+
+	require.NoError(t, consumer.ConsumeClaim(session, claim))
+
+	letters := dlq.published()
+	require.Len(t, letters, 1)
+	assert.Equal(t, "logs", letters[0].SourceTopic)
+	assert.Equal(t, int64(0), letters[0].SourceOffset)
+	assert.Equal(t, 1, letters[0].Attempts)
+	assert.Equal(t, []byte("not json"), letters[0].Value)
+	assert.NotEmpty(t, letters[0].Error)
+	assert.Equal(t, []int64{1}, session.markedOffsets())
+}
+
+func TestConsumeClaim_DeadLettersRejectedEntry(t *testing.T) {
+	dlq := &memDeadLetters{}
+	esRepo := &rejectingESRepo{reject: "bad"}
+	consumer := newTestConsumerWithDLQ(&countingLogRepo{}, esRepo, dlq)
+
+	session := &fakeSession{ctx: context.Background()}
+	claim := &fakeClaim{messages: make(chan *sarama.ConsumerMessage, 3)}
+	claim.messages <- logMessageWith(t, 0, "first")
+	claim.messages <- logMessageWith(t, 1, "bad")
+	claim.messages <- logMessageWith(t, 2, "last")
+	close(claim.messages)
+
+	require.NoError(t, consumer.ConsumeClaim(session, claim))
+
+	// The good entries are stored, the rejected one is dead-lettered, then the batch is committed
+	assert.ElementsMatch(t, []string{"first", "last"}, esRepo.indexed)
+	letters := dlq.published()
+	require.Len(t, letters, 1)
+	assert.Equal(t, int64(1), letters[0].SourceOffset)
+	assert.Equal(t, 2, letters[0].Attempts)
+	assert.Equal(t, []byte("payment-service"), letters[0].Key)
+	assert.Equal(t, []int64{2}, session.markedOffsets())
+	assert.Equal(t, int64(1), consumer.Stats().DeadLettered)
+}
+
+func TestConsumeClaim_DropsRejectedEntryWithoutDLQ(t *testing.T) {
+	esRepo := &rejectingESRepo{reject: "bad"}
+	consumer := newTestConsumer(&countingLogRepo{}, esRepo)
+
+	session := &fakeSession{ctx: context.Background()}
+	claim := &fakeClaim{messages: make(chan *sarama.ConsumerMessage, 3)}
+	claim.messages <- logMessageWith(t, 0, "first")
+	claim.messages <- logMessageWith(t, 1, "bad")
+	claim.messages <- logMessageWith(t, 2, "last")
+	close(claim.messages)
+
+	require.NoError(t, consumer.ConsumeClaim(session, claim))
+
+	// The rejected entry no longer blocks the partition: it is dropped and committed past
+	assert.ElementsMatch(t, []string{"first", "last"}, esRepo.indexed)
+	assert.Equal(t, []int64{2}, session.markedOffsets())
+	assert.Equal(t, int64(0), consumer.Stats().DeadLettered)
+}
+
+func TestConsumeClaim_OutageIsNotDeadLettered(t *testing.T) {
+	dlq := &memDeadLetters{}
+	esRepo := &flakyESRepo{failures: -1}
+	consumer := newTestConsumerWithDLQ(&countingLogRepo{}, esRepo, dlq)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	session := &fakeSession{ctx: ctx}
+	claim := &fakeClaim{messages: make(chan *sarama.ConsumerMessage, 3)}
+	for i := int64(0); i < 3; i++ {
+		claim.messages <- logMessage(t, i)
+	}
+
+	done := make(chan error, 1)
+	go func() { done <- consumer.ConsumeClaim(session, claim) }()
+
+	// Several isolation rounds pass without any entry going through
+	require.Eventually(t, func() bool { return esRepo.callCount() >= 20 }, time.Second, time.Millisecond)
+	cancel()
+	require.NoError(t, <-done)
+
+	assert.Empty(t, dlq.published())
+	assert.Empty(t, session.markedOffsets())
+}
+
+// failingLogRepo fails Create with err for entries whose message is fail
+type failingLogRepo struct {
+	countingLogRepo
+	fail string
+	err  error
+}
+
+func (r *failingLogRepo) Create(ctx context.Context, entry *domain.LogEntry) error {
+	if entry.Message == r.fail {
+		return r.err
+	}
+	return r.countingLogRepo.Create(ctx, entry)
+}
+
+func TestConsumeClaim_TransientEntryFailureIsNotDeadLettered(t *testing.T) {
+	dlq := &memDeadLetters{}
+	logRepo := &failingLogRepo{fail: "flaky", err: errors.New("driver: bad connection")}
+	consumer := newTestConsumerWithDLQ(logRepo, &rejectingESRepo{}, dlq)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	session := &fakeSession{ctx: ctx}
+	claim := &fakeClaim{messages: make(chan *sarama.ConsumerMessage, 3)}
+	claim.messages <- logMessageWith(t, 0, "first")
+	claim.messages <- logMessageWith(t, 1, "flaky")
+	claim.messages <- logMessageWith(t, 2, "last")
+
+	done := make(chan error, 1)
+	go func() { done <- consumer.ConsumeClaim(session, claim) }()
+
+	// The other entries go through on their own; the failing one is retried
+	require.Eventually(t, func() bool {
+		logRepo.mu.Lock()
+		defer logRepo.mu.Unlock()
+		return logRepo.creates >= 2
+	}, time.Second, time.Millisecond)
+	time.Sleep(20 * time.Millisecond) // Several more isolation rounds
+	cancel()
+	require.NoError(t, <-done)
+
+	assert.Empty(t, dlq.published())
+	assert.Empty(t, session.markedOffsets())
+}
+
+func TestConsumeClaim_OpenBreakerSkipsES(t *testing.T) {
+	esRepo := &flakyESRepo{failures: -1}
+	consumer := newTestConsumer(&countingLogRepo{}, esRepo)
+	consumer.resilience.ESBreaker = resilience.NewBreaker("elasticsearch", 2, time.Hour)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	session := &fakeSession{ctx: ctx}
+	claim := &fakeClaim{messages: make(chan *sarama.ConsumerMessage, 3)}
+	for i := int64(0); i < 3; i++ {
+		claim.messages <- logMessage(t, i)
+	}
+
+	done := make(chan error, 1)
+	go func() { done <- consumer.ConsumeClaim(session, claim) }()
+
+	require.Eventually(t, func() bool {
+		return consumer.resilience.ESBreaker.State() == resilience.StateOpen
+	}, time.Second, time.Millisecond)
+	time.Sleep(20 * time.Millisecond) // Several more flush attempts
+	cancel()
+	require.NoError(t, <-done)
+
+	// Once open, retries fail fast without reaching ES
+	assert.Equal(t, 2, esRepo.callCount())
+	assert.Empty(t, session.markedOffsets())
+}
+
+func TestConsumeClaim_DecodesMixedVersions(t *testing.T) {
+	esRepo := &rejectingESRepo{}
+	consumer := newTestConsumer(&countingLogRepo{}, esRepo)
+
+	entry := &domain.LogEntry{ServiceName: "payment-service", Level: "INFO"}
+	enveloped := func(offset int64, contentType, message string) *sarama.ConsumerMessage {
+		entry.Message = message
+		value, err := envelope.Encoder{ContentType: contentType}.Encode(entry, time.Now())
+		require.NoError(t, err)
+		return &sarama.ConsumerMessage{Topic: "logs", Offset: offset, Value: value, Headers: []*sarama.RecordHeader{
+			{Key: []byte(envelope.HeaderContentType), Value: []byte(contentType)},
+		}}
+	}
+
+	session := &fakeSession{ctx: context.Background()}
+	claim := &fakeClaim{messages: make(chan *sarama.ConsumerMessage, 3)}
+	claim.messages <- logMessageWith(t, 0, "legacy")
+	claim.messages <- enveloped(1, envelope.ContentTypeJSON, "json")
+	claim.messages <- enveloped(2, envelope.ContentTypeProtobuf, "protobuf")
+	close(claim.messages)
+
+	require.NoError(t, consumer.ConsumeClaim(session, claim))
+
+	assert.Equal(t, []string{"legacy", "json", "protobuf"}, esRepo.indexed)
+	assert.Equal(t, []int64{2}, session.markedOffsets())
+}
@@ -0,0 +1,261 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/IBM/sarama"
+	"github.com/Yupoer/logpulse/internal/domain"
+	"github.com/Yupoer/logpulse/internal/envelope"
+)
+
+// Headers carried by every dead-lettered message
+const (
+	headerDLQError           = "x-dlq-error"
+	headerDLQSourceTopic     = "x-dlq-source-topic"
+	headerDLQSourcePartition = "x-dlq-source-partition"
+	headerDLQSourceOffset    = "x-dlq-source-offset"
+	headerDLQAttempts        = "x-dlq-attempts"
+	headerDLQFailedAt        = "x-dlq-failed-at"
+	headerDLQContentType     = "x-dlq-content-type"
+	// Set on replayed messages, points back at the dead letter ("partition/offset")
+	headerDLQReplayedFrom = "x-dlq-replayed-from"
+)
+
+// dlqReadTimeout bounds how long a read waits for a message that should exist
+const dlqReadTimeout = 5 * time.Second
+
+// offsetReader is the part of sarama.Client used to find partition bounds
+type offsetReader interface {
+	GetOffset(topic string, partitionID int32, time int64) (int64, error)
+}
+
+type kafkaDeadLetterQueue struct {
+	topic    string
+	producer sarama.SyncProducer
+	consumer sarama.Consumer
+	offsets  offsetReader
+	client   sarama.Client // nil when built from parts
+}
+
+// NewKafkaDeadLetterQueue keeps dead letters in a Kafka topic. The topic is
+// append-only: replaying a message leaves the dead letter in place until
+// the topic's retention removes it.
+func NewKafkaDeadLetterQueue(brokers []string, topic string) (domain.DeadLetterQueue, error) {
+	config := sarama.NewConfig()
+	config.Producer.Return.Successes = true
+	config.Producer.RequiredAcks = sarama.WaitForAll
+	config.Producer.Retry.Max = 5
+
+	client, err := sarama.NewClient(brokers, config)
+	if err != nil {
+		return nil, err
+	}
+	producer, err := sarama.NewSyncProducerFromClient(client)
+	if err != nil {
+		_ = client.Close()
+		return nil, err
+	}
+	consumer, err := sarama.NewConsumerFromClient(client)
+	if err != nil {
+		_ = client.Close()
+		return nil, err
+	}
+
+	q := newKafkaDeadLetterQueue(topic, producer, consumer, client)
+	q.client = client
+	return q, nil
+}
+
+func newKafkaDeadLetterQueue(topic string, producer sarama.SyncProducer, consumer sarama.Consumer, offsets offsetReader) *kafkaDeadLetterQueue {
+	return &kafkaDeadLetterQueue{topic: topic, producer: producer, consumer: consumer, offsets: offsets}
+}
+
+func (q *kafkaDeadLetterQueue) Publish(ctx context.Context, letter *domain.DeadLetter) error {
+	msg := &sarama.ProducerMessage{
+		Topic: q.topic,
+		Value: sarama.ByteEncoder(letter.Value),
+		Headers: []sarama.RecordHeader{
+			{Key: []byte(headerDLQError), Value: []byte(letter.Error)},
+			{Key: []byte(headerDLQSourceTopic), Value: []byte(letter.SourceTopic)},
+			{Key: []byte(headerDLQSourcePartition), Value: []byte(strconv.Itoa(int(letter.SourcePartition)))},
+			{Key: []byte(headerDLQSourceOffset), Value: []byte(strconv.FormatInt(letter.SourceOffset, 10))},
+			{Key: []byte(headerDLQAttempts), Value: []byte(strconv.Itoa(letter.Attempts))},
+			{Key: []byte(headerDLQFailedAt), Value: []byte(letter.FailedAt.UTC().Format(time.RFC3339Nano))},
+		},
+	}
+	if letter.ContentType != "" {
+		msg.Headers = append(msg.Headers, sarama.RecordHeader{Key: []byte(headerDLQContentType), Value: []byte(letter.ContentType)})
+	}
+	if letter.RequestID != "" {
+		msg.Headers = append(msg.Headers, sarama.RecordHeader{Key: []byte(envelope.HeaderRequestID), Value: []byte(letter.RequestID)})
+	}
+	if letter.Key != nil {
+		msg.Key = sarama.ByteEncoder(letter.Key)
+	}
+
+	_, _, err := q.producer.SendMessage(msg)
+	return err
+}
+
+func (q *kafkaDeadLetterQueue) List(ctx context.Context, limit int) ([]*domain.DeadLetter, error) {
+	partitions, err := q.consumer.Partitions(q.topic)
+	if err != nil {
+		return nil, err
+	}
+
+	letters := []*domain.DeadLetter{}
+	for _, partition := range partitions {
+		oldest, err := q.offsets.GetOffset(q.topic, partition, sarama.OffsetOldest)
+		if err != nil {
+			return nil, err
+		}
+		newest, err := q.offsets.GetOffset(q.topic, partition, sarama.OffsetNewest)
+		if err != nil {
+			return nil, err
+		}
+		if newest <= oldest {
+			continue // Empty partition
+		}
+
+		start := max(oldest, newest-int64(limit))
+		msgs, err := q.read(ctx, partition, start, int(newest-start))
+		if err != nil {
+			return nil, err
+		}
+		for _, msg := range msgs {
+			letters = append(letters, toDeadLetter(msg))
+		}
+	}
+
+	// Most recent failures first
+	sort.SliceStable(letters, func(i, j int) bool { return letters[i].FailedAt.After(letters[j].FailedAt) })
+	return letters, nil
+}
+
+func (q *kafkaDeadLetterQueue) Get(ctx context.Context, partition int32, offset int64) (*domain.DeadLetter, error) {
+	oldest, err := q.offsets.GetOffset(q.topic, partition, sarama.OffsetOldest)
+	if err != nil {
+		return nil, err
+	}
+	newest, err := q.offsets.GetOffset(q.topic, partition, sarama.OffsetNewest)
+	if err != nil {
+		return nil, err
+	}
+	if offset < oldest || offset >= newest {
+		return nil, domain.ErrDeadLetterNotFound
+	}
+
+	msgs, err := q.read(ctx, partition, offset, 1)
+	if err != nil {
+		return nil, err
+	}
+	return toDeadLetter(msgs[0]), nil
+}
+
+func (q *kafkaDeadLetterQueue) Replay(ctx context.Context, partition int32, offset int64) error {
+	letter, err := q.Get(ctx, partition, offset)
+	if err != nil {
+		return err
+	}
+	if letter.SourceTopic == "" {
+		return fmt.Errorf("dead letter %d/%d has no source topic", partition, offset)
+	}
+
+	msg := &sarama.ProducerMessage{
+		Topic: letter.SourceTopic,
+		Value: sarama.ByteEncoder(letter.Value),
+		Headers: []sarama.RecordHeader{
+			{Key: []byte(headerDLQReplayedFrom), Value: []byte(fmt.Sprintf("%d/%d", partition, offset))},
+		},
+	}
+	// Keep the original format, the consumer decodes by content type
+	if letter.ContentType != "" {
+		msg.Headers = append(msg.Headers, sarama.RecordHeader{Key: []byte(envelope.HeaderContentType), Value: []byte(letter.ContentType)})
+	}
+	if letter.RequestID != "" {
+		msg.Headers = append(msg.Headers, sarama.RecordHeader{Key: []byte(envelope.HeaderRequestID), Value: []byte(letter.RequestID)})
+	}
+	if letter.Key != nil {
+		msg.Key = sarama.ByteEncoder(letter.Key)
+	}
+
+	_, _, err = q.producer.SendMessage(msg)
+	return err
+}
+
+func (q *kafkaDeadLetterQueue) Close() error {
+	if err := q.consumer.Close(); err != nil {
+		return err
+	}
+	if err := q.producer.Close(); err != nil {
+		return err
+	}
+	if q.client != nil {
+		return q.client.Close()
+	}
+	return nil
+}
+
+// read returns count consecutive messages starting at offset
+func (q *kafkaDeadLetterQueue) read(ctx context.Context, partition int32, offset int64, count int) ([]*sarama.ConsumerMessage, error) {
+	pc, err := q.consumer.ConsumePartition(q.topic, partition, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = pc.Close() }()
+
+	timeout := time.NewTimer(dlqReadTimeout)
+	defer timeout.Stop()
+
+	msgs := make([]*sarama.ConsumerMessage, 0, count)
+	for len(msgs) < count {
+		select {
+		case msg := <-pc.Messages():
+			msgs = append(msgs, msg)
+		case cerr := <-pc.Errors():
+			return nil, cerr
+		case <-timeout.C:
+			return nil, errors.New("timed out reading dead-letter topic")
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	return msgs, nil
+}
+
+func toDeadLetter(msg *sarama.ConsumerMessage) *domain.DeadLetter {
+	letter := &domain.DeadLetter{
+		Partition: msg.Partition,
+		Offset:    msg.Offset,
+		Key:       msg.Key,
+		Value:     msg.Value,
+	}
+	for _, h := range msg.Headers {
+		value := string(h.Value)
+		switch string(h.Key) {
+		case headerDLQError:
+			letter.Error = value
+		case headerDLQSourceTopic:
+			letter.SourceTopic = value
+		case headerDLQSourcePartition:
+			p, _ := strconv.Atoi(value)
+			letter.SourcePartition = int32(p)
+		case headerDLQSourceOffset:
+			letter.SourceOffset, _ = strconv.ParseInt(value, 10, 64)
+		case headerDLQAttempts:
+			letter.Attempts, _ = strconv.Atoi(value)
+		case headerDLQFailedAt:
+			letter.FailedAt, _ = time.Parse(time.RFC3339Nano, value)
+		case headerDLQContentType:
+			letter.ContentType = value
+		case envelope.HeaderRequestID:
+			letter.RequestID = value
+		}
+	}
+	return letter
+}
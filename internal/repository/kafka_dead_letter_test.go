@@ -0,0 +1,121 @@
+package repository
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/IBM/sarama"
+	"github.com/IBM/sarama/mocks"
+	"github.com/Yupoer/logpulse/internal/domain"
+	"github.com/Yupoer/logpulse/internal/envelope"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fixedOffsets reports the same [oldest, newest) range for every partition
+type fixedOffsets struct {
+	oldest, newest int64
+}
+
+func (o fixedOffsets) GetOffset(topic string, partition int32, time int64) (int64, error) {
+	if time == sarama.OffsetOldest {
+		return o.oldest, nil
+	}
+	return o.newest, nil
+}
+
+func producerHeader(headers []sarama.RecordHeader, key string) string {
+	for _, h := range headers {
+		if string(h.Key) == key {
+			return string(h.Value)
+		}
+	}
+	return ""
+}
+
+func TestKafkaDeadLetterQueue_PublishSetsHeaders(t *testing.T) {
+	producer := mocks.NewSyncProducer(t, nil)
+	producer.ExpectSendMessageWithMessageCheckerFunctionAndSucceed(func(msg *sarama.ProducerMessage) error {
+		assert.Equal(t, "logs_topic-dlq", msg.Topic)
+		assert.Equal(t, "json: invalid character", producerHeader(msg.Headers, headerDLQError))
+		assert.Equal(t, "logs_topic", producerHeader(msg.Headers, headerDLQSourceTopic))
+		assert.Equal(t, "2", producerHeader(msg.Headers, headerDLQSourcePartition))
+		assert.Equal(t, "42", producerHeader(msg.Headers, headerDLQSourceOffset))
+		assert.Equal(t, "5", producerHeader(msg.Headers, headerDLQAttempts))
+		assert.Equal(t, "req-42", producerHeader(msg.Headers, envelope.HeaderRequestID))
+		return nil
+	})
+	q := newKafkaDeadLetterQueue("logs_topic-dlq", producer, mocks.NewConsumer(t, nil), fixedOffsets{})
+
+	err := q.Publish(context.Background(), &domain.DeadLetter{
+		SourceTopic:     "logs_topic",
+		SourcePartition: 2,
+		SourceOffset:    42,
+		Error:           "json: invalid character",
+		Attempts:        5,
+		FailedAt:        time.Now(),
+		Value:           []byte("{bad"),
+		RequestID:       "req-42",
+	})
+	require.NoError(t, err)
+	require.NoError(t, producer.Close())
+}
+
+func TestKafkaDeadLetterQueue_GetAndReplay(t *testing.T) {
+	failedAt := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	dead := &sarama.ConsumerMessage{
+		Topic: "logs_topic-dlq", Partition: 0, Offset: 7,
+		Key:   []byte("payment-service"),
+		Value: []byte(`{"message":"boom"}`),
+		Headers: []*sarama.RecordHeader{
+			{Key: []byte(headerDLQError), Value: []byte("rejected")},
+			{Key: []byte(headerDLQSourceTopic), Value: []byte("logs_topic")},
+			{Key: []byte(headerDLQSourcePartition), Value: []byte("1")},
+			{Key: []byte(headerDLQSourceOffset), Value: []byte("99")},
+			{Key: []byte(headerDLQAttempts), Value: []byte("3")},
+			{Key: []byte(headerDLQFailedAt), Value: []byte(failedAt.Format(time.RFC3339Nano))},
+			{Key: []byte(envelope.HeaderRequestID), Value: []byte("req-42")},
+		},
+	}
+
+	// The mock consumer serves each partition once, so Get and Replay use their own
+	newConsumer := func() sarama.Consumer {
+		consumer := mocks.NewConsumer(t, nil)
+		consumer.ExpectConsumePartition("logs_topic-dlq", 0, 7).YieldMessage(dead)
+		return consumer
+	}
+	offsets := fixedOffsets{oldest: 0, newest: 8}
+
+	producer := mocks.NewSyncProducer(t, nil)
+	producer.ExpectSendMessageWithMessageCheckerFunctionAndSucceed(func(msg *sarama.ProducerMessage) error {
+		assert.Equal(t, "logs_topic", msg.Topic)
+		assert.Equal(t, "0/7", producerHeader(msg.Headers, headerDLQReplayedFrom))
+		assert.Equal(t, "req-42", producerHeader(msg.Headers, envelope.HeaderRequestID))
+		value, err := msg.Value.Encode()
+		require.NoError(t, err)
+		assert.Equal(t, `{"message":"boom"}`, string(value))
+		return nil
+	})
+
+	q := newKafkaDeadLetterQueue("logs_topic-dlq", producer, newConsumer(), offsets)
+	ctx := context.Background()
+
+	letter, err := q.Get(ctx, 0, 7)
+	require.NoError(t, err)
+	assert.Equal(t, "logs_topic", letter.SourceTopic)
+	assert.Equal(t, int32(1), letter.SourcePartition)
+	assert.Equal(t, int64(99), letter.SourceOffset)
+	assert.Equal(t, 3, letter.Attempts)
+	assert.Equal(t, "rejected", letter.Error)
+	assert.True(t, failedAt.Equal(letter.FailedAt))
+	assert.Equal(t, "req-42", letter.RequestID)
+
+	// Outside the partition's retained range
+	_, err = q.Get(ctx, 0, 8)
+	assert.ErrorIs(t, err, domain.ErrDeadLetterNotFound)
+
+	replayer := newKafkaDeadLetterQueue("logs_topic-dlq", producer, newConsumer(), offsets)
+	require.NoError(t, replayer.Replay(ctx, 0, 7))
+	require.NoError(t, producer.Close())
+}
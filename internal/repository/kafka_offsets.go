@@ -0,0 +1,97 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/IBM/sarama"
+	"github.com/Yupoer/logpulse/internal/domain"
+)
+
+// groupOffsetLister is the part of sarama.ClusterAdmin used to read commits
+type groupOffsetLister interface {
+	ListConsumerGroupOffsets(group string, topicPartitions map[string][]int32) (*sarama.OffsetFetchResponse, error)
+	Close() error
+}
+
+// partitionOffsets is the part of sarama.Client used to find partitions and their ends
+type partitionOffsets interface {
+	Partitions(topic string) ([]int32, error)
+	GetOffset(topic string, partitionID int32, time int64) (int64, error)
+}
+
+type kafkaOffsetInspector struct {
+	topic  string
+	group  string
+	client partitionOffsets
+	admin  groupOffsetLister
+}
+
+// NewKafkaOffsetInspector reports the lag of group on every partition of topic
+func NewKafkaOffsetInspector(brokers []string, topic, group string) (domain.OffsetInspector, error) {
+	client, err := sarama.NewClient(brokers, sarama.NewConfig())
+	if err != nil {
+		return nil, err
+	}
+	admin, err := sarama.NewClusterAdminFromClient(client)
+	if err != nil {
+		_ = client.Close()
+		return nil, err
+	}
+	return newKafkaOffsetInspector(topic, group, client, admin), nil
+}
+
+func newKafkaOffsetInspector(topic, group string, client partitionOffsets, admin groupOffsetLister) *kafkaOffsetInspector {
+	return &kafkaOffsetInspector{topic: topic, group: group, client: client, admin: admin}
+}
+
+// Close closes the admin, which also closes the client it was built from
+func (i *kafkaOffsetInspector) Close() error {
+	return i.admin.Close()
+}
+
+func (i *kafkaOffsetInspector) PartitionLags(ctx context.Context) ([]domain.PartitionLag, error) {
+	partitions, err := i.client.Partitions(i.topic)
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(partitions, func(a, b int) bool { return partitions[a] < partitions[b] })
+
+	committed, err := i.admin.ListConsumerGroupOffsets(i.group, map[string][]int32{i.topic: partitions})
+	if err != nil {
+		return nil, err
+	}
+	if committed.Err != sarama.ErrNoError {
+		return nil, committed.Err
+	}
+
+	lags := make([]domain.PartitionLag, 0, len(partitions))
+	for _, partition := range partitions {
+		highWater, err := i.client.GetOffset(i.topic, partition, sarama.OffsetNewest)
+		if err != nil {
+			return nil, err
+		}
+
+		lag := domain.PartitionLag{Group: i.group, Topic: i.topic, Partition: partition, Committed: -1, HighWater: highWater}
+		if block := committed.GetBlock(i.topic, partition); block != nil {
+			if block.Err != sarama.ErrNoError {
+				return nil, fmt.Errorf("partition %d: %w", partition, block.Err)
+			}
+			lag.Committed = block.Offset
+		}
+
+		if lag.Committed >= 0 {
+			lag.Lag = highWater - lag.Committed
+		} else {
+			// Nothing committed yet: the group starts from the oldest retained offset
+			oldest, err := i.client.GetOffset(i.topic, partition, sarama.OffsetOldest)
+			if err != nil {
+				return nil, err
+			}
+			lag.Lag = highWater - oldest
+		}
+		lags = append(lags, lag)
+	}
+	return lags, nil
+}
@@ -0,0 +1,73 @@
+package repository
+
+import (
+	"context"
+	"testing"
+
+	"github.com/IBM/sarama"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakePartitionOffsets serves fixed partition bounds
+type fakePartitionOffsets struct {
+	partitions []int32
+	oldest     map[int32]int64
+	newest     map[int32]int64
+}
+
+func (f *fakePartitionOffsets) Partitions(topic string) ([]int32, error) { return f.partitions, nil }
+
+func (f *fakePartitionOffsets) GetOffset(topic string, partition int32, time int64) (int64, error) {
+	if time == sarama.OffsetOldest {
+		return f.oldest[partition], nil
+	}
+	return f.newest[partition], nil
+}
+
+// fakeGroupOffsets serves fixed commits; partitions without one are left out
+type fakeGroupOffsets struct {
+	committed map[int32]int64
+	group     string
+}
+
+func (f *fakeGroupOffsets) ListConsumerGroupOffsets(group string, topicPartitions map[string][]int32) (*sarama.OffsetFetchResponse, error) {
+	f.group = group
+	res := &sarama.OffsetFetchResponse{}
+	for topic, partitions := range topicPartitions {
+		for _, partition := range partitions {
+			if offset, ok := f.committed[partition]; ok {
+				res.AddBlock(topic, partition, &sarama.OffsetFetchResponseBlock{Offset: offset})
+			}
+		}
+	}
+	return res, nil
+}
+
+func (f *fakeGroupOffsets) Close() error { return nil }
+
+func TestPartitionLags(t *testing.T) {
+	client := &fakePartitionOffsets{
+		partitions: []int32{2, 0, 1},
+		oldest:     map[int32]int64{0: 0, 1: 0, 2: 40},
+		newest:     map[int32]int64{0: 100, 1: 50, 2: 70},
+	}
+	admin := &fakeGroupOffsets{committed: map[int32]int64{0: 90, 1: 50}}
+	inspector := newKafkaOffsetInspector("logs", "logpulse-group", client, admin)
+
+	lags, err := inspector.PartitionLags(context.Background())
+	require.NoError(t, err)
+
+	assert.Equal(t, "logpulse-group", admin.group)
+	require.Len(t, lags, 3)
+	assert.Equal(t, "logpulse-group", lags[0].Group)
+	assert.Equal(t, int32(0), lags[0].Partition)
+	assert.Equal(t, int64(90), lags[0].Committed)
+	assert.Equal(t, int64(100), lags[0].HighWater)
+	assert.Equal(t, int64(10), lags[0].Lag)
+	// Caught up
+	assert.Equal(t, int64(0), lags[1].Lag)
+	// Never committed: lag counts every retained message
+	assert.Equal(t, int64(-1), lags[2].Committed)
+	assert.Equal(t, int64(30), lags[2].Lag)
+}
@@ -0,0 +1,57 @@
+package repository
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/IBM/sarama"
+)
+
+// KafkaPinger checks that a broker answers metadata requests for topic.
+// The client is created on first use, so a broker that is down at startup
+// shows up as a failing check instead of a startup error.
+type KafkaPinger struct {
+	brokers []string
+	topic   string
+	timeout time.Duration
+
+	mu     sync.Mutex
+	client sarama.Client
+}
+
+func NewKafkaPinger(brokers []string, topic string, timeout time.Duration) *KafkaPinger {
+	return &KafkaPinger{brokers: brokers, topic: topic, timeout: timeout}
+}
+
+// Ping refreshes topic's metadata. Sarama calls don't take a context; ctx
+// only bounds the wait for a free client.
+func (p *KafkaPinger) Ping(ctx context.Context) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if p.client == nil {
+		cfg := sarama.NewConfig()
+		cfg.Net.DialTimeout = p.timeout
+		cfg.Net.ReadTimeout = p.timeout
+		cfg.Net.WriteTimeout = p.timeout
+		cfg.Metadata.Retry.Max = 0 // The next probe is the retry
+		client, err := sarama.NewClient(p.brokers, cfg)
+		if err != nil {
+			return err
+		}
+		p.client = client
+	}
+	return p.client.RefreshMetadata(p.topic)
+}
+
+func (p *KafkaPinger) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.client == nil {
+		return nil
+	}
+	return p.client.Close()
+}
@@ -2,26 +2,38 @@ package repository
 
 import (
 	"context"
-	"encoding/json"
-	"log"
+	"log/slog"
+	"strconv"
+	"time"
 
 	"github.com/IBM/sarama"
+	"github.com/Yupoer/logpulse/internal/config"
 	"github.com/Yupoer/logpulse/internal/domain"
+	"github.com/Yupoer/logpulse/internal/envelope"
+	"github.com/Yupoer/logpulse/internal/logging"
+	"github.com/Yupoer/logpulse/internal/resilience"
+	"github.com/Yupoer/logpulse/internal/tracing"
 )
 
 type kafkaProducer struct {
 	producer sarama.SyncProducer
 	topic    string
+	encoder  envelope.Encoder
+	breaker  *resilience.Breaker
+	retry    resilience.RetryPolicy
 }
 
-// NewKafkaProducer initializes a new Sarama SyncProducer.
-func NewKafkaProducer(brokers []string, topic string) (domain.LogProducer, error) {
-	config := sarama.NewConfig()
-	config.Producer.Return.Successes = true          // Must be true for SyncProducer
-	config.Producer.RequiredAcks = sarama.WaitForAll // Strongest consistency guarantee
-	config.Producer.Retry.Max = 5                    // Retry up to 5 times on failure
+// NewKafkaProducer initializes a new Sarama SyncProducer. Logs are wrapped in
+// a versioned envelope written by encoder. Failed sends are retried under
+// the retry policy; while breaker is open SendLog fails fast with
+// resilience.ErrCircuitOpen.
+func NewKafkaProducer(brokers []string, topic string, cfg config.KafkaProducerConfig, encoder envelope.Encoder, breaker *resilience.Breaker, retry resilience.RetryPolicy) (domain.LogProducer, error) {
+	saramaConfig, err := syncProducerConfig(cfg, retry)
+	if err != nil {
+		return nil, err
+	}
 
-	producer, err := sarama.NewSyncProducer(brokers, config)
+	producer, err := sarama.NewSyncProducer(brokers, saramaConfig)
 	if err != nil {
 		return nil, err
 	}
@@ -29,34 +41,91 @@ func NewKafkaProducer(brokers []string, topic string) (domain.LogProducer, error
 	return &kafkaProducer{
 		producer: producer,
 		topic:    topic,
+		encoder:  encoder,
+		breaker:  breaker,
+		retry:    retry,
 	}, nil
 }
 
-func (p *kafkaProducer) SendLog(ctx context.Context, entry *domain.LogEntry) error {
-	// 1. Serialize struct to JSON
-	bytes, err := json.Marshal(entry)
+func (p *kafkaProducer) SendLog(ctx context.Context, entry *domain.LogEntry) (err error) {
+	// 1. Wrap in a versioned envelope
+	bytes, err := p.encoder.Encode(entry, time.Now())
 	if err != nil {
 		return err
 	}
 
-	// 2. Build Kafka Message
+	// 2. Build Kafka Message, carrying the request ID and trace context in its headers
+	span, carrier := startSendSpan(ctx, "kafka", p.topic)
+	defer func() { tracing.End(span, err) }()
 	msg := &sarama.ProducerMessage{
 		Topic: p.topic,
 		// Using ServiceName as Key ensures logs from the same service go to the same partition (Ordering Guarantee)
-		Key:   sarama.StringEncoder(entry.ServiceName),
-		Value: sarama.ByteEncoder(bytes),
+		Key:     sarama.StringEncoder(entry.ServiceName),
+		Value:   sarama.ByteEncoder(bytes),
+		Headers: messageHeaders(ctx, p.encoder, carrier),
 	}
 
 	// 3. Send Message
-	partition, offset, err := p.producer.SendMessage(msg)
+	var partition int32
+	var offset int64
+	err = resilience.Retry(ctx, p.retry, func(ctx context.Context) error {
+		return p.breaker.Do(func() error {
+			var sendErr error
+			partition, offset, sendErr = p.producer.SendMessage(msg)
+			return sendErr
+		})
+	})
 	if err != nil {
 		return err
 	}
 
-	log.Printf("Message sent to partition %d at offset %d", partition, offset)
+	slog.DebugContext(ctx, "Message sent", "topic", p.topic, "partition", partition, "offset", offset)
 	return nil
 }
 
 func (p *kafkaProducer) Close() error {
 	return p.producer.Close()
 }
+
+// messageHeaders are the headers of every log message: the envelope format,
+// plus ctx's request ID and the send span's trace context (carrier)
+func messageHeaders(ctx context.Context, encoder envelope.Encoder, carrier map[string]string) []sarama.RecordHeader {
+	headers := []sarama.RecordHeader{
+		{Key: []byte(envelope.HeaderContentType), Value: []byte(encoder.ContentType)},
+		{Key: []byte(envelope.HeaderSchemaVersion), Value: []byte(strconv.Itoa(envelope.SchemaVersion))},
+	}
+	if id := logging.RequestID(ctx); id != "" {
+		headers = append(headers, sarama.RecordHeader{Key: []byte(envelope.HeaderRequestID), Value: []byte(id)})
+	}
+	return append(headers, traceHeaders(carrier)...)
+}
+
+// syncProducerConfig is newProducerConfig for the sync producer. A retry
+// policy of more than one attempt replaces Sarama's own retries, so one
+// SendLog makes at most retry.MaxAttempts sends rather than the product of
+// both retry counts.
+func syncProducerConfig(cfg config.KafkaProducerConfig, retry resilience.RetryPolicy) (*sarama.Config, error) {
+	saramaConfig, err := newProducerConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+	if retry.MaxAttempts > 1 {
+		saramaConfig.Producer.Retry.Max = 0
+	}
+	return saramaConfig, nil
+}
+
+// newProducerConfig holds the settings shared by the sync and async producers
+func newProducerConfig(cfg config.KafkaProducerConfig) (*sarama.Config, error) {
+	saramaConfig := sarama.NewConfig()
+	saramaConfig.Producer.Return.Successes = true          // Needed by SyncProducer and for async delivery reports
+	saramaConfig.Producer.RequiredAcks = sarama.WaitForAll // Strongest consistency guarantee
+	saramaConfig.Producer.Retry.Max = 5                    // Retry up to 5 times on failure
+
+	if cfg.Compression != "" {
+		if err := saramaConfig.Producer.Compression.UnmarshalText([]byte(cfg.Compression)); err != nil {
+			return nil, err
+		}
+	}
+	return saramaConfig, nil
+}
@@ -0,0 +1,114 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/IBM/sarama"
+	"github.com/IBM/sarama/mocks"
+	"github.com/Yupoer/logpulse/internal/config"
+	"github.com/Yupoer/logpulse/internal/domain"
+	"github.com/Yupoer/logpulse/internal/envelope"
+	"github.com/Yupoer/logpulse/internal/logging"
+	"github.com/Yupoer/logpulse/internal/resilience"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestKafkaProducer_RetriesThenFailsFast(t *testing.T) {
+	errBroker := errors.New("leader not available")
+	mock := mocks.NewSyncProducer(t, nil)
+	mock.ExpectSendMessageAndFail(errBroker)
+	mock.ExpectSendMessageAndSucceed()
+	mock.ExpectSendMessageAndFail(errBroker)
+	mock.ExpectSendMessageAndFail(errBroker)
+
+	p := &kafkaProducer{
+		producer: mock,
+		topic:    "logs_topic",
+		encoder:  envelope.Encoder{ContentType: envelope.ContentTypeJSON},
+		breaker:  resilience.NewBreaker("kafka", 2, time.Hour),
+		retry:    resilience.RetryPolicy{MaxAttempts: 2, Backoff: resilience.Backoff{Initial: time.Millisecond}},
+	}
+	ctx := context.Background()
+	entry := &domain.LogEntry{ServiceName: "payment-service", Level: "INFO", Message: "ok"}
+
+	// A transient failure is retried
+	require.NoError(t, p.SendLog(ctx, entry))
+
+	// Two more failures open the breaker; later sends don't reach Kafka
+	assert.ErrorIs(t, p.SendLog(ctx, entry), errBroker)
+	assert.ErrorIs(t, p.SendLog(ctx, entry), resilience.ErrCircuitOpen)
+	assert.Equal(t, resilience.StateOpen, p.breaker.State())
+
+	require.NoError(t, mock.Close())
+}
+
+func TestSyncProducerConfig_OneRetryLayer(t *testing.T) {
+	withPolicy, err := syncProducerConfig(config.KafkaProducerConfig{}, resilience.RetryPolicy{MaxAttempts: 3})
+	require.NoError(t, err)
+	assert.Equal(t, 0, withPolicy.Producer.Retry.Max, "the policy retries instead of Sarama")
+
+	withoutPolicy, err := syncProducerConfig(config.KafkaProducerConfig{}, resilience.RetryPolicy{MaxAttempts: 1})
+	require.NoError(t, err)
+	assert.Equal(t, 5, withoutPolicy.Producer.Retry.Max)
+}
+
+func TestKafkaProducer_SendsEnvelope(t *testing.T) {
+	mock := mocks.NewSyncProducer(t, nil)
+	mock.ExpectSendMessageWithMessageCheckerFunctionAndSucceed(func(msg *sarama.ProducerMessage) error {
+		assert.Equal(t, envelope.ContentTypeProtobuf, producerHeader(msg.Headers, envelope.HeaderContentType))
+		assert.Equal(t, "1", producerHeader(msg.Headers, envelope.HeaderSchemaVersion))
+
+		value, err := msg.Value.Encode()
+		require.NoError(t, err)
+		env, err := envelope.Decode(envelope.ContentTypeProtobuf, value)
+		require.NoError(t, err)
+		assert.Equal(t, "api-1", env.Source)
+		assert.False(t, env.IngestedAt.IsZero())
+		assert.Equal(t, "payment-service", env.Entry.ServiceName)
+		assert.Equal(t, "ok", env.Entry.Message)
+		return nil
+	})
+
+	p := &kafkaProducer{
+		producer: mock,
+		topic:    "logs_topic",
+		encoder:  envelope.Encoder{ContentType: envelope.ContentTypeProtobuf, Source: "api-1"},
+	}
+	entry := &domain.LogEntry{ServiceName: "payment-service", Level: "INFO", Message: "ok"}
+	require.NoError(t, p.SendLog(context.Background(), entry))
+	require.NoError(t, mock.Close())
+}
+
+func TestKafkaProducer_CarriesRequestID(t *testing.T) {
+	var sent *sarama.ProducerMessage
+	mock := mocks.NewSyncProducer(t, nil)
+	mock.ExpectSendMessageWithMessageCheckerFunctionAndSucceed(func(msg *sarama.ProducerMessage) error {
+		sent = msg
+		return nil
+	})
+	p := &kafkaProducer{producer: mock, topic: "logs_topic", encoder: envelope.Encoder{ContentType: envelope.ContentTypeJSON}}
+	ctx := logging.WithRequestID(context.Background(), "req-42")
+	require.NoError(t, p.SendLog(ctx, &domain.LogEntry{ServiceName: "payment-service"}))
+	require.NoError(t, mock.Close())
+
+	// The consumer reads it back into the message it logs about
+	var headers []*sarama.RecordHeader
+	for i := range sent.Headers {
+		headers = append(headers, &sent.Headers[i])
+	}
+	msg := fromSaramaMessage(&sarama.ConsumerMessage{Topic: "logs_topic", Headers: headers})
+	assert.Equal(t, "req-42", msg.RequestID)
+}
+
+func TestNewProducerConfig_Compression(t *testing.T) {
+	cfg, err := newProducerConfig(config.KafkaProducerConfig{Compression: "zstd"})
+	require.NoError(t, err)
+	assert.Equal(t, sarama.CompressionZSTD, cfg.Producer.Compression)
+
+	_, err = newProducerConfig(config.KafkaProducerConfig{Compression: "brotli"})
+	assert.Error(t, err)
+}
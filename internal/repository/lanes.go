@@ -0,0 +1,134 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+
+	"github.com/Yupoer/logpulse/internal/config"
+	"github.com/Yupoer/logpulse/internal/domain"
+)
+
+// RoutedLane is a lane's routing rule and the producer for its topic
+type RoutedLane struct {
+	Lane     config.LaneConfig
+	Producer domain.LogProducer
+}
+
+type laneRouter struct {
+	lanes    []RoutedLane
+	fallback domain.LogProducer
+}
+
+// NewLaneRouter sends each log to the first lane it matches, or to fallback
+// (the default topic). Close closes every lane's producer and fallback.
+func NewLaneRouter(lanes []RoutedLane, fallback domain.LogProducer) domain.LogProducer {
+	return &laneRouter{lanes: lanes, fallback: fallback}
+}
+
+func (r *laneRouter) SendLog(ctx context.Context, entry *domain.LogEntry) error {
+	for _, l := range r.lanes {
+		if laneMatches(l.Lane, entry) {
+			return l.Producer.SendLog(ctx, entry)
+		}
+	}
+	return r.fallback.SendLog(ctx, entry)
+}
+
+func (r *laneRouter) Close() error {
+	errs := []error{r.fallback.Close()}
+	for _, l := range r.lanes {
+		errs = append(errs, l.Producer.Close())
+	}
+	return errors.Join(errs...)
+}
+
+func laneMatches(lane config.LaneConfig, entry *domain.LogEntry) bool {
+	levelOK := len(lane.Levels) == 0
+	for _, level := range lane.Levels {
+		if strings.EqualFold(level, entry.Level) {
+			levelOK = true
+			break
+		}
+	}
+	serviceOK := len(lane.Services) == 0
+	for _, service := range lane.Services {
+		if service == entry.ServiceName {
+			serviceOK = true
+			break
+		}
+	}
+	return levelOK && serviceOK
+}
+
+type laneConsumers []domain.LogConsumer
+
+// NewLaneConsumers runs one consumer per lane as a single domain.LogConsumer.
+// Stats are summed over the lanes; BatchSize is the largest lane's.
+func NewLaneConsumers(consumers ...domain.LogConsumer) domain.LogConsumer {
+	if len(consumers) == 1 {
+		return consumers[0]
+	}
+	return laneConsumers(consumers)
+}
+
+func (c laneConsumers) Run(ctx context.Context) {
+	var wg sync.WaitGroup
+	for _, consumer := range c {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			consumer.Run(ctx)
+		}()
+	}
+	wg.Wait()
+}
+
+func (c laneConsumers) Stats() domain.ConsumerStats {
+	var total domain.ConsumerStats
+	for _, consumer := range c {
+		s := consumer.Stats()
+		total.BatchFill += s.BatchFill
+		total.BatchSize = max(total.BatchSize, s.BatchSize)
+		total.Claims += s.Claims
+		total.FlushedTotal += s.FlushedTotal
+		total.DBErrors += s.DBErrors
+		total.ESErrors += s.ESErrors
+		total.DeadLettered += s.DeadLettered
+		if s.LastFlushAt.After(total.LastFlushAt) {
+			total.LastFlushAt = s.LastFlushAt
+		}
+	}
+	return total
+}
+
+type laneOffsetInspectors []domain.OffsetInspector
+
+// NewLaneOffsetInspectors reports the partitions of every lane's topic
+func NewLaneOffsetInspectors(inspectors ...domain.OffsetInspector) domain.OffsetInspector {
+	if len(inspectors) == 1 {
+		return inspectors[0]
+	}
+	return laneOffsetInspectors(inspectors)
+}
+
+func (i laneOffsetInspectors) PartitionLags(ctx context.Context) ([]domain.PartitionLag, error) {
+	var lags []domain.PartitionLag
+	for _, inspector := range i {
+		l, err := inspector.PartitionLags(ctx)
+		if err != nil {
+			return nil, err
+		}
+		lags = append(lags, l...)
+	}
+	return lags, nil
+}
+
+func (i laneOffsetInspectors) Close() error {
+	var errs []error
+	for _, inspector := range i {
+		errs = append(errs, inspector.Close())
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,76 @@
+package repository
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Yupoer/logpulse/internal/config"
+	"github.com/Yupoer/logpulse/internal/domain"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLaneRouter_RoutesByLevelAndService(t *testing.T) {
+	critical, billing, fallback := &switchProducer{}, &switchProducer{}, &switchProducer{}
+	router := NewLaneRouter([]RoutedLane{
+		{Lane: config.LaneConfig{Name: "critical", Levels: []string{"ERROR", "FATAL"}}, Producer: critical},
+		{Lane: config.LaneConfig{Name: "billing", Services: []string{"billing-service"}}, Producer: billing},
+	}, fallback)
+
+	send := func(service, level, message string) {
+		require.NoError(t, router.SendLog(context.Background(), &domain.LogEntry{ServiceName: service, Level: level, Message: message}))
+	}
+	send("payment-service", "error", "lowercase level")
+	send("billing-service", "ERROR", "first matching lane wins")
+	send("billing-service", "INFO", "billing")
+	send("payment-service", "DEBUG", "default")
+
+	assert.Equal(t, []string{"lowercase level", "first matching lane wins"}, critical.messages())
+	assert.Equal(t, []string{"billing"}, billing.messages())
+	assert.Equal(t, []string{"default"}, fallback.messages())
+	require.NoError(t, router.Close())
+}
+
+func TestLaneMatches_LevelAndServiceBothApply(t *testing.T) {
+	lane := config.LaneConfig{Levels: []string{"ERROR"}, Services: []string{"payment-service"}}
+
+	assert.True(t, laneMatches(lane, &domain.LogEntry{ServiceName: "payment-service", Level: "ERROR"}))
+	assert.False(t, laneMatches(lane, &domain.LogEntry{ServiceName: "payment-service", Level: "INFO"}))
+	assert.False(t, laneMatches(lane, &domain.LogEntry{ServiceName: "auth-service", Level: "ERROR"}))
+}
+
+func TestLaneConsumers_PriorityLaneFlushesFirst(t *testing.T) {
+	encoder := testEncoder(t)
+	defaultQueue, criticalQueue := NewChannelQueue(16, encoder), NewChannelQueue(16, encoder)
+	esRepo := &flakyESRepo{}
+
+	newLaneConsumer := func(queue *ChannelQueue, batching config.ConsumerConfig) domain.LogConsumer {
+		c := NewChannelConsumer(&countingLogRepo{}, esRepo, nil, 0, ConsumerResilience{})
+		c.SetBatching(batching)
+		return c.Subscribe(queue)
+	}
+	consumer := NewLaneConsumers(
+		newLaneConsumer(defaultQueue, config.ConsumerConfig{BatchSize: 100, FlushInterval: time.Hour}),
+		newLaneConsumer(criticalQueue, config.ConsumerConfig{BatchSize: 1, FlushInterval: time.Hour}),
+	)
+	router := NewLaneRouter([]RoutedLane{
+		{Lane: config.LaneConfig{Levels: []string{"ERROR"}}, Producer: criticalQueue.Producer()},
+	}, defaultQueue.Producer())
+	stop := runConsumer(consumer)
+
+	for _, level := range []string{"DEBUG", "DEBUG", "ERROR", "DEBUG"} {
+		require.NoError(t, router.SendLog(context.Background(), &domain.LogEntry{ServiceName: "payment-service", Level: level}))
+	}
+
+	// The ERROR log is stored right away; the DEBUG flood waits for its batch
+	require.Eventually(t, func() bool { return indexedCount(esRepo) == 1 }, time.Second, time.Millisecond)
+	require.Eventually(t, func() bool { return consumer.Stats().BatchFill == 3 }, time.Second, time.Millisecond)
+	stats := consumer.Stats()
+	assert.Equal(t, int64(1), stats.FlushedTotal)
+	assert.Equal(t, 100, stats.BatchSize)
+	assert.Equal(t, 2, stats.Claims)
+
+	stop()
+	assert.Equal(t, int64(4), consumer.Stats().FlushedTotal)
+}
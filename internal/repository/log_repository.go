@@ -0,0 +1,135 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/Yupoer/logpulse/internal/domain"
+	"github.com/go-sql-driver/mysql"
+	"gorm.io/gorm"
+)
+
+// sqlDialect is what differs between the relational backends' queries
+type sqlDialect struct {
+	timestampCol string // "timestamp", quoted where the backend needs it
+	messageLike  string // Case-insensitive substring match, '\' escaping wildcards
+}
+
+var dialects = map[string]sqlDialect{
+	DriverMySQL:    {timestampCol: "timestamp", messageLike: "message LIKE ?"},
+	DriverPostgres: {timestampCol: `"timestamp"`, messageLike: "message ILIKE ?"},
+	DriverSQLite:   {timestampCol: "timestamp", messageLike: `message LIKE ? ESCAPE '\'`},
+}
+
+// gormLogRepository is the LogRepository of every relational backend
+type gormLogRepository struct {
+	db      *gorm.DB
+	dialect sqlDialect
+}
+
+// NewLogRepository is the factory function to inject DB dependency. driver
+// is one of DriverMySQL, DriverPostgres or DriverSQLite.
+func NewLogRepository(db *gorm.DB, driver string) domain.LogRepository {
+	return &gormLogRepository{db: db, dialect: dialects[driver]}
+}
+
+// Create inserts entry. Errors where the DB refused this particular row
+// wrap domain.ErrLogRejected, since retrying it cannot succeed.
+func (r *gormLogRepository) Create(ctx context.Context, entry *domain.LogEntry) error {
+	// GORM supports Context to handle timeouts and cancellation
+	err := r.db.WithContext(ctx).Create(entry).Error
+	if err != nil && rejectedByDB(err) {
+		return fmt.Errorf("%w: %w", domain.ErrLogRejected, err)
+	}
+	return err
+}
+
+func (r *gormLogRepository) GetByID(ctx context.Context, id uint, day time.Time) (*domain.LogEntry, error) {
+	var entry domain.LogEntry
+	db := r.db.WithContext(ctx)
+	if !day.IsZero() {
+		// Without the day every partition's primary key is probed
+		ts := r.dialect.timestampCol
+		day = truncateDay(day)
+		db = db.Where(ts+" >= ? AND "+ts+" < ?", day, day.AddDate(0, 0, 1))
+	}
+	// GORM's First method adds "LIMIT 1"
+	if err := db.First(&entry, id).Error; err != nil {
+		return nil, err
+	}
+	return &entry, nil
+}
+
+func (r *gormLogRepository) FindByTimeRange(ctx context.Context, from, to time.Time, afterID uint, limit int) ([]*domain.LogEntry, error) {
+	var entries []*domain.LogEntry
+	// The timestamp range lets partitioned backends prune to the matching days
+	ts := r.dialect.timestampCol
+	err := r.db.WithContext(ctx).
+		Where(ts+" >= ? AND "+ts+" < ? AND id > ?", from, to, afterID).
+		Order("id").
+		Limit(limit).
+		Find(&entries).Error
+	if err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+func (r *gormLogRepository) FindByIDRange(ctx context.Context, afterID, untilID uint, limit int) ([]*domain.LogEntry, error) {
+	var entries []*domain.LogEntry
+	err := r.db.WithContext(ctx).
+		Where("id > ? AND id <= ?", afterID, untilID).
+		Order("id").
+		Limit(limit).
+		Find(&entries).Error
+	if err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+func (r *gormLogRepository) MaxID(ctx context.Context) (uint, error) {
+	var maxID uint
+	err := r.db.WithContext(ctx).Model(&domain.LogEntry{}).Select("COALESCE(MAX(id), 0)").Scan(&maxID).Error
+	return maxID, err
+}
+
+func (r *gormLogRepository) Search(ctx context.Context, query domain.LogSearchQuery) ([]*domain.LogEntry, error) {
+	var entries []*domain.LogEntry
+	// FULLTEXT indexes are not supported on partitioned MySQL tables, so this
+	// is a LIKE scan bounded by the time range (which prunes partitions)
+	if err := fallbackSearch(r.db.WithContext(ctx), query, r.dialect).Find(&entries).Error; err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+// rejectedByDB reports whether err is the DB refusing a row's values (too
+// long, out of range, malformed, violating a constraint) rather than a
+// connection or server problem
+func rejectedByDB(err error) bool {
+	var mysqlErr *mysql.MySQLError
+	if errors.As(err, &mysqlErr) {
+		switch mysqlErr.Number {
+		case 1048, 1062, 1264, 1292, 1366, 1406: // NULL, duplicate, out of range, bad datetime, bad string, too long
+			return true
+		}
+		return false
+	}
+	var pgErr interface{ SQLState() string } // *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		state := pgErr.SQLState()
+		return strings.HasPrefix(state, "22") || strings.HasPrefix(state, "23") // Data exception, integrity constraint
+	}
+	var sqliteErr interface{ Code() int } // *sqlite.Error
+	if errors.As(err, &sqliteErr) {
+		switch sqliteErr.Code() & 0xff { // Primary result code
+		case 18, 19, 20: // SQLITE_TOOBIG, SQLITE_CONSTRAINT, SQLITE_MISMATCH
+			return true
+		}
+	}
+	return false
+}
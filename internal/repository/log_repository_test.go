@@ -0,0 +1,230 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Yupoer/logpulse/internal/config"
+	"github.com/Yupoer/logpulse/internal/domain"
+	"github.com/go-sql-driver/mysql"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+// Conformance suite shared by every relational LogRepository backend.
+// SQLite always runs; MySQL and PostgreSQL run when TEST_MYSQL_DSN /
+// TEST_POSTGRES_DSN point at a disposable database.
+
+var testPartition = config.PartitionConfig{Enabled: true, RetentionDays: 7, PremakeDays: 2}
+
+func TestSQLiteLogRepository(t *testing.T) {
+	runLogRepositoryConformance(t, &config.Config{
+		DBDriver:  DriverSQLite,
+		DBUrl:     filepath.Join(t.TempDir(), "logpulse.db"),
+		Partition: testPartition,
+	})
+}
+
+func TestMySQLLogRepository(t *testing.T) {
+	dsn := os.Getenv("TEST_MYSQL_DSN")
+	if dsn == "" {
+		t.Skip("TEST_MYSQL_DSN not set")
+	}
+	runLogRepositoryConformance(t, &config.Config{DBDriver: DriverMySQL, DBUrl: dsn, Partition: testPartition})
+}
+
+func TestPostgresLogRepository(t *testing.T) {
+	dsn := os.Getenv("TEST_POSTGRES_DSN")
+	if dsn == "" {
+		t.Skip("TEST_POSTGRES_DSN not set")
+	}
+	runLogRepositoryConformance(t, &config.Config{DBDriver: DriverPostgres, DBUrl: dsn, Partition: testPartition})
+}
+
+func runLogRepositoryConformance(t *testing.T, cfg *config.Config) {
+	backend, err := NewRelationalBackend(cfg)
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	require.NoError(t, backend.Schema.Migrate(ctx))
+	// Migrate must be safe to run on every startup
+	require.NoError(t, backend.Schema.Migrate(ctx))
+	require.NoError(t, backend.Schema.Maintain(ctx, time.Now()))
+
+	repo := backend.Logs
+
+	t.Run("CreateAndGet", func(t *testing.T) {
+		entry := &domain.LogEntry{
+			ServiceName: "payment-service",
+			Level:       "ERROR",
+			Message:     "Transaction failed due to timeout",
+			Timestamp:   time.Now().Truncate(time.Millisecond),
+		}
+		require.NoError(t, repo.Create(ctx, entry))
+		require.NotZero(t, entry.ID)
+
+		got, err := repo.GetByID(ctx, entry.ID, time.Time{})
+		require.NoError(t, err)
+		assert.Equal(t, entry.ServiceName, got.ServiceName)
+		assert.Equal(t, entry.Level, got.Level)
+		assert.Equal(t, entry.Message, got.Message)
+		assert.WithinDuration(t, entry.Timestamp, got.Timestamp, time.Millisecond)
+
+		// The day narrows the lookup to that day's entries
+		got, err = repo.GetByID(ctx, entry.ID, entry.Timestamp)
+		require.NoError(t, err)
+		assert.Equal(t, entry.ID, got.ID)
+		_, err = repo.GetByID(ctx, entry.ID, entry.Timestamp.AddDate(0, 0, -1))
+		assert.ErrorIs(t, err, gorm.ErrRecordNotFound)
+	})
+
+	t.Run("GetMissing", func(t *testing.T) {
+		_, err := repo.GetByID(ctx, 1<<31, time.Time{})
+		assert.ErrorIs(t, err, gorm.ErrRecordNotFound)
+	})
+
+	t.Run("FindByTimeRange", func(t *testing.T) {
+		base := time.Now().Add(-time.Hour).Truncate(time.Second)
+		ids := make([]uint, 0, 3)
+		for i := 0; i < 3; i++ {
+			entry := &domain.LogEntry{ServiceName: "range-service", Level: "INFO", Message: "ranged", Timestamp: base.Add(time.Duration(i) * time.Minute)}
+			require.NoError(t, repo.Create(ctx, entry))
+			ids = append(ids, entry.ID)
+		}
+
+		// Upper bound is exclusive; paging resumes after the last seen ID
+		page, err := repo.FindByTimeRange(ctx, base, base.Add(2*time.Minute), 0, 10)
+		require.NoError(t, err)
+		got := make([]uint, 0, len(page))
+		for _, e := range page {
+			if e.ServiceName == "range-service" {
+				got = append(got, e.ID)
+			}
+		}
+		assert.Equal(t, ids[:2], got)
+
+		page, err = repo.FindByTimeRange(ctx, base, base.Add(3*time.Minute), ids[1], 10)
+		require.NoError(t, err)
+		require.NotEmpty(t, page)
+		assert.Equal(t, ids[2], page[0].ID)
+	})
+
+	t.Run("FindByIDRange", func(t *testing.T) {
+		first := &domain.LogEntry{ServiceName: "id-service", Level: "INFO", Message: "first", Timestamp: time.Now()}
+		second := &domain.LogEntry{ServiceName: "id-service", Level: "INFO", Message: "second", Timestamp: time.Now()}
+		require.NoError(t, repo.Create(ctx, first))
+		require.NoError(t, repo.Create(ctx, second))
+
+		maxID, err := repo.MaxID(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, second.ID, maxID)
+
+		// afterID is exclusive, untilID inclusive
+		page, err := repo.FindByIDRange(ctx, first.ID, second.ID, 10)
+		require.NoError(t, err)
+		require.Len(t, page, 1)
+		assert.Equal(t, second.ID, page[0].ID)
+	})
+
+	t.Run("Search", func(t *testing.T) {
+		now := time.Now()
+		for _, e := range []*domain.LogEntry{
+			{ServiceName: "search-service", Level: "ERROR", Message: "Database connection TIMEOUT", Timestamp: now.Add(-time.Minute)},
+			{ServiceName: "search-service", Level: "INFO", Message: "Processed 100% of batch", Timestamp: now.Add(-time.Minute)},
+			{ServiceName: "other-service", Level: "ERROR", Message: "timeout talking to upstream", Timestamp: now.Add(-time.Minute)},
+			{ServiceName: "search-service", Level: "ERROR", Message: "old timeout", Timestamp: now.Add(-48 * time.Hour)},
+		} {
+			require.NoError(t, repo.Create(ctx, e))
+		}
+
+		// Case-insensitive substring on message, exact service, level in any case, last 24h by default
+		logs, err := repo.Search(ctx, domain.LogSearchQuery{Query: "timeout", ServiceName: "search-service", Level: "error"})
+		require.NoError(t, err)
+		require.Len(t, logs, 1)
+		assert.Equal(t, "Database connection TIMEOUT", logs[0].Message)
+
+		// LIKE wildcards in the keyword are matched literally
+		logs, err = repo.Search(ctx, domain.LogSearchQuery{Query: "100%", ServiceName: "search-service"})
+		require.NoError(t, err)
+		require.Len(t, logs, 1)
+		logs, err = repo.Search(ctx, domain.LogSearchQuery{Query: "_", ServiceName: "search-service"})
+		require.NoError(t, err)
+		assert.Empty(t, logs)
+
+		// Explicit range reaches older data
+		logs, err = repo.Search(ctx, domain.LogSearchQuery{Query: "old", From: now.Add(-72 * time.Hour), To: now})
+		require.NoError(t, err)
+		assert.Len(t, logs, 1)
+	})
+
+	t.Run("GetBackDated", func(t *testing.T) {
+		// Back-dated entries stay readable by ID until maintenance removes them
+		entry := &domain.LogEntry{
+			ServiceName: "order-service",
+			Level:       "INFO",
+			Message:     "Back-dated log",
+			Timestamp:   time.Now().AddDate(0, 0, -cfg.Partition.RetentionDays-2),
+		}
+		require.NoError(t, repo.Create(ctx, entry))
+
+		got, err := repo.GetByID(ctx, entry.ID, time.Time{})
+		require.NoError(t, err)
+		assert.Equal(t, "Back-dated log", got.Message)
+		got, err = repo.GetByID(ctx, entry.ID, entry.Timestamp)
+		require.NoError(t, err)
+		assert.Equal(t, "Back-dated log", got.Message)
+	})
+
+	t.Run("MaintainAfterFutureRows", func(t *testing.T) {
+		// A log dated past the premade partitions must not block creating
+		// its day's partition once that day comes into range
+		ahead := cfg.Partition.PremakeDays + 3
+		entry := &domain.LogEntry{
+			ServiceName: "order-service",
+			Level:       "INFO",
+			Message:     "Future-dated log",
+			Timestamp:   time.Now().AddDate(0, 0, ahead),
+		}
+		require.NoError(t, repo.Create(ctx, entry))
+		require.NoError(t, backend.Schema.Maintain(ctx, time.Now().AddDate(0, 0, ahead)))
+
+		got, err := repo.GetByID(ctx, entry.ID, time.Time{})
+		require.NoError(t, err)
+		assert.Equal(t, "Future-dated log", got.Message)
+	})
+
+	t.Run("MaintainRemovesExpired", func(t *testing.T) {
+		entry := &domain.LogEntry{
+			ServiceName: "order-service",
+			Level:       "INFO",
+			Message:     "Expired log",
+			Timestamp:   time.Now().AddDate(0, 0, -cfg.Partition.RetentionDays-2),
+		}
+		require.NoError(t, repo.Create(ctx, entry))
+		require.NoError(t, backend.Schema.Maintain(ctx, time.Now()))
+
+		var count int64
+		require.NoError(t, backend.DB.Unscoped().Model(&domain.LogEntry{}).Where("id = ?", entry.ID).Count(&count).Error)
+		assert.Zero(t, count)
+	})
+}
+
+// sqlStateError stands in for *pgconn.PgError
+type sqlStateError string
+
+func (e sqlStateError) Error() string    { return "pg error " + string(e) }
+func (e sqlStateError) SQLState() string { return string(e) }
+
+func TestRejectedByDB(t *testing.T) {
+	assert.True(t, rejectedByDB(fmt.Errorf("insert: %w", &mysql.MySQLError{Number: 1406, Message: "Data too long"})))
+	assert.False(t, rejectedByDB(&mysql.MySQLError{Number: 1205, Message: "Lock wait timeout"}))
+	assert.True(t, rejectedByDB(sqlStateError("22001")))  // string_data_right_truncation
+	assert.False(t, rejectedByDB(sqlStateError("57P01"))) // admin_shutdown
+	assert.False(t, rejectedByDB(errors.New("driver: bad connection")))
+}
@@ -0,0 +1,50 @@
+package repository
+
+import (
+	"strings"
+	"time"
+
+	"github.com/Yupoer/logpulse/internal/domain"
+	"gorm.io/gorm"
+)
+
+const (
+	// Degraded searches without an explicit range only look this far back,
+	// which keeps LIKE scans (and partition pruning) to recent data
+	fallbackSearchWindow = 24 * time.Hour
+	fallbackSearchLimit  = 100
+)
+
+// fallbackSearch applies the filters of a degraded search in dialect
+func fallbackSearch(db *gorm.DB, q domain.LogSearchQuery, dialect sqlDialect) *gorm.DB {
+	to := q.To
+	if to.IsZero() {
+		to = time.Now()
+	}
+	from := q.From
+	if from.IsZero() {
+		from = to.Add(-fallbackSearchWindow)
+	}
+	limit := q.Limit
+	if limit <= 0 {
+		limit = fallbackSearchLimit
+	}
+
+	timestampCol := dialect.timestampCol
+	db = db.Where(timestampCol+" >= ? AND "+timestampCol+" < ?", from, to)
+	if q.ServiceName != "" {
+		db = db.Where("service_name = ?", q.ServiceName)
+	}
+	if q.Level != "" {
+		db = db.Where("LOWER(level) = LOWER(?)", q.Level)
+	}
+	if q.Query != "" {
+		db = db.Where(dialect.messageLike, "%"+escapeLike(q.Query)+"%")
+	}
+	return db.Order(timestampCol + " DESC").Limit(limit)
+}
+
+// escapeLike escapes LIKE wildcards so the keyword is matched literally
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
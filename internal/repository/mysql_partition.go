@@ -0,0 +1,215 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Yupoer/logpulse/internal/config"
+	"gorm.io/gorm"
+)
+
+const (
+	mysqlPartitionPrefix = "p"
+	futurePartitionName  = "p_future"
+)
+
+// MySQL requires the partitioning column to be part of every unique key,
+// so the primary key becomes (id, timestamp) instead of GORM's default (id).
+// The remaining columns mirror what AutoMigrate generates for domain.LogEntry.
+const createPartitionedLogTableSQL = `
+CREATE TABLE IF NOT EXISTS log_entries (
+    id BIGINT UNSIGNED NOT NULL AUTO_INCREMENT,
+    created_at DATETIME(3) NULL,
+    updated_at DATETIME(3) NULL,
+    deleted_at DATETIME(3) NULL,
+    service_name VARCHAR(191) NULL,
+    level LONGTEXT NULL,
+    message LONGTEXT NULL,
+    timestamp DATETIME(3) NOT NULL,
+    PRIMARY KEY (id, timestamp),
+    INDEX idx_log_entries_deleted_at (deleted_at),
+    INDEX idx_log_entries_service_name (service_name)
+)
+PARTITION BY RANGE (TO_DAYS(timestamp)) (%s)`
+
+// Converts an existing (unpartitioned) table created by AutoMigrate
+const convertLogTableSQL = `
+ALTER TABLE log_entries
+    MODIFY timestamp DATETIME(3) NOT NULL,
+    DROP PRIMARY KEY,
+    ADD PRIMARY KEY (id, timestamp)
+PARTITION BY RANGE (TO_DAYS(timestamp)) (%s)`
+
+// MySQLPartitionManager keeps log_entries RANGE-partitioned by day:
+// it pre-creates future partitions and drops the ones past retention.
+// Each partition holds rows with timestamp < Day + 24h; the oldest one has no
+// lower bound, so late or back-dated logs land there instead of failing the insert.
+type MySQLPartitionManager struct {
+	db  *gorm.DB
+	cfg config.PartitionConfig
+}
+
+func NewMySQLPartitionManager(db *gorm.DB, cfg config.PartitionConfig) *MySQLPartitionManager {
+	return &MySQLPartitionManager{db: db, cfg: cfg}
+}
+
+// Migrate creates log_entries as a partitioned table. A table left behind
+// by AutoMigrate is reported rather than converted, since Convert rewrites
+// it under a table lock.
+func (m *MySQLPartitionManager) Migrate(ctx context.Context) error {
+	return m.migrate(ctx, false)
+}
+
+// Convert is Migrate, but partitions an existing unpartitioned table in
+// place. This rewrites the whole table, so it can take a while on large
+// datasets.
+func (m *MySQLPartitionManager) Convert(ctx context.Context) error {
+	return m.migrate(ctx, true)
+}
+
+// migrate runs under a MySQL named lock, which serialises replicas that
+// start at the same time
+func (m *MySQLPartitionManager) migrate(ctx context.Context, convert bool) error {
+	conn, err := m.db.DB()
+	if err != nil {
+		return err
+	}
+	// GET_LOCK is session-scoped, so pin a single connection for the whole migration
+	sqlConn, err := conn.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = sqlConn.Close() }()
+
+	var locked int
+	if err := sqlConn.QueryRowContext(ctx, "SELECT GET_LOCK(?, 60)", migrationLockName).Scan(&locked); err != nil {
+		return err
+	}
+	if locked != 1 {
+		return fmt.Errorf("timed out waiting for migration lock %q", migrationLockName)
+	}
+	defer func() { _, _ = sqlConn.ExecContext(context.Background(), "SELECT RELEASE_LOCK(?)", migrationLockName) }()
+
+	var tableCount int64
+	if err := sqlConn.QueryRowContext(ctx,
+		"SELECT COUNT(*) FROM information_schema.TABLES WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = ?",
+		logTableName,
+	).Scan(&tableCount); err != nil {
+		return err
+	}
+
+	initial := partitionClauses(wantedPartitions(mysqlPartitionPrefix, time.Now(), m.cfg.PremakeDays))
+	if tableCount == 0 {
+		slog.Info("Creating partitioned table", "table", logTableName)
+		_, err := sqlConn.ExecContext(ctx, fmt.Sprintf(createPartitionedLogTableSQL, initial))
+		return err
+	}
+
+	var partitionCount int64
+	if err := sqlConn.QueryRowContext(ctx,
+		"SELECT COUNT(*) FROM information_schema.PARTITIONS WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = ? AND PARTITION_NAME IS NOT NULL",
+		logTableName,
+	).Scan(&partitionCount); err != nil {
+		return err
+	}
+	if partitionCount > 0 {
+		return nil // Already partitioned
+	}
+	if !convert {
+		return fmt.Errorf("table %s exists but is not partitioned; convert it with cmd/migrate -convert or set DB_PARTITION_ENABLED=false", logTableName)
+	}
+
+	slog.Info("Converting table to RANGE partitioning by day, this may take a while", "table", logTableName)
+	_, err = sqlConn.ExecContext(ctx, fmt.Sprintf(convertLogTableSQL, initial))
+	return err
+}
+
+// Maintain pre-creates partitions up to PremakeDays ahead of now, drops
+// partitions whose whole day is older than RetentionDays and deletes expired
+// rows left in the oldest partition.
+func (m *MySQLPartitionManager) Maintain(ctx context.Context, now time.Time) error {
+	existing, err := m.listPartitions(ctx)
+	if err != nil {
+		return err
+	}
+	if len(existing) == 0 {
+		return fmt.Errorf("table %s is not partitioned", logTableName)
+	}
+
+	if missing := partitionsToCreate(existing, wantedPartitions(mysqlPartitionPrefix, now, m.cfg.PremakeDays)); len(missing) > 0 {
+		// New ranges are split off the MAXVALUE catch-all partition
+		stmt := fmt.Sprintf(
+			"ALTER TABLE %s REORGANIZE PARTITION %s INTO (%s)",
+			logTableName, futurePartitionName, partitionClauses(missing),
+		)
+		if err := m.db.WithContext(ctx).Exec(stmt).Error; err != nil {
+			return fmt.Errorf("create partitions: %w", err)
+		}
+		slog.Info("Created partitions", "table", logTableName, "count", len(missing))
+	}
+
+	if expired := partitionsToDrop(existing, now, m.cfg.RetentionDays); len(expired) > 0 {
+		names := make([]string, 0, len(expired))
+		for _, p := range expired {
+			names = append(names, p.Name)
+		}
+		stmt := fmt.Sprintf("ALTER TABLE %s DROP PARTITION %s", logTableName, strings.Join(names, ", "))
+		if err := m.db.WithContext(ctx).Exec(stmt).Error; err != nil {
+			return fmt.Errorf("drop partitions: %w", err)
+		}
+		slog.Info("Dropped expired partitions", "partitions", names)
+	}
+
+	if m.cfg.RetentionDays <= 0 {
+		return nil
+	}
+	// Back-dated rows live in the oldest partition, which is never dropped.
+	// The time predicate prunes this DELETE down to that partition.
+	return m.db.WithContext(ctx).
+		Exec("DELETE FROM "+logTableName+" WHERE timestamp < ?", retentionCutoff(now, m.cfg.RetentionDays)).
+		Error
+}
+
+// listPartitions returns the daily partitions of log_entries ordered by day.
+// The MAXVALUE catch-all is not included.
+func (m *MySQLPartitionManager) listPartitions(ctx context.Context) ([]dayPartition, error) {
+	var names []string
+	err := m.db.WithContext(ctx).Raw(
+		`SELECT PARTITION_NAME FROM information_schema.PARTITIONS
+		 WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = ? AND PARTITION_NAME IS NOT NULL`,
+		logTableName,
+	).Scan(&names).Error
+	if err != nil {
+		return nil, err
+	}
+
+	partitions := make([]dayPartition, 0, len(names))
+	for _, name := range names {
+		day, ok := parsePartitionName(mysqlPartitionPrefix, name)
+		if !ok {
+			continue
+		}
+		partitions = append(partitions, dayPartition{Name: name, Day: day})
+	}
+	sort.Slice(partitions, func(i, j int) bool { return partitions[i].Day.Before(partitions[j].Day) })
+	return partitions, nil
+}
+
+// partitionClauses renders the partition definitions followed by the
+// MAXVALUE catch-all, e.g.
+// PARTITION p20240101 VALUES LESS THAN (TO_DAYS('2024-01-02')), ...
+func partitionClauses(partitions []dayPartition) string {
+	clauses := make([]string, 0, len(partitions)+1)
+	for _, p := range partitions {
+		clauses = append(clauses, fmt.Sprintf(
+			"PARTITION %s VALUES LESS THAN (TO_DAYS('%s'))",
+			p.Name, p.Day.AddDate(0, 0, 1).Format("2006-01-02"),
+		))
+	}
+	clauses = append(clauses, fmt.Sprintf("PARTITION %s VALUES LESS THAN MAXVALUE", futurePartitionName))
+	return strings.Join(clauses, ", ")
+}
@@ -0,0 +1,125 @@
+package repository
+
+import (
+	"context"
+	"log/slog"
+	"strings"
+	"time"
+)
+
+const (
+	logTableName        = "log_entries"
+	partitionDateLayout = "20060102"
+	migrationLockName   = "logpulse_log_entries_migration"
+)
+
+// SchemaManager prepares and maintains the log_entries table of a
+// relational backend (partitions where supported, plain deletes otherwise).
+type SchemaManager interface {
+	Migrate(ctx context.Context) error
+	Maintain(ctx context.Context, now time.Time) error
+}
+
+// TableConverter is a SchemaManager that can partition an existing plain
+// log_entries in place. The rewrite locks the table while it runs, so it is
+// left to cmd/migrate rather than done at startup.
+type TableConverter interface {
+	Convert(ctx context.Context) error
+}
+
+// RunSchemaMaintenance calls Maintain immediately and then every interval
+// until ctx is cancelled.
+func RunSchemaMaintenance(ctx context.Context, schema SchemaManager, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if err := schema.Maintain(ctx, time.Now()); err != nil {
+			slog.Error("Partition maintenance failed", "error", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// dayPartition describes one daily partition of log_entries.
+type dayPartition struct {
+	Name string
+	Day  time.Time
+}
+
+func newDayPartition(prefix string, day time.Time) dayPartition {
+	return dayPartition{Name: prefix + day.Format(partitionDateLayout), Day: day}
+}
+
+func parsePartitionName(prefix, name string) (time.Time, bool) {
+	if !strings.HasPrefix(name, prefix) {
+		return time.Time{}, false
+	}
+	day, err := time.ParseInLocation(partitionDateLayout, strings.TrimPrefix(name, prefix), time.Local)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return day, true
+}
+
+// wantedPartitions returns the partitions from today up to premakeDays ahead.
+func wantedPartitions(prefix string, now time.Time, premakeDays int) []dayPartition {
+	today := truncateDay(now)
+	wanted := make([]dayPartition, 0, premakeDays+1)
+	for i := 0; i <= premakeDays; i++ {
+		wanted = append(wanted, newDayPartition(prefix, today.AddDate(0, 0, i)))
+	}
+	return wanted
+}
+
+// truncateDay returns local midnight. The MySQL DSN uses loc=Local, so day
+// boundaries line up with how MySQL evaluates TO_DAYS(timestamp).
+func truncateDay(t time.Time) time.Time {
+	y, m, d := t.In(time.Local).Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, time.Local)
+}
+
+// retentionCutoff returns the oldest timestamp still inside the retention window.
+func retentionCutoff(now time.Time, retentionDays int) time.Time {
+	return truncateDay(now).AddDate(0, 0, -retentionDays)
+}
+
+// partitionsToCreate returns the wanted partitions that are newer than every
+// existing one. MySQL's REORGANIZE can only split the trailing MAXVALUE
+// partition, so gaps before the newest existing day are never back-filled.
+func partitionsToCreate(existing, wanted []dayPartition) []dayPartition {
+	var newest time.Time
+	if len(existing) > 0 {
+		newest = existing[len(existing)-1].Day
+	}
+
+	missing := make([]dayPartition, 0, len(wanted))
+	for _, p := range wanted {
+		if len(existing) == 0 || p.Day.After(newest) {
+			missing = append(missing, p)
+		}
+	}
+	return missing
+}
+
+// partitionsToDrop returns partitions whose whole day is older than
+// retentionDays. The newest partition is always kept so the table never
+// runs out of ranges.
+func partitionsToDrop(existing []dayPartition, now time.Time, retentionDays int) []dayPartition {
+	if retentionDays <= 0 || len(existing) == 0 {
+		return nil
+	}
+
+	cutoff := retentionCutoff(now, retentionDays)
+	expired := make([]dayPartition, 0)
+	for _, p := range existing[:len(existing)-1] {
+		if p.Day.Before(cutoff) {
+			expired = append(expired, p)
+		}
+	}
+	return expired
+}
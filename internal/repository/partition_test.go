@@ -0,0 +1,65 @@
+package repository
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func day(s string) time.Time {
+	t, _ := time.ParseInLocation("2006-01-02", s, time.Local)
+	return t
+}
+
+func TestPartitionsToCreate(t *testing.T) {
+	existing := []dayPartition{newDayPartition(mysqlPartitionPrefix, day("2024-03-01")), newDayPartition(mysqlPartitionPrefix, day("2024-03-02"))}
+	wanted := []dayPartition{
+		newDayPartition(mysqlPartitionPrefix, day("2024-03-02")),
+		newDayPartition(mysqlPartitionPrefix, day("2024-03-03")),
+		newDayPartition(mysqlPartitionPrefix, day("2024-03-04")),
+	}
+
+	missing := partitionsToCreate(existing, wanted)
+
+	// Only days after the newest existing partition are split off p_future
+	assert.Equal(t, []dayPartition{newDayPartition(mysqlPartitionPrefix, day("2024-03-03")), newDayPartition(mysqlPartitionPrefix, day("2024-03-04"))}, missing)
+	assert.Equal(t, "p20240303", missing[0].Name)
+}
+
+func TestPartitionsToDrop(t *testing.T) {
+	existing := []dayPartition{
+		newDayPartition(mysqlPartitionPrefix, day("2024-02-27")),
+		newDayPartition(mysqlPartitionPrefix, day("2024-02-28")),
+		newDayPartition(mysqlPartitionPrefix, day("2024-02-29")),
+		newDayPartition(mysqlPartitionPrefix, day("2024-03-01")),
+	}
+	now := day("2024-03-01").Add(15 * time.Hour)
+
+	// 2 days retention keeps 02-28 onwards
+	assert.Equal(t, []dayPartition{newDayPartition(mysqlPartitionPrefix, day("2024-02-27"))}, partitionsToDrop(existing, now, 2))
+
+	// Retention disabled
+	assert.Empty(t, partitionsToDrop(existing, now, 0))
+
+	// The newest partition is never dropped, even if everything expired
+	assert.Len(t, partitionsToDrop(existing, now.AddDate(1, 0, 0), 2), 3)
+}
+
+func TestPartitionClauses(t *testing.T) {
+	clauses := partitionClauses([]dayPartition{newDayPartition(mysqlPartitionPrefix, day("2024-12-31"))})
+
+	assert.Equal(t,
+		"PARTITION p20241231 VALUES LESS THAN (TO_DAYS('2025-01-01')), PARTITION p_future VALUES LESS THAN MAXVALUE",
+		clauses,
+	)
+}
+
+func TestParsePartitionName(t *testing.T) {
+	d, ok := parsePartitionName(mysqlPartitionPrefix, "p20240315")
+	assert.True(t, ok)
+	assert.Equal(t, day("2024-03-15"), d)
+
+	_, ok = parsePartitionName(mysqlPartitionPrefix, futurePartitionName)
+	assert.False(t, ok)
+}
@@ -0,0 +1,211 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sort"
+	"time"
+
+	"github.com/Yupoer/logpulse/internal/config"
+	"gorm.io/gorm"
+)
+
+const (
+	postgresPartitionPrefix  = "log_entries_p"
+	postgresDefaultPartition = "log_entries_default"
+)
+
+// Declarative partitioning needs the partition key in the primary key as well.
+// Rows outside every daily range (back-dated or far-future logs) go to the
+// DEFAULT partition, which Maintain trims by timestamp.
+var createPartitionedPostgresTableSQL = []string{
+	`CREATE TABLE IF NOT EXISTS log_entries (
+		id BIGSERIAL NOT NULL,
+		created_at TIMESTAMPTZ NULL,
+		updated_at TIMESTAMPTZ NULL,
+		deleted_at TIMESTAMPTZ NULL,
+		service_name TEXT NULL,
+		level TEXT NULL,
+		message TEXT NULL,
+		"timestamp" TIMESTAMPTZ NOT NULL,
+		PRIMARY KEY (id, "timestamp")
+	) PARTITION BY RANGE ("timestamp")`,
+	`CREATE INDEX IF NOT EXISTS idx_log_entries_deleted_at ON log_entries (deleted_at)`,
+	`CREATE INDEX IF NOT EXISTS idx_log_entries_service_name ON log_entries (service_name)`,
+	`CREATE TABLE IF NOT EXISTS ` + postgresDefaultPartition + ` PARTITION OF log_entries DEFAULT`,
+}
+
+// PostgresPartitionManager keeps log_entries partitioned by day using
+// PostgreSQL declarative partitioning.
+type PostgresPartitionManager struct {
+	db  *gorm.DB
+	cfg config.PartitionConfig
+}
+
+func NewPostgresPartitionManager(db *gorm.DB, cfg config.PartitionConfig) *PostgresPartitionManager {
+	return &PostgresPartitionManager{db: db, cfg: cfg}
+}
+
+// Migrate creates the partitioned parent table, its DEFAULT partition and
+// the daily partitions from today up to PremakeDays ahead, so the first logs
+// don't land in DEFAULT. A plain table cannot be converted in place in
+// PostgreSQL, so an existing unpartitioned log_entries is reported instead
+// of being rewritten.
+func (m *PostgresPartitionManager) Migrate(ctx context.Context) error {
+	conn, err := m.db.DB()
+	if err != nil {
+		return err
+	}
+	// Advisory locks are session-scoped, so pin a single connection
+	sqlConn, err := conn.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = sqlConn.Close() }()
+
+	if _, err := sqlConn.ExecContext(ctx, "SELECT pg_advisory_lock(hashtext($1))", migrationLockName); err != nil {
+		return err
+	}
+	defer func() {
+		_, _ = sqlConn.ExecContext(context.Background(), "SELECT pg_advisory_unlock(hashtext($1))", migrationLockName)
+	}()
+
+	var relkind string
+	err = sqlConn.QueryRowContext(ctx,
+		"SELECT COALESCE((SELECT relkind::text FROM pg_class WHERE oid = to_regclass($1)), '')",
+		logTableName,
+	).Scan(&relkind)
+	if err != nil {
+		return err
+	}
+	if relkind == "r" {
+		return fmt.Errorf("table %s exists but is not partitioned; migrate it manually or set DB_PARTITION_ENABLED=false", logTableName)
+	}
+
+	if relkind == "" {
+		slog.Info("Creating partitioned table", "table", logTableName)
+	}
+	for _, stmt := range createPartitionedPostgresTableSQL {
+		if _, err := sqlConn.ExecContext(ctx, stmt); err != nil {
+			return err
+		}
+	}
+	return m.createPartitions(ctx, time.Now())
+}
+
+// Maintain pre-creates partitions up to PremakeDays ahead of now, drops the
+// ones past RetentionDays and trims expired rows from the DEFAULT partition.
+func (m *PostgresPartitionManager) Maintain(ctx context.Context, now time.Time) error {
+	if err := m.createPartitions(ctx, now); err != nil {
+		return err
+	}
+	if m.cfg.RetentionDays <= 0 {
+		return nil
+	}
+
+	existing, err := m.listPartitions(ctx)
+	if err != nil {
+		return err
+	}
+	for _, p := range partitionsToDrop(existing, now, m.cfg.RetentionDays) {
+		if err := m.db.WithContext(ctx).Exec("DROP TABLE IF EXISTS " + p.Name).Error; err != nil {
+			return fmt.Errorf("drop partition %s: %w", p.Name, err)
+		}
+		slog.Info("Dropped expired partition", "partition", p.Name)
+	}
+
+	return m.db.WithContext(ctx).
+		Exec(`DELETE FROM `+postgresDefaultPartition+` WHERE "timestamp" < ?`, retentionCutoff(now, m.cfg.RetentionDays)).
+		Error
+}
+
+// createPartitions creates the daily partitions from now up to PremakeDays
+// ahead that don't exist yet
+func (m *PostgresPartitionManager) createPartitions(ctx context.Context, now time.Time) error {
+	existing, err := m.listPartitions(ctx)
+	if err != nil {
+		return err
+	}
+	for _, p := range partitionsToCreate(existing, wantedPartitions(postgresPartitionPrefix, now, m.cfg.PremakeDays)) {
+		if err := m.createPartition(ctx, p); err != nil {
+			return fmt.Errorf("create partition %s: %w", p.Name, err)
+		}
+		slog.Info("Created partition", "partition", p.Name)
+	}
+	return nil
+}
+
+// createPartition creates p. PostgreSQL refuses a new range while the
+// DEFAULT partition holds rows inside it, which happens whenever a client
+// sent logs dated ahead of the premade days. Those rows are moved into the
+// new partition in one transaction: detach DEFAULT, create, move, reattach.
+func (m *PostgresPartitionManager) createPartition(ctx context.Context, p dayPartition) error {
+	from, to := pgTimestamp(p.Day), pgTimestamp(p.Day.AddDate(0, 0, 1))
+	create := fmt.Sprintf(
+		"CREATE TABLE IF NOT EXISTS %s PARTITION OF %s FOR VALUES FROM ('%s') TO ('%s')",
+		p.Name, logTableName, from, to,
+	)
+
+	var stranded bool
+	err := m.db.WithContext(ctx).Raw(
+		`SELECT EXISTS (SELECT 1 FROM `+postgresDefaultPartition+` WHERE "timestamp" >= ? AND "timestamp" < ?)`,
+		p.Day, p.Day.AddDate(0, 0, 1),
+	).Scan(&stranded).Error
+	if err != nil {
+		return err
+	}
+	if !stranded {
+		return m.db.WithContext(ctx).Exec(create).Error
+	}
+
+	slog.Info("Moving rows out of the default partition", "partition", p.Name)
+	return m.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		for _, stmt := range []string{
+			fmt.Sprintf("ALTER TABLE %s DETACH PARTITION %s", logTableName, postgresDefaultPartition),
+			create,
+			fmt.Sprintf(
+				`WITH moved AS (DELETE FROM %s WHERE "timestamp" >= '%s' AND "timestamp" < '%s' RETURNING *) INSERT INTO %s SELECT * FROM moved`,
+				postgresDefaultPartition, from, to, logTableName,
+			),
+			fmt.Sprintf("ALTER TABLE %s ATTACH PARTITION %s DEFAULT", logTableName, postgresDefaultPartition),
+		} {
+			if err := tx.Exec(stmt).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// listPartitions returns the daily partitions of log_entries ordered by day.
+// The DEFAULT partition is not included.
+func (m *PostgresPartitionManager) listPartitions(ctx context.Context) ([]dayPartition, error) {
+	var names []string
+	err := m.db.WithContext(ctx).Raw(
+		`SELECT child.relname FROM pg_inherits
+		 JOIN pg_class child ON child.oid = pg_inherits.inhrelid
+		 WHERE pg_inherits.inhparent = to_regclass(?)`,
+		logTableName,
+	).Scan(&names).Error
+	if err != nil {
+		return nil, err
+	}
+
+	partitions := make([]dayPartition, 0, len(names))
+	for _, name := range names {
+		day, ok := parsePartitionName(postgresPartitionPrefix, name)
+		if !ok {
+			continue
+		}
+		partitions = append(partitions, dayPartition{Name: name, Day: day})
+	}
+	sort.Slice(partitions, func(i, j int) bool { return partitions[i].Day.Before(partitions[j].Day) })
+	return partitions, nil
+}
+
+// pgTimestamp renders a TIMESTAMPTZ literal with an explicit UTC offset,
+// so partition bounds don't depend on the server's TimeZone setting.
+func pgTimestamp(t time.Time) string {
+	return t.Format("2006-01-02 15:04:05-07:00")
+}
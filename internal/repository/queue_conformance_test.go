@@ -0,0 +1,270 @@
+package repository
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Yupoer/logpulse/internal/config"
+	"github.com/Yupoer/logpulse/internal/domain"
+	"github.com/Yupoer/logpulse/internal/envelope"
+	"github.com/Yupoer/logpulse/internal/logging"
+	"github.com/Yupoer/logpulse/internal/resilience"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testQueue is one queue backend under test: a producer, and consumers
+// that all join the same group and share one worker configuration
+type testQueue struct {
+	producer domain.LogProducer
+	consumer func(w *queueWorker) domain.LogConsumer
+	durable  bool // Unflushed logs are redelivered to the next consumer
+}
+
+// runQueueConformance checks the behaviour every queue backend must share
+func runQueueConformance(t *testing.T, newQueue func(t *testing.T) testQueue) {
+	t.Run("DeliversEveryLogToDBAndES", func(t *testing.T) {
+		q := newQueue(t)
+		logRepo, esRepo := &countingLogRepo{}, &flakyESRepo{}
+		consumer := q.consumer(newConformanceWorker(logRepo, esRepo))
+		stop := runConsumer(consumer)
+
+		sendAll(t, q.producer, "one", "two", "three", "four", "five")
+		require.Eventually(t, func() bool { return indexedCount(esRepo) == 5 }, 10*time.Second, 10*time.Millisecond)
+		stop()
+
+		assert.Equal(t, 5, logRepo.creates)
+		assert.Equal(t, int64(5), consumer.Stats().FlushedTotal)
+	})
+
+	t.Run("FlushesRemainingLogsOnShutdown", func(t *testing.T) {
+		q := newQueue(t)
+		logRepo, esRepo := &countingLogRepo{}, &flakyESRepo{}
+		w := newConformanceWorker(logRepo, esRepo)
+		w.flushInterval = time.Hour // Only the shutdown flush
+		consumer := q.consumer(w)
+		stop := runConsumer(consumer)
+
+		sendAll(t, q.producer, "one", "two")
+		require.Eventually(t, func() bool { return consumer.Stats().BatchFill == 2 }, 10*time.Second, 10*time.Millisecond)
+		stop()
+
+		assert.Equal(t, 2, indexedCount(esRepo))
+	})
+
+	t.Run("CarriesRequestIDToWorkerLogs", func(t *testing.T) {
+		logs := captureLogs(t)
+		q := newQueue(t)
+		esRepo := &flakyESRepo{}
+		stop := runConsumer(q.consumer(newConformanceWorker(&countingLogRepo{}, esRepo)))
+
+		ctx := logging.WithRequestID(context.Background(), "req-conformance")
+		require.NoError(t, q.producer.SendLog(ctx, &domain.LogEntry{ServiceName: "payment-service", Message: "traced"}))
+		require.Eventually(t, func() bool { return indexedCount(esRepo) == 1 }, 10*time.Second, 10*time.Millisecond)
+		stop()
+
+		assert.Contains(t, logs.String(), `"msg":"Log stored"`)
+		assert.Contains(t, logs.String(), `"request_id":"req-conformance"`)
+	})
+
+	t.Run("RedeliversUnflushedLogs", func(t *testing.T) {
+		q := newQueue(t)
+		if !q.durable {
+			t.Skip("backend does not keep logs once they are read")
+		}
+
+		// The first consumer never manages to flush
+		failing := &flakyESRepo{failures: -1}
+		first := q.consumer(newConformanceWorker(&countingLogRepo{}, failing))
+		stop := runConsumer(first)
+		sendAll(t, q.producer, "one", "two", "three")
+		require.Eventually(t, func() bool { return failing.callCount() > 0 }, 10*time.Second, 10*time.Millisecond)
+		stop()
+
+		esRepo := &flakyESRepo{}
+		second := q.consumer(newConformanceWorker(&countingLogRepo{}, esRepo))
+		stop = runConsumer(second)
+		defer stop()
+		require.Eventually(t, func() bool { return indexedCount(esRepo) == 3 }, 30*time.Second, 10*time.Millisecond)
+	})
+}
+
+func newConformanceWorker(logRepo domain.LogRepository, esRepo domain.LogSearchRepository) *queueWorker {
+	w := newQueueWorker(logRepo, esRepo, nil, 0, ConsumerResilience{
+		Backoff: resilience.Backoff{Initial: time.Millisecond, Max: 5 * time.Millisecond},
+	})
+	w.batchSize = 3
+	w.flushInterval = 10 * time.Millisecond
+	return w
+}
+
+// runConsumer runs consumer in the background; stop cancels it and waits
+// for its final flush
+func runConsumer(consumer domain.LogConsumer) (stop func()) {
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		consumer.Run(ctx)
+		close(done)
+	}()
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			cancel()
+			<-done
+		})
+	}
+}
+
+// captureLogs sends the default slog logger, at debug level, to a buffer
+// for the rest of the test
+func captureLogs(t *testing.T) *syncBuffer {
+	buf := &syncBuffer{}
+	h, err := logging.NewHandler(config.LogConfig{Level: "debug", Format: "json"}, buf)
+	require.NoError(t, err)
+	prev := slog.Default()
+	slog.SetDefault(slog.New(h))
+	t.Cleanup(func() { slog.SetDefault(prev) })
+	return buf
+}
+
+// syncBuffer is a bytes.Buffer safe for the consumer goroutine to log into
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func indexedCount(r *flakyESRepo) int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.indexed)
+}
+
+func testEncoder(t *testing.T) envelope.Encoder {
+	encoder, err := envelope.NewEncoder("json", "test")
+	require.NoError(t, err)
+	return encoder
+}
+
+func newChannelTestQueue(t *testing.T) testQueue {
+	queue := NewChannelQueue(16, testEncoder(t))
+	return testQueue{
+		producer: queue.Producer(),
+		consumer: func(w *queueWorker) domain.LogConsumer {
+			return (&ChannelConsumer{queueWorker: w}).Subscribe(queue)
+		},
+	}
+}
+
+func newRedisTestQueue(t *testing.T, client *redis.Client) testQueue {
+	cfg := config.QueueConfig{Backend: "redis", RedisStream: "logs", RedisMaxLen: 1000, RedisClaimIdle: 50 * time.Millisecond}
+	consumers := 0
+	return testQueue{
+		producer: NewRedisStreamProducer(client, cfg, testEncoder(t), nil),
+		consumer: func(w *queueWorker) domain.LogConsumer {
+			consumers++
+			c := &RedisStreamConsumer{queueWorker: w, inFlight: map[string]bool{}}
+			return c.Subscribe(client, cfg, "logpulse-group", fmt.Sprintf("worker-%d", consumers))
+		},
+		durable: true,
+	}
+}
+
+func TestQueueConformance_Channel(t *testing.T) {
+	runQueueConformance(t, newChannelTestQueue)
+}
+
+func TestQueueConformance_RedisStreams(t *testing.T) {
+	runQueueConformance(t, func(t *testing.T) testQueue {
+		mr, err := miniredis.Run()
+		require.NoError(t, err)
+		t.Cleanup(mr.Close)
+		return newRedisTestQueue(t, redis.NewClient(&redis.Options{Addr: mr.Addr()}))
+	})
+}
+
+func TestQueueConformance_Kafka(t *testing.T) {
+	brokers := os.Getenv("TEST_KAFKA_BROKERS")
+	if brokers == "" {
+		t.Skip("TEST_KAFKA_BROKERS not set")
+	}
+	runQueueConformance(t, func(t *testing.T) testQueue {
+		// A fresh topic and group per subtest (needs topic auto-creation)
+		topic := fmt.Sprintf("logpulse-conformance-%d", time.Now().UnixNano())
+		producer, err := NewKafkaProducer(strings.Split(brokers, ","), topic, config.KafkaProducerConfig{Compression: "none"}, testEncoder(t), nil, resilience.RetryPolicy{MaxAttempts: 1})
+		require.NoError(t, err)
+		t.Cleanup(func() { _ = producer.Close() })
+		return testQueue{
+			producer: producer,
+			consumer: func(w *queueWorker) domain.LogConsumer {
+				return (&KafkaConsumer{queueWorker: w}).Subscribe(strings.Split(brokers, ","), topic, topic+"-group")
+			},
+			durable: true,
+		}
+	})
+}
+
+func TestRedisStreamConsumer_ClaimsEntriesOfDeadConsumer(t *testing.T) {
+	mr, err := miniredis.Run()
+	require.NoError(t, err)
+	defer mr.Close()
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	q := newRedisTestQueue(t, client)
+	ctx := context.Background()
+
+	sendAll(t, q.producer, "one", "two")
+	// A consumer reads both entries, then dies without acknowledging them
+	require.NoError(t, client.XGroupCreateMkStream(ctx, "logs", "logpulse-group", "0").Err())
+	read, err := client.XReadGroup(ctx, &redis.XReadGroupArgs{Group: "logpulse-group", Consumer: "dead", Streams: []string{"logs", ">"}}).Result()
+	require.NoError(t, err)
+	require.Len(t, read[0].Messages, 2)
+
+	esRepo := &flakyESRepo{}
+	consumer := q.consumer(newConformanceWorker(&countingLogRepo{}, esRepo))
+	stop := runConsumer(consumer)
+	defer stop()
+	require.Eventually(t, func() bool { return indexedCount(esRepo) == 2 }, 10*time.Second, 10*time.Millisecond)
+
+	// Claimed entries are acknowledged like new ones
+	require.Eventually(t, func() bool {
+		pending, err := client.XPending(ctx, "logs", "logpulse-group").Result()
+		return err == nil && pending.Count == 0
+	}, 10*time.Second, 10*time.Millisecond)
+}
+
+func TestRedisStreamProducer_TrimsStream(t *testing.T) {
+	mr, err := miniredis.Run()
+	require.NoError(t, err)
+	defer mr.Close()
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+
+	cfg := config.QueueConfig{RedisStream: "logs", RedisMaxLen: 3}
+	producer := NewRedisStreamProducer(client, cfg, testEncoder(t), nil)
+	sendAll(t, producer, "1", "2", "3", "4", "5")
+
+	length, err := client.XLen(context.Background(), "logs").Result()
+	require.NoError(t, err)
+	assert.LessOrEqual(t, length, int64(5))
+	assert.GreaterOrEqual(t, length, int64(3))
+}
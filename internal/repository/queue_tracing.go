@@ -0,0 +1,67 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/IBM/sarama"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/Yupoer/logpulse/internal/tracing"
+)
+
+// startSendSpan starts the producer span of one SendLog to dest on system
+// (kafka, redis or channel). The returned carrier is the span's trace
+// context, to be sent along with the message.
+func startSendSpan(ctx context.Context, system, dest string) (trace.Span, map[string]string) {
+	ctx, span := tracing.Tracer().Start(ctx, "send "+dest,
+		trace.WithSpanKind(trace.SpanKindProducer),
+		trace.WithAttributes(
+			attribute.String("messaging.system", system),
+			attribute.String("messaging.destination.name", dest),
+		))
+	return span, tracing.Inject(ctx)
+}
+
+// startProcessSpan starts the consumer span of a batch flush. A batch holds
+// logs from many requests, so instead of a single parent the span links to
+// the producer span of every message.
+func startProcessSpan(ctx context.Context, msgs []*queueMessage) (context.Context, trace.Span) {
+	links := make([]trace.Link, 0, len(msgs))
+	for _, msg := range msgs {
+		if sc := tracing.SpanContext(msg.Trace); sc.IsValid() {
+			links = append(links, trace.Link{SpanContext: sc})
+		}
+	}
+	topic := msgs[len(msgs)-1].Topic
+	return tracing.Tracer().Start(ctx, "process "+topic,
+		trace.WithSpanKind(trace.SpanKindConsumer),
+		trace.WithLinks(links...),
+		trace.WithAttributes(
+			attribute.String("messaging.destination.name", topic),
+			attribute.Int("messaging.batch.message_count", len(msgs)),
+		))
+}
+
+// traceHeaders turns a trace carrier into Kafka record headers
+func traceHeaders(carrier map[string]string) []sarama.RecordHeader {
+	headers := make([]sarama.RecordHeader, 0, len(carrier))
+	for k, v := range carrier {
+		headers = append(headers, sarama.RecordHeader{Key: []byte(k), Value: []byte(v)})
+	}
+	return headers
+}
+
+// traceFromHeaders reads the trace context fields out of Kafka record headers
+func traceFromHeaders(headers []*sarama.RecordHeader) map[string]string {
+	var carrier map[string]string
+	for _, field := range tracing.Propagator().Fields() {
+		if v := headerValue(headers, field); v != "" {
+			if carrier == nil {
+				carrier = map[string]string{}
+			}
+			carrier[field] = v
+		}
+	}
+	return carrier
+}
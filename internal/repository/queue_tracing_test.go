@@ -0,0 +1,103 @@
+package repository
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/IBM/sarama"
+	"github.com/IBM/sarama/mocks"
+	"github.com/Yupoer/logpulse/internal/domain"
+	"github.com/Yupoer/logpulse/internal/envelope"
+	"github.com/Yupoer/logpulse/internal/resilience"
+	"github.com/Yupoer/logpulse/internal/tracing"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// recordSpans installs a global tracer provider recording every span for
+// the rest of the test
+func recordSpans(t *testing.T) *tracetest.SpanRecorder {
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	prevProvider, prevPropagator := otel.GetTracerProvider(), otel.GetTextMapPropagator()
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	t.Cleanup(func() {
+		otel.SetTracerProvider(prevProvider)
+		otel.SetTextMapPropagator(prevPropagator)
+	})
+	return recorder
+}
+
+func endedSpan(t *testing.T, recorder *tracetest.SpanRecorder, name string) sdktrace.ReadOnlySpan {
+	t.Helper()
+	for _, s := range recorder.Ended() {
+		if s.Name() == name {
+			return s
+		}
+	}
+	require.Failf(t, "span not recorded", "no ended span %q", name)
+	return nil
+}
+
+func TestKafkaProducer_InjectsTraceContext(t *testing.T) {
+	recorder := recordSpans(t)
+	ctx, request := otel.Tracer("test").Start(context.Background(), "POST /logs")
+
+	var traceparent string
+	mock := mocks.NewSyncProducer(t, nil)
+	mock.ExpectSendMessageWithMessageCheckerFunctionAndSucceed(func(msg *sarama.ProducerMessage) error {
+		traceparent = producerHeader(msg.Headers, "traceparent")
+		return nil
+	})
+	p := &kafkaProducer{
+		producer: mock,
+		topic:    "logs_topic",
+		encoder:  envelope.Encoder{ContentType: envelope.ContentTypeJSON},
+		breaker:  resilience.NewBreaker("kafka", 5, time.Hour),
+	}
+	require.NoError(t, p.SendLog(ctx, &domain.LogEntry{ServiceName: "payment-service", Message: "traced"}))
+	request.End()
+
+	send := endedSpan(t, recorder, "send logs_topic")
+	assert.Equal(t, trace.SpanKindProducer, send.SpanKind())
+	assert.Equal(t, request.SpanContext().SpanID(), send.Parent().SpanID())
+
+	// The consumer side sees the send span as the message's remote parent
+	remote := traceFromHeaders([]*sarama.RecordHeader{{Key: []byte("traceparent"), Value: []byte(traceparent)}})
+	assert.Equal(t, send.SpanContext().SpanID(), tracing.SpanContext(remote).SpanID())
+	require.NoError(t, mock.Close())
+}
+
+func TestQueueWorker_BatchSpanLinksProducerSpans(t *testing.T) {
+	recorder := recordSpans(t)
+	queue := NewChannelQueue(16, testEncoder(t))
+	esRepo := &flakyESRepo{}
+	stop := runConsumer((&ChannelConsumer{queueWorker: newConformanceWorker(&countingLogRepo{}, esRepo)}).Subscribe(queue))
+	defer stop()
+
+	// Two requests, each with its own trace, land in the same batch
+	var requests []trace.Span
+	for range 2 {
+		ctx, span := otel.Tracer("test").Start(context.Background(), "POST /logs")
+		require.NoError(t, queue.Producer().SendLog(ctx, &domain.LogEntry{ServiceName: "payment-service"}))
+		span.End()
+		requests = append(requests, span)
+	}
+	require.Eventually(t, func() bool { return indexedCount(esRepo) == 2 }, time.Second, time.Millisecond)
+	stop()
+
+	process := endedSpan(t, recorder, "process channel")
+	assert.Equal(t, trace.SpanKindConsumer, process.SpanKind())
+	require.Len(t, process.Links(), 2)
+	for i, link := range process.Links() {
+		// Linked to the send span, which is in the request's trace
+		assert.Equal(t, requests[i].SpanContext().TraceID(), link.SpanContext.TraceID())
+	}
+}
@@ -0,0 +1,394 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/Yupoer/logpulse/internal/config"
+	"github.com/Yupoer/logpulse/internal/domain"
+	"github.com/Yupoer/logpulse/internal/envelope"
+	"github.com/Yupoer/logpulse/internal/metrics"
+	"github.com/Yupoer/logpulse/internal/resilience"
+	"github.com/Yupoer/logpulse/internal/tracing"
+)
+
+// queueMessage is a message read from any queue backend
+type queueMessage struct {
+	Topic       string // Kafka topic or Redis stream
+	Partition   int32
+	Offset      int64
+	ID          string // Redis stream entry ID
+	Key         []byte
+	Value       []byte
+	ContentType string
+	RequestID   string            // Of the API request that sent the log
+	Trace       map[string]string // Producer's trace context
+	raw         any               // Backend message, for committing
+}
+
+// logAttrs identify the message in log lines, with the request that sent it
+func (m *queueMessage) logAttrs() []any {
+	attrs := []any{"topic", m.Topic, "partition", m.Partition, "offset", m.Offset}
+	if m.ID != "" {
+		attrs = append(attrs, "entry_id", m.ID)
+	}
+	if m.RequestID != "" {
+		attrs = append(attrs, "request_id", m.RequestID)
+	}
+	return attrs
+}
+
+// requestIDs lists the request IDs of msgs, for log lines about a batch
+func requestIDs(msgs []*queueMessage) []string {
+	ids := make([]string, 0, len(msgs))
+	for _, msg := range msgs {
+		if msg.RequestID != "" {
+			ids = append(ids, msg.RequestID)
+		}
+	}
+	return ids
+}
+
+// queueWorker batches logs from a queue into the DB and ES. It is shared by
+// every queue backend; the backend feeds it messages and commits them once
+// they are stored.
+type queueWorker struct {
+	mysqlRepo domain.LogRepository
+	esRepo    domain.LogSearchRepository
+	// Optional: poison and permanently failing messages are published here
+	// instead of blocking the partition (nil = log and skip poison messages)
+	deadLetters domain.DeadLetterQueue
+	maxAttempts int // Failed flushes before entries are tried one by one
+
+	resilience ConsumerResilience
+
+	batchSize     int
+	flushInterval time.Duration
+
+	stats consumerStats
+}
+
+// consumerStats tracks progress across all claims for the pipeline status
+type consumerStats struct {
+	mu           sync.Mutex
+	pending      map[int32]int // Buffered entries per claimed partition
+	lastFlushAt  time.Time
+	flushedTotal int64
+	dbErrors     int64
+	esErrors     int64
+	deadLettered int64
+}
+
+func (s *consumerStats) update(fn func(s *consumerStats)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.pending == nil {
+		s.pending = map[int32]int{}
+	}
+	fn(s)
+}
+
+// ConsumerResilience groups how a queue consumer copes with failing dependencies
+type ConsumerResilience struct {
+	Backoff   resilience.Backoff  // Between failed flushes and consumer restarts
+	DBBreaker *resilience.Breaker // Optional
+	ESBreaker *resilience.Breaker // Optional
+}
+
+func newQueueWorker(mysqlRepo domain.LogRepository, esRepo domain.LogSearchRepository, deadLetters domain.DeadLetterQueue, maxAttempts int, res ConsumerResilience) *queueWorker {
+	return &queueWorker{
+		mysqlRepo:     mysqlRepo,
+		esRepo:        esRepo,
+		deadLetters:   deadLetters,
+		maxAttempts:   maxAttempts,
+		resilience:    res,
+		batchSize:     100,
+		flushInterval: 1 * time.Second,
+	}
+}
+
+// SetBatching overrides the default batch size (100) and flush interval (1s)
+func (w *queueWorker) SetBatching(cfg config.ConsumerConfig) {
+	w.batchSize = cfg.BatchSize
+	w.flushInterval = cfg.FlushInterval
+}
+
+// Stats reports buffered entries, the last successful flush and error
+// counts since startup. Replica and UpdatedAt are left to the caller.
+func (w *queueWorker) Stats() domain.ConsumerStats {
+	w.stats.mu.Lock()
+	defer w.stats.mu.Unlock()
+
+	fill := 0
+	for _, n := range w.stats.pending {
+		fill += n
+	}
+	return domain.ConsumerStats{
+		BatchFill:    fill,
+		BatchSize:    w.batchSize,
+		Claims:       len(w.stats.pending),
+		LastFlushAt:  w.stats.lastFlushAt,
+		FlushedTotal: w.stats.flushedTotal,
+		DBErrors:     w.stats.dbErrors,
+		ESErrors:     w.stats.esErrors,
+		DeadLettered: w.stats.deadLettered,
+	}
+}
+
+// batchItem is a decoded entry and the message it came from
+type batchItem struct {
+	msg   *queueMessage
+	entry *domain.LogEntry
+}
+
+// consumerBatch is everything consumed since the last commit
+type consumerBatch struct {
+	items  []batchItem
+	stored []batchItem          // Stored one by one while isolating failures
+	dead   []*domain.DeadLetter // Waiting to be published to the dead-letter topic
+	msgs   []*queueMessage      // Every message read, stored or not, in order
+}
+
+// consume implements the Batch Processing Logic for one partition (or
+// stream) until messages is closed or ctx is done.
+func (w *queueWorker) consume(ctx context.Context, partition int32, messages <-chan *queueMessage, commit func(batch []*queueMessage) error) {
+	consumeFrom(ctx, w, partition, messages, func(msg *queueMessage) *queueMessage { return msg }, commit)
+}
+
+// consumeFrom is consume for backends with their own message type. Reading
+// the backend channel directly, rather than through a forwarding goroutine,
+// means nothing is read ahead while a failing flush pauses the partition.
+//
+// Delivery is at-least-once: commit is called only after the whole batch
+// is in both the DB and ES (or in the dead-letter topic). A failing flush is
+// retried with backoff and no new messages are read meanwhile, which pauses
+// the partition. If ctx ends first, the uncommitted messages are left for
+// the backend to redeliver.
+func consumeFrom[M any](ctx context.Context, w *queueWorker, partition int32, messages <-chan M, convert func(M) *queueMessage, commit func(batch []*queueMessage) error) {
+	// Buffer to hold logs
+	batch := &consumerBatch{items: make([]batchItem, 0, w.batchSize)}
+	w.stats.update(func(s *consumerStats) { s.pending[partition] = 0 })
+	defer w.stats.update(func(s *consumerStats) { delete(s.pending, partition) })
+
+	// Ticker for time-based flush
+	ticker := time.NewTicker(w.flushInterval)
+	defer ticker.Stop()
+
+	// Helper function to flush batch to DB + ES and commit its messages
+	flush := func() {
+		if len(batch.msgs) == 0 {
+			return
+		}
+		last := batch.msgs[len(batch.msgs)-1]
+		start := time.Now()
+		spanCtx, span := startProcessSpan(ctx, batch.msgs)
+		err := w.flushWithRetry(spanCtx, batch)
+		tracing.End(span, err)
+		if err != nil {
+			slog.Warn("Flush abandoned, offsets left uncommitted",
+				"logs", len(batch.items), "topic", last.Topic, "partition", last.Partition, "last_offset", last.Offset,
+				"request_ids", requestIDs(batch.msgs), "error", err)
+			return
+		}
+		metrics.ConsumerFlushDuration.WithLabelValues(last.Topic).Observe(time.Since(start).Seconds())
+		stored := append(batch.stored, batch.items...)
+		metrics.ConsumerBatchSize.WithLabelValues(last.Topic).Observe(float64(len(stored)))
+		if err := commit(batch.msgs); err != nil {
+			// Stored but not committed: the messages are redelivered later
+			slog.Warn("Commit failed, messages will be redelivered", "messages", len(batch.msgs), "topic", last.Topic, "error", err)
+		}
+		for _, item := range stored {
+			slog.Debug("Log stored", append(item.msg.logAttrs(), "id", item.entry.ID)...)
+		}
+		w.stats.update(func(s *consumerStats) {
+			s.pending[partition] = 0
+			s.lastFlushAt = time.Now()
+			s.flushedTotal += int64(len(stored))
+		})
+		// Reset buffer (keep capacity)
+		batch.items = batch.items[:0]
+		batch.stored = stored[:0]
+		batch.msgs = batch.msgs[:0]
+	}
+
+	for {
+		select {
+		case raw, ok := <-messages:
+			if !ok {
+				flush() // Channel closed, flush remaining
+				return
+			}
+			msg := convert(raw)
+			batch.msgs = append(batch.msgs, msg)
+
+			// 1. Decode (legacy JSON, JSON envelope or Protobuf envelope)
+			env, err := envelope.Decode(msg.ContentType, msg.Value)
+			if err != nil {
+				slog.Error("Failed to decode log", append(msg.logAttrs(), "error", err)...)
+				if w.deadLetters != nil {
+					batch.dead = append(batch.dead, newDeadLetter(msg, err, 1))
+				}
+				continue // Skip bad message, it is committed with the batch
+			}
+
+			// 2. Add to Batch
+			batch.items = append(batch.items, batchItem{msg: msg, entry: env.Entry})
+			w.stats.update(func(s *consumerStats) { s.pending[partition] = len(batch.items) })
+
+			// 3. Check Batch Size
+			if len(batch.items) >= w.batchSize {
+				flush()
+			}
+
+		case <-ticker.C:
+			// 4. Time Trigger
+			flush()
+
+		case <-ctx.Done():
+			// 5. Graceful Shutdown
+			flush()
+			return
+		}
+	}
+}
+
+// flushWithRetry writes batch until it succeeds or ctx is done. Once ctx is
+// done (rebalance or shutdown) one last attempt is made without waiting.
+// Every maxAttempts failures the entries are isolated, so a single bad entry
+// is dead-lettered (or dropped, without a dead-letter queue) instead of
+// blocking the partition forever.
+func (w *queueWorker) flushWithRetry(ctx context.Context, batch *consumerBatch) error {
+	// Writes keep ctx's span but not its cancellation, the last attempt runs
+	// after ctx is done
+	writeCtx := context.WithoutCancel(ctx)
+	for attempt := 1; ; attempt++ {
+		err := w.writeBatch(writeCtx, batch)
+		if err == nil {
+			return nil
+		}
+		if ctx.Err() != nil {
+			return err
+		}
+		if w.maxAttempts > 0 && len(batch.dead) == 0 && attempt%w.maxAttempts == 0 && w.isolateFailures(writeCtx, batch, attempt) {
+			continue // Bad entries set aside, the rest is stored
+		}
+		delay := w.resilience.Backoff.Delay(attempt)
+		slog.Warn("Flush failed, retrying", "attempt", attempt, "retry_in", delay,
+			"logs", len(batch.items), "request_ids", requestIDs(batch.msgs), "error", err)
+		_ = resilience.Sleep(ctx, delay)
+	}
+}
+
+// writeBatch publishes pending dead letters, stores the entries in the DB,
+// then bulk indexes them into ES. Work finished by an earlier attempt is not
+// repeated: published dead letters are dropped from the batch and saved
+// entries already have an ID. ES uses that ID as document ID, so re-indexing
+// them is idempotent.
+func (w *queueWorker) writeBatch(ctx context.Context, batch *consumerBatch) error {
+	for len(batch.dead) > 0 {
+		if err := w.deadLetters.Publish(ctx, batch.dead[0]); err != nil {
+			metrics.ConsumerFlushFailures.WithLabelValues(batch.dead[0].SourceTopic, "dead_letter").Inc()
+			return fmt.Errorf("publish dead letter: %w", err)
+		}
+		batch.dead = batch.dead[1:]
+		w.stats.update(func(s *consumerStats) { s.deadLettered++ })
+	}
+	return w.writeItems(ctx, batch.items)
+}
+
+func (w *queueWorker) writeItems(ctx context.Context, items []batchItem) error {
+	if len(items) == 0 {
+		return nil
+	}
+
+	topic := items[0].msg.Topic
+
+	// Write to DB (durable copy, also assigns the IDs used by ES)
+	entries := make([]*domain.LogEntry, 0, len(items))
+	for _, item := range items {
+		if item.entry.ID == 0 {
+			err := w.resilience.DBBreaker.Do(func() error {
+				return w.mysqlRepo.Create(ctx, item.entry)
+			})
+			if err != nil {
+				w.stats.update(func(s *consumerStats) { s.dbErrors++ })
+				metrics.ConsumerFlushFailures.WithLabelValues(topic, "db").Inc()
+				return fmt.Errorf("save log to DB: %w", err)
+			}
+		}
+		entries = append(entries, item.entry)
+	}
+
+	// Write to ES
+	var rejected error
+	err := w.resilience.ESBreaker.Do(func() error {
+		err := w.esRepo.BulkIndex(ctx, entries)
+		if errors.Is(err, domain.ErrLogRejected) {
+			rejected = err // ES answered, the entries are at fault
+			return nil
+		}
+		return err
+	})
+	if rejected != nil {
+		err = rejected
+	}
+	if err != nil {
+		w.stats.update(func(s *consumerStats) { s.esErrors++ })
+		metrics.ConsumerFlushFailures.WithLabelValues(topic, "es").Inc()
+		return fmt.Errorf("bulk index to ES: %w", err)
+	}
+	slog.Debug("Bulk indexed logs to ES", "logs", len(entries), "topic", topic)
+	return nil
+}
+
+// isolateFailures writes each entry on its own and moves entries a store
+// rejected (domain.ErrLogRejected: an ES mapping conflict, a value the DB
+// refuses) to batch.dead, or logs and drops them when no dead-letter queue
+// is wired, like undecodable messages. Every other failure may be
+// transient, such as a timeout, a reset connection or an open circuit
+// breaker, so those entries stay in the batch to be retried. It reports
+// whether any entry was set aside.
+func (w *queueWorker) isolateFailures(ctx context.Context, batch *consumerBatch, attempts int) bool {
+	var retry []batchItem
+	setAside := false
+	for _, item := range batch.items {
+		err := w.writeItems(ctx, []batchItem{item})
+		if err == nil {
+			batch.stored = append(batch.stored, item)
+			continue
+		}
+		if !errors.Is(err, domain.ErrLogRejected) {
+			retry = append(retry, item)
+			continue
+		}
+		setAside = true
+		if w.deadLetters == nil {
+			// Committed with the batch, like a message that fails to decode
+			slog.Error("Dropping rejected log", append(item.msg.logAttrs(), "attempts", attempts, "error", err)...)
+			continue
+		}
+		slog.Warn("Dead-lettering log", append(item.msg.logAttrs(), "error", err)...)
+		batch.dead = append(batch.dead, newDeadLetter(item.msg, err, attempts))
+	}
+	batch.items = append(batch.items[:0], retry...)
+	return setAside
+}
+
+func newDeadLetter(msg *queueMessage, err error, attempts int) *domain.DeadLetter {
+	return &domain.DeadLetter{
+		SourceTopic:     msg.Topic,
+		SourcePartition: msg.Partition,
+		SourceOffset:    msg.Offset,
+		Error:           err.Error(),
+		Attempts:        attempts,
+		FailedAt:        time.Now(),
+		Key:             msg.Key,
+		Value:           msg.Value,
+		ContentType:     msg.ContentType,
+		RequestID:       msg.RequestID,
+	}
+}
@@ -0,0 +1,102 @@
+package repository
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/Yupoer/logpulse/internal/domain"
+	"github.com/redis/go-redis/v9"
+)
+
+// One hash per worker replica, expiring unless refreshed
+const consumerStatsKeyPrefix = "stats:consumer:"
+
+type redisConsumerStatsStore struct {
+	client *redis.Client
+}
+
+func NewConsumerStatsStore(client *redis.Client) domain.ConsumerStatsStore {
+	return &redisConsumerStatsStore{client: client}
+}
+
+func (s *redisConsumerStatsStore) Publish(ctx context.Context, stats domain.ConsumerStats, ttl time.Duration) error {
+	key := consumerStatsKeyPrefix + stats.Replica
+	_, err := s.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.HSet(ctx, key, map[string]interface{}{
+			"replica":       stats.Replica,
+			"batch_fill":    stats.BatchFill,
+			"batch_size":    stats.BatchSize,
+			"claims":        stats.Claims,
+			"last_flush_at": formatStatsTime(stats.LastFlushAt),
+			"flushed_total": stats.FlushedTotal,
+			"db_errors":     stats.DBErrors,
+			"es_errors":     stats.ESErrors,
+			"dead_lettered": stats.DeadLettered,
+			"updated_at":    formatStatsTime(stats.UpdatedAt),
+		})
+		pipe.Expire(ctx, key, ttl)
+		return nil
+	})
+	return err
+}
+
+func (s *redisConsumerStatsStore) List(ctx context.Context) ([]*domain.ConsumerStats, error) {
+	var keys []string
+	iter := s.client.Scan(ctx, 0, consumerStatsKeyPrefix+"*", 100).Iterator()
+	for iter.Next(ctx) {
+		keys = append(keys, iter.Val())
+	}
+	if err := iter.Err(); err != nil {
+		return nil, err
+	}
+
+	stats := make([]*domain.ConsumerStats, 0, len(keys))
+	for _, key := range keys {
+		fields, err := s.client.HGetAll(ctx, key).Result()
+		if err != nil {
+			return nil, err
+		}
+		if len(fields) == 0 {
+			continue // Expired between SCAN and HGETALL
+		}
+		stats = append(stats, parseConsumerStats(fields))
+	}
+	return stats, nil
+}
+
+func parseConsumerStats(fields map[string]string) *domain.ConsumerStats {
+	atoi := func(name string) int {
+		n, _ := strconv.Atoi(fields[name])
+		return n
+	}
+	atoi64 := func(name string) int64 {
+		n, _ := strconv.ParseInt(fields[name], 10, 64)
+		return n
+	}
+	parseTime := func(name string) time.Time {
+		t, _ := time.Parse(time.RFC3339Nano, fields[name])
+		return t
+	}
+
+	return &domain.ConsumerStats{
+		Replica:      fields["replica"],
+		BatchFill:    atoi("batch_fill"),
+		BatchSize:    atoi("batch_size"),
+		Claims:       atoi("claims"),
+		LastFlushAt:  parseTime("last_flush_at"),
+		FlushedTotal: atoi64("flushed_total"),
+		DBErrors:     atoi64("db_errors"),
+		ESErrors:     atoi64("es_errors"),
+		DeadLettered: atoi64("dead_lettered"),
+		UpdatedAt:    parseTime("updated_at"),
+	}
+}
+
+// formatStatsTime keeps the zero time empty ("never flushed")
+func formatStatsTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339Nano)
+}
@@ -0,0 +1,64 @@
+package repository
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Yupoer/logpulse/internal/domain"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConsumerStatsStore_PublishAndList(t *testing.T) {
+	mr, err := miniredis.Run()
+	require.NoError(t, err)
+	defer mr.Close()
+
+	store := NewConsumerStatsStore(redis.NewClient(&redis.Options{Addr: mr.Addr()}))
+	ctx := context.Background()
+	flushedAt := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	require.NoError(t, store.Publish(ctx, domain.ConsumerStats{
+		Replica:      "worker-a",
+		BatchFill:    12,
+		BatchSize:    100,
+		Claims:       2,
+		LastFlushAt:  flushedAt,
+		FlushedTotal: 500,
+		DBErrors:     1,
+		ESErrors:     3,
+		DeadLettered: 4,
+	}, 15*time.Second))
+	// A replica that has never flushed
+	require.NoError(t, store.Publish(ctx, domain.ConsumerStats{Replica: "worker-b"}, 30*time.Second))
+
+	stats, err := store.List(ctx)
+	require.NoError(t, err)
+	require.Len(t, stats, 2)
+
+	byReplica := map[string]*domain.ConsumerStats{}
+	for _, s := range stats {
+		byReplica[s.Replica] = s
+	}
+	a := byReplica["worker-a"]
+	require.NotNil(t, a)
+	assert.Equal(t, 12, a.BatchFill)
+	assert.Equal(t, 100, a.BatchSize)
+	assert.Equal(t, 2, a.Claims)
+	assert.True(t, flushedAt.Equal(a.LastFlushAt))
+	assert.Equal(t, int64(500), a.FlushedTotal)
+	assert.Equal(t, int64(1), a.DBErrors)
+	assert.Equal(t, int64(3), a.ESErrors)
+	assert.Equal(t, int64(4), a.DeadLettered)
+	assert.True(t, byReplica["worker-b"].LastFlushAt.IsZero())
+
+	// worker-a stops publishing and drops out once its entry expires
+	mr.FastForward(20 * time.Second)
+	stats, err = store.List(ctx)
+	require.NoError(t, err)
+	require.Len(t, stats, 1)
+	assert.Equal(t, "worker-b", stats[0].Replica)
+}
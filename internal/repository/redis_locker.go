@@ -0,0 +1,92 @@
+package repository
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/Yupoer/logpulse/internal/domain"
+	"github.com/redis/go-redis/v9"
+)
+
+// Only delete the key if we still own it (the TTL may have expired and
+// another replica taken over in the meantime)
+const releaseLockScript = `
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+    return redis.call("DEL", KEYS[1])
+end
+return 0
+`
+
+// Only extend the key's TTL (ARGV[2], in ms) if we still own it
+const refreshLockScript = `
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+    return redis.call("PEXPIRE", KEYS[1], ARGV[2])
+end
+return 0
+`
+
+type redisLocker struct {
+	client  *redis.Client
+	release *redis.Script
+	refresh *redis.Script
+}
+
+func NewRedisLocker(client *redis.Client) domain.Locker {
+	return &redisLocker{
+		client:  client,
+		release: redis.NewScript(releaseLockScript),
+		refresh: redis.NewScript(refreshLockScript),
+	}
+}
+
+func (l *redisLocker) TryLock(ctx context.Context, key string, ttl time.Duration) (func(), bool, error) {
+	token := make([]byte, 16)
+	if _, err := rand.Read(token); err != nil {
+		return nil, false, err
+	}
+	value := hex.EncodeToString(token)
+
+	ok, err := l.client.SetNX(ctx, "lock:"+key, value, ttl).Result()
+	if err != nil || !ok {
+		return nil, false, err
+	}
+
+	done := make(chan struct{})
+	go l.keepAlive(key, value, ttl, done)
+
+	var once sync.Once
+	release := func() {
+		once.Do(func() {
+			close(done)
+			_ = l.release.Run(context.Background(), l.client, []string{"lock:" + key}, value).Err()
+		})
+	}
+	return release, true, nil
+}
+
+// keepAlive extends the lock's TTL every third of it until done is closed,
+// so a holder that runs longer than ttl keeps the lock
+func (l *redisLocker) keepAlive(key, value string, ttl time.Duration, done <-chan struct{}) {
+	ticker := time.NewTicker(ttl / 3)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+		}
+		owned, err := l.refresh.Run(context.Background(), l.client, []string{"lock:" + key}, value, ttl.Milliseconds()).Int()
+		if err != nil {
+			slog.Warn("Failed to refresh lock", "key", key, "error", err)
+			continue
+		}
+		if owned == 0 {
+			slog.Warn("Lock expired while held", "key", key)
+			return
+		}
+	}
+}
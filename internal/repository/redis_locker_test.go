@@ -0,0 +1,38 @@
+package repository
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRedisLocker_KeepsLockUntilRelease(t *testing.T) {
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { _ = client.Close() })
+	locker := NewRedisLocker(client)
+	ctx := context.Background()
+
+	release, ok, err := locker.TryLock(ctx, "job", 300*time.Millisecond)
+	require.NoError(t, err)
+	require.True(t, ok)
+
+	// Most of the TTL passes; the holder extends it back to the full TTL
+	mr.FastForward(250 * time.Millisecond)
+	assert.Eventually(t, func() bool { return mr.TTL("lock:job") == 300*time.Millisecond }, time.Second, 10*time.Millisecond)
+
+	_, ok, err = locker.TryLock(ctx, "job", 300*time.Millisecond)
+	require.NoError(t, err)
+	assert.False(t, ok, "still held")
+
+	release()
+	assert.False(t, mr.Exists("lock:job"))
+	_, ok, err = locker.TryLock(ctx, "job", 300*time.Millisecond)
+	require.NoError(t, err)
+	assert.True(t, ok)
+}
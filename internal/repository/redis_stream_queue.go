@@ -0,0 +1,293 @@
+package repository
+
+import (
+	"context"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Yupoer/logpulse/internal/config"
+	"github.com/Yupoer/logpulse/internal/domain"
+	"github.com/Yupoer/logpulse/internal/envelope"
+	"github.com/Yupoer/logpulse/internal/logging"
+	"github.com/Yupoer/logpulse/internal/resilience"
+	"github.com/Yupoer/logpulse/internal/tracing"
+	"github.com/redis/go-redis/v9"
+)
+
+// Stream entry fields
+const (
+	streamFieldKey         = "k"   // Service name, like the Kafka message key
+	streamFieldValue       = "v"   // Encoded envelope
+	streamFieldContentType = "ct"  // Envelope content type
+	streamFieldRequestID   = "rid" // API request ID, when there was one
+)
+
+// redisStreamBlock is how long one XREADGROUP waits for new entries
+const redisStreamBlock = 1 * time.Second
+
+type redisStreamProducer struct {
+	client  *redis.Client
+	stream  string
+	maxLen  int64
+	encoder envelope.Encoder
+	breaker *resilience.Breaker
+}
+
+// NewRedisStreamProducer appends logs to a Redis stream, trimmed to about
+// cfg.RedisMaxLen entries. While breaker is open SendLog fails fast with
+// resilience.ErrCircuitOpen.
+func NewRedisStreamProducer(client *redis.Client, cfg config.QueueConfig, encoder envelope.Encoder, breaker *resilience.Breaker) domain.LogProducer {
+	return &redisStreamProducer{
+		client:  client,
+		stream:  cfg.RedisStream,
+		maxLen:  cfg.RedisMaxLen,
+		encoder: encoder,
+		breaker: breaker,
+	}
+}
+
+func (p *redisStreamProducer) SendLog(ctx context.Context, entry *domain.LogEntry) error {
+	bytes, err := p.encoder.Encode(entry, time.Now())
+	if err != nil {
+		return err
+	}
+	span, carrier := startSendSpan(ctx, "redis", p.stream)
+	values := map[string]interface{}{
+		streamFieldKey:         entry.ServiceName,
+		streamFieldValue:       bytes,
+		streamFieldContentType: p.encoder.ContentType,
+	}
+	if id := logging.RequestID(ctx); id != "" {
+		values[streamFieldRequestID] = id
+	}
+	for k, v := range carrier {
+		values[k] = v // Trace context fields (traceparent, ...) as they are
+	}
+	err = p.breaker.Do(func() error {
+		return p.client.XAdd(ctx, &redis.XAddArgs{
+			Stream: p.stream,
+			MaxLen: p.maxLen,
+			Approx: true, // MAXLEN ~ trims whole macro nodes, which is much cheaper
+			Values: values,
+		}).Err()
+	})
+	tracing.End(span, err)
+	return err
+}
+
+// Close is a no-op, the Redis client is shared
+func (p *redisStreamProducer) Close() error { return nil }
+
+// RedisStreamConsumer reads a Redis stream as a member of a consumer group.
+// Entries are acknowledged (XACK) once their batch is stored. Entries left
+// pending by a member that died are taken over with XAUTOCLAIM after they
+// have been idle for claimIdle.
+type RedisStreamConsumer struct {
+	*queueWorker
+
+	// Set by Subscribe, used by Run
+	client    *redis.Client
+	stream    string
+	group     string
+	consumer  string
+	claimIdle time.Duration
+
+	mu       sync.Mutex
+	inFlight map[string]bool // Read but not acknowledged yet, never claimed from ourselves
+}
+
+func NewRedisStreamConsumer(mysqlRepo domain.LogRepository, esRepo domain.LogSearchRepository, deadLetters domain.DeadLetterQueue, maxAttempts int, res ConsumerResilience) *RedisStreamConsumer {
+	return &RedisStreamConsumer{
+		queueWorker: newQueueWorker(mysqlRepo, esRepo, deadLetters, maxAttempts, res),
+		inFlight:    map[string]bool{},
+	}
+}
+
+// Subscribe sets the stream and consumer group Run joins. consumer names
+// this member within the group and must be unique among live workers.
+func (c *RedisStreamConsumer) Subscribe(client *redis.Client, cfg config.QueueConfig, group, consumer string) *RedisStreamConsumer {
+	c.client, c.stream, c.claimIdle = client, cfg.RedisStream, cfg.RedisClaimIdle
+	c.group, c.consumer = group, consumer
+	return c
+}
+
+// Run implements domain.LogConsumer
+func (c *RedisStreamConsumer) Run(ctx context.Context) {
+	for attempt := 1; ; attempt++ {
+		err := c.createGroup(ctx)
+		if err == nil {
+			break
+		}
+		delay := c.resilience.Backoff.Delay(attempt)
+		slog.Warn("Error creating stream consumer group, retrying", "stream", c.stream, "retry_in", delay, "error", err)
+		if resilience.Sleep(ctx, delay) != nil {
+			return
+		}
+	}
+
+	messages := make(chan *queueMessage)
+	var reader sync.WaitGroup
+	reader.Add(1)
+	go func() {
+		defer reader.Done()
+		c.read(ctx, messages)
+	}()
+
+	c.consume(ctx, 0, messages, c.ack)
+	reader.Wait()
+}
+
+// createGroup creates the group (and the stream) unless it already exists.
+// A new group starts at the beginning of the stream.
+func (c *RedisStreamConsumer) createGroup(ctx context.Context) error {
+	err := c.client.XGroupCreateMkStream(ctx, c.stream, c.group, "0").Err()
+	if err != nil && strings.HasPrefix(err.Error(), "BUSYGROUP") {
+		return nil
+	}
+	return err
+}
+
+// read feeds new and reclaimed entries to messages until ctx is done.
+// Entries read but never handed over stay pending and are claimed later.
+func (c *RedisStreamConsumer) read(ctx context.Context, messages chan<- *queueMessage) {
+	failures := 0
+	nextClaim := time.Now()
+	for ctx.Err() == nil {
+		var entries []redis.XMessage
+		var err error
+		if c.claimIdle > 0 && !time.Now().Before(nextClaim) {
+			entries, err = c.claim(ctx)
+			nextClaim = time.Now().Add(c.claimIdle)
+		}
+		if err == nil && len(entries) == 0 {
+			entries, err = c.readNew(ctx)
+		}
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			failures++
+			delay := c.resilience.Backoff.Delay(failures)
+			slog.Warn("Error reading stream, retrying", "stream", c.stream, "retry_in", delay, "error", err)
+			_ = resilience.Sleep(ctx, delay)
+			continue
+		}
+		failures = 0
+
+		for _, entry := range entries {
+			msg := c.toMessage(entry)
+			c.mu.Lock()
+			c.inFlight[msg.ID] = true
+			c.mu.Unlock()
+			select {
+			case messages <- msg:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}
+}
+
+func (c *RedisStreamConsumer) readNew(ctx context.Context) ([]redis.XMessage, error) {
+	streams, err := c.client.XReadGroup(ctx, &redis.XReadGroupArgs{
+		Group:    c.group,
+		Consumer: c.consumer,
+		Streams:  []string{c.stream, ">"},
+		Count:    int64(c.batchSize),
+		Block:    redisStreamBlock,
+	}).Result()
+	if err == redis.Nil {
+		return nil, nil // Nothing new within the block time
+	}
+	if err != nil {
+		return nil, err
+	}
+	var entries []redis.XMessage
+	for _, s := range streams {
+		entries = append(entries, s.Messages...)
+	}
+	return entries, nil
+}
+
+// claim takes over entries pending longer than claimIdle, skipping those
+// this consumer is still working on (a flush can outlast claimIdle while
+// the DB or ES is down).
+func (c *RedisStreamConsumer) claim(ctx context.Context) ([]redis.XMessage, error) {
+	var claimed []redis.XMessage
+	start := "0-0"
+	for {
+		entries, next, err := c.client.XAutoClaim(ctx, &redis.XAutoClaimArgs{
+			Stream:   c.stream,
+			Group:    c.group,
+			Consumer: c.consumer,
+			MinIdle:  c.claimIdle,
+			Start:    start,
+			Count:    int64(c.batchSize),
+		}).Result()
+		if err != nil {
+			return nil, err
+		}
+		c.mu.Lock()
+		for _, entry := range entries {
+			if !c.inFlight[entry.ID] {
+				claimed = append(claimed, entry)
+			}
+		}
+		c.mu.Unlock()
+		if next == "0-0" || next == "" {
+			break
+		}
+		start = next
+	}
+	if len(claimed) > 0 {
+		slog.Info("Claimed stuck stream entries", "stream", c.stream, "entries", len(claimed))
+	}
+	return claimed, nil
+}
+
+// ack acknowledges a stored batch. It runs during the final flush too, so
+// it must not use the consumer's (by then cancelled) context.
+func (c *RedisStreamConsumer) ack(batch []*queueMessage) error {
+	ids := make([]string, 0, len(batch))
+	for _, msg := range batch {
+		ids = append(ids, msg.ID)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	err := c.client.XAck(ctx, c.stream, c.group, ids...).Err()
+
+	c.mu.Lock()
+	for _, id := range ids {
+		delete(c.inFlight, id)
+	}
+	c.mu.Unlock()
+	return err
+}
+
+func (c *RedisStreamConsumer) toMessage(entry redis.XMessage) *queueMessage {
+	field := func(name string) string {
+		s, _ := entry.Values[name].(string)
+		return s
+	}
+	var trace map[string]string
+	for _, name := range tracing.Propagator().Fields() {
+		if v := field(name); v != "" {
+			if trace == nil {
+				trace = map[string]string{}
+			}
+			trace[name] = v
+		}
+	}
+	return &queueMessage{
+		Topic:       c.stream,
+		ID:          entry.ID,
+		Key:         []byte(field(streamFieldKey)),
+		Value:       []byte(field(streamFieldValue)),
+		ContentType: field(streamFieldContentType),
+		RequestID:   field(streamFieldRequestID),
+		Trace:       trace,
+		raw:         entry,
+	}
+}
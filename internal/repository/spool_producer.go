@@ -0,0 +1,470 @@
+package repository
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Yupoer/logpulse/internal/config"
+	"github.com/Yupoer/logpulse/internal/domain"
+	"github.com/Yupoer/logpulse/internal/envelope"
+	"github.com/Yupoer/logpulse/internal/resilience"
+)
+
+// Fsync policies for spool writes
+const (
+	SpoolFsyncAlways   = "always"   // fsync every record before SendLog returns
+	SpoolFsyncInterval = "interval" // fsync every SpoolConfig.FsyncInterval
+	SpoolFsyncNever    = "never"    // leave it to the OS
+)
+
+const (
+	spoolSegmentExt  = ".seg"
+	spoolCursorFile  = "cursor"
+	spoolRecordHead  = 8   // uint32 length + uint32 CRC-32C of the payload
+	spoolCursorEvery = 100 // Persist drain progress every this many records
+)
+
+var (
+	spoolCRC           = crc32.MakeTable(crc32.Castagnoli)
+	errSpoolCorruption = errors.New("corrupt spool record")
+)
+
+// SpoolStats reports how much is waiting on disk for Kafka
+type SpoolStats struct {
+	Segments int   `json:"segments"`
+	Entries  int64 `json:"entries"`
+	Bytes    int64 `json:"bytes"`
+}
+
+type spoolSegment struct {
+	id      uint64
+	records int64 // Not drained yet
+	size    int64
+}
+
+// SpoolProducer is a write-ahead spool in front of another LogProducer.
+// While the spool is empty logs go straight through; when a send fails the
+// log is appended to a segment file instead and SendLog still succeeds.
+// Once anything is spooled, new logs are spooled too, so Run drains them to
+// Kafka in the order they were accepted.
+type SpoolProducer struct {
+	next    domain.LogProducer
+	cfg     config.SpoolConfig
+	backoff resilience.Backoff
+	encoder envelope.Encoder // Records are JSON envelopes, stable across upgrades
+
+	mu         sync.Mutex
+	segments   []*spoolSegment // Oldest first, the last one may be active
+	active     *os.File        // Segment being appended to, nil until the next write
+	activeSize int64
+	nextID     uint64
+	entries    int64
+	bytes      int64
+	dirty      bool // Written but not fsynced (interval policy)
+	closed     bool
+
+	wake chan struct{}
+}
+
+// NewSpoolProducer opens (or creates) the spool in cfg.Dir. Segments left by
+// a previous run are kept and drained first; a record torn by a crash is
+// truncated away.
+func NewSpoolProducer(next domain.LogProducer, cfg config.SpoolConfig, backoff resilience.Backoff) (*SpoolProducer, error) {
+	if err := os.MkdirAll(cfg.Dir, 0o755); err != nil {
+		return nil, fmt.Errorf("create spool dir: %w", err)
+	}
+	s := &SpoolProducer{
+		next:    next,
+		cfg:     cfg,
+		backoff: backoff,
+		encoder: envelope.Encoder{ContentType: envelope.ContentTypeJSON},
+		nextID:  1,
+		wake:    make(chan struct{}, 1),
+	}
+	if err := s.load(); err != nil {
+		return nil, err
+	}
+	if s.entries > 0 {
+		slog.Info("Found spooled logs, draining to Kafka", "logs", s.entries, "segments", len(s.segments))
+	}
+	return s, nil
+}
+
+func (s *SpoolProducer) SendLog(ctx context.Context, entry *domain.LogEntry) error {
+	s.mu.Lock()
+	backlog := s.entries > 0
+	s.mu.Unlock()
+
+	if !backlog {
+		err := s.next.SendLog(ctx, entry)
+		// Only a send cut short by ctx is left to the caller; a delivery
+		// that failed is spooled even if ctx ended meanwhile
+		if err == nil || (ctx.Err() != nil && errors.Is(err, ctx.Err())) {
+			return err
+		}
+		slog.WarnContext(ctx, "Kafka send failed, spooling log", "error", err)
+	}
+	return s.append(entry)
+}
+
+// Spool appends entry to the spool without trying the wrapped producer
+// first, e.g. for a log whose async delivery failed after SendLog returned
+func (s *SpoolProducer) Spool(entry *domain.LogEntry) error {
+	return s.append(entry)
+}
+
+// Close closes the wrapped producer, then fsyncs the active segment.
+// Deliveries that fail while the wrapped producer flushes are still spooled,
+// and spooled logs stay on disk for the next start.
+func (s *SpoolProducer) Close() error {
+	nextErr := s.next.Close()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closed = true
+	return errors.Join(s.sealLocked(), nextErr)
+}
+
+func (s *SpoolProducer) Stats() SpoolStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return SpoolStats{Segments: len(s.segments), Entries: s.entries, Bytes: s.bytes}
+}
+
+// Run drains spooled logs to the wrapped producer until ctx is done, backing
+// off while sends keep failing. It also fsyncs under the interval policy.
+func (s *SpoolProducer) Run(ctx context.Context) {
+	syncInterval := s.cfg.FsyncInterval
+	if syncInterval <= 0 {
+		syncInterval = time.Second
+	}
+	ticker := time.NewTicker(syncInterval)
+	defer ticker.Stop()
+
+	failures := 0
+	for {
+		if err := s.drain(ctx); err != nil && ctx.Err() == nil {
+			failures++
+			delay := s.backoff.Delay(failures)
+			slog.Warn("Spool drain paused", "retry_in", delay, "error", err)
+			if resilience.Sleep(ctx, delay) != nil {
+				return
+			}
+			continue
+		}
+		failures = 0
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-s.wake:
+		case <-ticker.C:
+			if err := s.sync(); err != nil {
+				slog.Error("Spool fsync failed", "error", err)
+			}
+		}
+	}
+}
+
+func (s *SpoolProducer) append(entry *domain.LogEntry) error {
+	payload, err := s.encoder.Encode(entry, time.Now())
+	if err != nil {
+		return err
+	}
+	record := make([]byte, spoolRecordHead+len(payload))
+	binary.BigEndian.PutUint32(record[0:4], uint32(len(payload)))
+	binary.BigEndian.PutUint32(record[4:8], crc32.Checksum(payload, spoolCRC))
+	copy(record[spoolRecordHead:], payload)
+	size := int64(len(record))
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return errors.New("spool is closed")
+	}
+	if s.cfg.MaxBytes > 0 && s.bytes+size > s.cfg.MaxBytes {
+		return domain.ErrSpoolFull
+	}
+
+	if s.active == nil || (s.activeSize > 0 && s.activeSize+size > s.cfg.SegmentBytes) {
+		if err := s.rollLocked(); err != nil {
+			return err
+		}
+	}
+	if _, err := s.active.Write(record); err != nil {
+		return fmt.Errorf("write spool segment: %w", err)
+	}
+	if s.cfg.Fsync == SpoolFsyncAlways {
+		if err := s.active.Sync(); err != nil {
+			return fmt.Errorf("fsync spool segment: %w", err)
+		}
+	} else {
+		s.dirty = true
+	}
+
+	seg := s.segments[len(s.segments)-1]
+	seg.records++
+	seg.size += size
+	s.activeSize += size
+	s.entries++
+	s.bytes += size
+
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// rollLocked seals the active segment and starts a new one
+func (s *SpoolProducer) rollLocked() error {
+	if err := s.sealLocked(); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(s.segmentPath(s.nextID), os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o644)
+	if err != nil {
+		return fmt.Errorf("create spool segment: %w", err)
+	}
+	s.segments = append(s.segments, &spoolSegment{id: s.nextID})
+	s.active = f
+	s.activeSize = 0
+	s.nextID++
+	return nil
+}
+
+func (s *SpoolProducer) sealLocked() error {
+	if s.active == nil {
+		return nil
+	}
+	err := errors.Join(s.active.Sync(), s.active.Close())
+	s.active = nil
+	s.dirty = false
+	return err
+}
+
+func (s *SpoolProducer) sync() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.active == nil || !s.dirty || s.cfg.Fsync == SpoolFsyncNever {
+		return nil
+	}
+	s.dirty = false
+	return s.active.Sync()
+}
+
+// drain sends segments oldest first until the spool is empty or a send fails
+func (s *SpoolProducer) drain(ctx context.Context) error {
+	for ctx.Err() == nil {
+		s.mu.Lock()
+		if s.entries == 0 || len(s.segments) == 0 {
+			s.mu.Unlock()
+			return nil
+		}
+		seg := s.segments[0]
+		if len(s.segments) == 1 && s.active != nil {
+			// Draining the active segment: new writes go to a fresh one
+			if err := s.sealLocked(); err != nil {
+				s.mu.Unlock()
+				return err
+			}
+		}
+		s.mu.Unlock()
+
+		if err := s.drainSegment(ctx, seg); err != nil {
+			return err
+		}
+	}
+	return ctx.Err()
+}
+
+func (s *SpoolProducer) drainSegment(ctx context.Context, seg *spoolSegment) error {
+	f, err := os.Open(s.segmentPath(seg.id))
+	if err != nil {
+		return err
+	}
+	defer func() { _ = f.Close() }()
+
+	offset := s.readCursor(seg.id)
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		return err
+	}
+	r := bufio.NewReader(f)
+
+	sent := 0
+	for {
+		payload, err := readSpoolRecord(r)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			// Only reachable if the file was damaged after it was loaded
+			slog.Error("Spool segment damaged, dropping its remaining logs", "segment", seg.id, "offset", offset, "logs", seg.records, "error", err)
+			break
+		}
+
+		env, err := envelope.Decode(envelope.ContentTypeJSON, payload)
+		if err != nil {
+			slog.Error("Skipping undecodable spooled log", "segment", seg.id, "offset", offset, "error", err)
+		} else if err := s.next.SendLog(ctx, env.Entry); err != nil {
+			return errors.Join(err, s.writeCursor(seg.id, offset))
+		}
+
+		offset += int64(spoolRecordHead + len(payload))
+		s.mu.Lock()
+		seg.records--
+		s.entries--
+		s.mu.Unlock()
+
+		sent++
+		if sent%spoolCursorEvery == 0 {
+			if err := s.writeCursor(seg.id, offset); err != nil {
+				return err
+			}
+		}
+	}
+
+	// Segment done: drop it and its cursor
+	s.mu.Lock()
+	s.entries -= seg.records
+	s.bytes -= seg.size
+	s.segments = s.segments[1:]
+	s.mu.Unlock()
+	if err := os.Remove(s.segmentPath(seg.id)); err != nil {
+		return err
+	}
+	if err := os.Remove(filepath.Join(s.cfg.Dir, spoolCursorFile)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	slog.Info("Drained spool segment to Kafka", "segment", seg.id, "logs", sent)
+	return nil
+}
+
+// load picks up segments left by a previous run
+func (s *SpoolProducer) load() error {
+	files, err := filepath.Glob(filepath.Join(s.cfg.Dir, "*"+spoolSegmentExt))
+	if err != nil {
+		return err
+	}
+	var ids []uint64
+	for _, file := range files {
+		id, err := strconv.ParseUint(strings.TrimSuffix(filepath.Base(file), spoolSegmentExt), 10, 64)
+		if err != nil {
+			continue // Not ours
+		}
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+
+	for i, id := range ids {
+		cursor := int64(0)
+		if i == 0 {
+			cursor = s.readCursor(id)
+		}
+		seg, err := s.scanSegment(id, cursor)
+		if err != nil {
+			return err
+		}
+		s.nextID = id + 1
+		if seg.records == 0 {
+			// Drained before a crash but not removed yet
+			if err := os.Remove(s.segmentPath(id)); err != nil {
+				return err
+			}
+			continue
+		}
+		s.segments = append(s.segments, seg)
+		s.entries += seg.records
+		s.bytes += seg.size
+	}
+	return nil
+}
+
+// scanSegment counts the records at or after cursor and truncates a torn
+// tail left by a crash mid-write
+func (s *SpoolProducer) scanSegment(id uint64, cursor int64) (*spoolSegment, error) {
+	path := s.segmentPath(id)
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = f.Close() }()
+
+	seg := &spoolSegment{id: id}
+	r := bufio.NewReader(f)
+	for {
+		payload, err := readSpoolRecord(r)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			slog.Warn("Spool segment has a torn tail, truncating", "segment", id, "offset", seg.size, "error", err)
+			if err := os.Truncate(path, seg.size); err != nil {
+				return nil, err
+			}
+			break
+		}
+		if seg.size >= cursor {
+			seg.records++
+		}
+		seg.size += int64(spoolRecordHead + len(payload))
+	}
+	return seg, nil
+}
+
+func readSpoolRecord(r io.Reader) ([]byte, error) {
+	var head [spoolRecordHead]byte
+	if _, err := io.ReadFull(r, head[:]); err != nil {
+		if err == io.EOF {
+			return nil, io.EOF
+		}
+		return nil, errSpoolCorruption // Torn header
+	}
+	payload := make([]byte, binary.BigEndian.Uint32(head[0:4]))
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return nil, errSpoolCorruption
+	}
+	if crc32.Checksum(payload, spoolCRC) != binary.BigEndian.Uint32(head[4:8]) {
+		return nil, errSpoolCorruption
+	}
+	return payload, nil
+}
+
+// The cursor file holds "<segment id> <byte offset>" of the oldest segment
+func (s *SpoolProducer) readCursor(id uint64) int64 {
+	data, err := os.ReadFile(filepath.Join(s.cfg.Dir, spoolCursorFile))
+	if err != nil {
+		return 0
+	}
+	var cursorID uint64
+	var offset int64
+	if _, err := fmt.Sscanf(string(data), "%d %d", &cursorID, &offset); err != nil || cursorID != id {
+		return 0
+	}
+	return offset
+}
+
+func (s *SpoolProducer) writeCursor(id uint64, offset int64) error {
+	path := filepath.Join(s.cfg.Dir, spoolCursorFile)
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, []byte(fmt.Sprintf("%d %d\n", id, offset)), 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+func (s *SpoolProducer) segmentPath(id uint64) string {
+	return filepath.Join(s.cfg.Dir, fmt.Sprintf("%020d%s", id, spoolSegmentExt))
+}
@@ -0,0 +1,231 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Yupoer/logpulse/internal/config"
+	"github.com/Yupoer/logpulse/internal/domain"
+	"github.com/Yupoer/logpulse/internal/resilience"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// switchProducer fails every send while down, and records what it sent
+type switchProducer struct {
+	mu   sync.Mutex
+	down bool
+	sent []string
+}
+
+func (p *switchProducer) SendLog(ctx context.Context, entry *domain.LogEntry) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.down {
+		return errors.New("kafka unavailable")
+	}
+	p.sent = append(p.sent, entry.Message)
+	return nil
+}
+
+func (p *switchProducer) Close() error { return nil }
+
+func (p *switchProducer) setDown(down bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.down = down
+}
+
+func (p *switchProducer) messages() []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]string(nil), p.sent...)
+}
+
+func testSpoolConfig(t *testing.T) config.SpoolConfig {
+	return config.SpoolConfig{
+		Enabled:      true,
+		Dir:          t.TempDir(),
+		SegmentBytes: 1 << 20,
+		MaxBytes:     16 << 20,
+		Fsync:        SpoolFsyncAlways,
+	}
+}
+
+func sendAll(t *testing.T, p domain.LogProducer, messages ...string) {
+	for _, m := range messages {
+		require.NoError(t, p.SendLog(context.Background(), &domain.LogEntry{ServiceName: "payment-service", Message: m}))
+	}
+}
+
+func TestSpoolProducer_BuffersOutageAndDrainsInOrder(t *testing.T) {
+	kafka := &switchProducer{}
+	spool, err := NewSpoolProducer(kafka, testSpoolConfig(t), resilience.Backoff{Initial: time.Millisecond})
+	require.NoError(t, err)
+
+	sendAll(t, spool, "before")
+	kafka.setDown(true)
+	sendAll(t, spool, "during-1", "during-2")
+	assert.Equal(t, int64(2), spool.Stats().Entries)
+
+	// Kafka is back, but the backlog goes first
+	kafka.setDown(false)
+	sendAll(t, spool, "after")
+	assert.Equal(t, []string{"before"}, kafka.messages())
+	assert.Equal(t, int64(3), spool.Stats().Entries)
+
+	require.NoError(t, spool.drain(context.Background()))
+	assert.Equal(t, []string{"before", "during-1", "during-2", "after"}, kafka.messages())
+	assert.Equal(t, SpoolStats{}, spool.Stats())
+
+	// Drained segments are removed; with the spool empty, sends go straight through
+	files, _ := filepath.Glob(filepath.Join(spool.cfg.Dir, "*"+spoolSegmentExt))
+	assert.Empty(t, files)
+	sendAll(t, spool, "direct")
+	assert.Equal(t, int64(0), spool.Stats().Entries)
+	require.NoError(t, spool.Close())
+}
+
+func TestSpoolProducer_RollsSegmentsAndEnforcesCap(t *testing.T) {
+	kafka := &switchProducer{down: true}
+	cfg := testSpoolConfig(t)
+	cfg.SegmentBytes = 300
+	cfg.MaxBytes = 1000
+	spool, err := NewSpoolProducer(kafka, cfg, resilience.Backoff{})
+	require.NoError(t, err)
+	defer func() { _ = spool.Close() }()
+
+	var err2 error
+	sent := 0
+	for ; sent < 100; sent++ {
+		if err2 = spool.SendLog(context.Background(), &domain.LogEntry{Message: "filler"}); err2 != nil {
+			break
+		}
+	}
+	assert.ErrorIs(t, err2, domain.ErrSpoolFull)
+	stats := spool.Stats()
+	assert.Equal(t, int64(sent), stats.Entries)
+	assert.LessOrEqual(t, stats.Bytes, cfg.MaxBytes)
+	assert.Greater(t, stats.Segments, 1)
+}
+
+func TestSpoolProducer_ResumesAfterRestart(t *testing.T) {
+	kafka := &switchProducer{down: true}
+	cfg := testSpoolConfig(t)
+	spool, err := NewSpoolProducer(kafka, cfg, resilience.Backoff{})
+	require.NoError(t, err)
+	sendAll(t, spool, "one", "two", "three")
+
+	// Drain one log, then the process dies with the rest still spooled
+	kafka.setDown(false)
+	require.NoError(t, spool.drainSegmentPrefix(1))
+	require.NoError(t, spool.Close())
+
+	// A crash mid-append leaves a torn record at the tail
+	segment := spool.segmentPath(1)
+	f, err := os.OpenFile(segment, os.O_APPEND|os.O_WRONLY, 0)
+	require.NoError(t, err)
+	_, err = f.Write([]byte{0, 0, 1, 0, 42})
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+
+	restarted, err := NewSpoolProducer(kafka, cfg, resilience.Backoff{})
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), restarted.Stats().Entries)
+
+	require.NoError(t, restarted.drain(context.Background()))
+	assert.Equal(t, []string{"one", "two", "three"}, kafka.messages())
+	require.NoError(t, restarted.Close())
+}
+
+// flushingProducer reports a failed delivery from Close, like the async
+// producer flushing its buffer
+type flushingProducer struct {
+	switchProducer
+	onClose func()
+}
+
+func (p *flushingProducer) Close() error {
+	p.onClose()
+	return nil
+}
+
+func TestSpoolProducer_SpoolsFailuresReportedOnClose(t *testing.T) {
+	kafka := &flushingProducer{}
+	cfg := testSpoolConfig(t)
+	spool, err := NewSpoolProducer(kafka, cfg, resilience.Backoff{})
+	require.NoError(t, err)
+	kafka.onClose = func() {
+		assert.NoError(t, spool.Spool(&domain.LogEntry{Message: "flushed"}))
+	}
+	require.NoError(t, spool.Close())
+
+	restarted, err := NewSpoolProducer(&kafka.switchProducer, cfg, resilience.Backoff{})
+	require.NoError(t, err)
+	require.NoError(t, restarted.drain(context.Background()))
+	assert.Equal(t, []string{"flushed"}, kafka.messages())
+	require.NoError(t, restarted.Close())
+}
+
+func TestSpoolProducer_RunDrainsWhenKafkaRecovers(t *testing.T) {
+	kafka := &switchProducer{down: true}
+	spool, err := NewSpoolProducer(kafka, testSpoolConfig(t), resilience.Backoff{Initial: time.Millisecond, Max: 5 * time.Millisecond})
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		spool.Run(ctx)
+		close(done)
+	}()
+
+	sendAll(t, spool, "a", "b")
+	kafka.setDown(false)
+	require.Eventually(t, func() bool { return spool.Stats().Entries == 0 }, 2*time.Second, 5*time.Millisecond)
+	assert.Equal(t, []string{"a", "b"}, kafka.messages())
+
+	cancel()
+	<-done
+	require.NoError(t, spool.Close())
+}
+
+// drainSegmentPrefix sends the first n spooled logs and records the cursor,
+// as a drain interrupted by a crash would
+func (s *SpoolProducer) drainSegmentPrefix(n int) error {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	limited := &cancelAfter{LogProducer: s.next, n: n, cancel: cancel}
+	next := s.next
+	s.next = limited
+	defer func() { s.next = next }()
+
+	s.mu.Lock()
+	seg := s.segments[0]
+	_ = s.sealLocked()
+	s.mu.Unlock()
+	if err := s.drainSegment(ctx, seg); err != nil && !errors.Is(err, context.Canceled) {
+		return err
+	}
+	return nil
+}
+
+// cancelAfter lets n sends through, then cancels and fails
+type cancelAfter struct {
+	domain.LogProducer
+	n      int
+	cancel context.CancelFunc
+}
+
+func (c *cancelAfter) SendLog(ctx context.Context, entry *domain.LogEntry) error {
+	if c.n == 0 {
+		c.cancel()
+		return context.Canceled
+	}
+	c.n--
+	return c.LogProducer.SendLog(ctx, entry)
+}
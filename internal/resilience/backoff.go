@@ -0,0 +1,48 @@
+// Package resilience provides retry and failure isolation primitives shared
+// by the Kafka producer and consumer: exponential backoff with jitter, a
+// retry budget and per-dependency circuit breakers.
+package resilience
+
+import (
+	"context"
+	"math"
+	"math/rand/v2"
+	"time"
+)
+
+// Backoff computes exponentially growing delays with random jitter, so
+// replicas that failed together don't retry in lockstep.
+type Backoff struct {
+	Initial    time.Duration
+	Max        time.Duration
+	Multiplier float64 // Growth per attempt (default 2)
+	Jitter     float64 // Fraction of the delay randomized, 0..1 (0.5 = delay in [d/2, d])
+}
+
+// Delay returns the wait before retry number attempt (1 = first retry)
+func (b Backoff) Delay(attempt int) time.Duration {
+	multiplier := b.Multiplier
+	if multiplier <= 0 {
+		multiplier = 2
+	}
+	d := float64(b.Initial) * math.Pow(multiplier, float64(max(attempt-1, 0)))
+	if b.Max > 0 && d > float64(b.Max) {
+		d = float64(b.Max)
+	}
+	if jitter := min(max(b.Jitter, 0), 1); jitter > 0 {
+		d -= d * jitter * rand.Float64()
+	}
+	return time.Duration(d)
+}
+
+// Sleep waits for d, returning early with ctx.Err() when ctx is done
+func Sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
@@ -0,0 +1,196 @@
+package resilience
+
+import (
+	"errors"
+	"sort"
+	"sync"
+	"time"
+)
+
+// ErrCircuitOpen is returned without calling the dependency while its breaker is open
+var ErrCircuitOpen = errors.New("circuit breaker is open")
+
+type State int
+
+const (
+	StateClosed   State = iota // Calls flow normally
+	StateOpen                  // Calls fail fast until the open timeout passes
+	StateHalfOpen              // One probe call decides whether to close again
+)
+
+func (s State) String() string {
+	switch s {
+	case StateOpen:
+		return "open"
+	case StateHalfOpen:
+		return "half_open"
+	default:
+		return "closed"
+	}
+}
+
+// Breaker is a consecutive-failure circuit breaker for one dependency.
+// A nil *Breaker lets every call through.
+type Breaker struct {
+	name             string
+	failureThreshold int
+	openTimeout      time.Duration
+
+	mu       sync.Mutex
+	state    State
+	failures int
+	openedAt time.Time
+	probing  bool
+	now      func() time.Time
+}
+
+// NewBreaker opens after failureThreshold consecutive failures and lets a
+// probe through once openTimeout has passed
+func NewBreaker(name string, failureThreshold int, openTimeout time.Duration) *Breaker {
+	return &Breaker{
+		name:             name,
+		failureThreshold: max(failureThreshold, 1),
+		openTimeout:      openTimeout,
+		now:              time.Now,
+	}
+}
+
+func (b *Breaker) Name() string { return b.name }
+
+func (b *Breaker) State() State {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.currentState()
+}
+
+// Do runs fn unless the breaker is open. Any error from fn counts as a
+// failure; callers wrap fn to hide errors that say nothing about the
+// dependency's health (e.g. rejected input).
+func (b *Breaker) Do(fn func() error) error {
+	if b == nil {
+		return fn()
+	}
+	if err := b.allow(); err != nil {
+		return err
+	}
+	err := fn()
+	b.record(err == nil)
+	return err
+}
+
+// Allow reports whether a call may start, for callers that learn its
+// outcome later (e.g. async Kafka deliveries). Every allowed call must be
+// followed by exactly one Record.
+func (b *Breaker) Allow() error {
+	if b == nil {
+		return nil
+	}
+	return b.allow()
+}
+
+// Record reports the outcome of a call started with Allow
+func (b *Breaker) Record(success bool) {
+	if b == nil {
+		return
+	}
+	b.record(success)
+}
+
+// RetryAfter is how long until an open breaker lets a probe through; 0
+// unless it is open
+func (b *Breaker) RetryAfter() time.Duration {
+	if b == nil {
+		return 0
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.currentState() != StateOpen {
+		return 0
+	}
+	return b.openTimeout - b.now().Sub(b.openedAt)
+}
+
+func (b *Breaker) allow() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.currentState() {
+	case StateOpen:
+		return ErrCircuitOpen
+	case StateHalfOpen:
+		if b.probing {
+			return ErrCircuitOpen // Only one probe at a time
+		}
+		b.state = StateHalfOpen
+		b.probing = true
+	}
+	return nil
+}
+
+func (b *Breaker) record(success bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.probing = false
+	if success {
+		b.state = StateClosed
+		b.failures = 0
+		return
+	}
+
+	b.failures++
+	if b.state == StateHalfOpen || b.failures >= b.failureThreshold {
+		b.state = StateOpen
+		b.openedAt = b.now()
+	}
+}
+
+// currentState turns Open into HalfOpen once the timeout has passed
+func (b *Breaker) currentState() State {
+	if b.state == StateOpen && b.now().Sub(b.openedAt) >= b.openTimeout {
+		return StateHalfOpen
+	}
+	return b.state
+}
+
+// Registry keeps the breakers of a process for health reporting
+type Registry struct {
+	mu       sync.Mutex
+	breakers map[string]*Breaker
+}
+
+func NewRegistry() *Registry {
+	return &Registry{breakers: map[string]*Breaker{}}
+}
+
+// NewBreaker creates a breaker and registers it under name
+func (r *Registry) NewBreaker(name string, failureThreshold int, openTimeout time.Duration) *Breaker {
+	b := NewBreaker(name, failureThreshold, openTimeout)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.breakers[name] = b
+	return b
+}
+
+// States maps breaker names to their current state
+func (r *Registry) States() map[string]string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	states := make(map[string]string, len(r.breakers))
+	for name, b := range r.breakers {
+		states[name] = b.State().String()
+	}
+	return states
+}
+
+// Open lists the breakers currently rejecting calls, sorted by name
+func (r *Registry) Open() []string {
+	open := []string{}
+	for name, state := range r.States() {
+		if state == StateOpen.String() {
+			open = append(open, name)
+		}
+	}
+	sort.Strings(open)
+	return open
+}
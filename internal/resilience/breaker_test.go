@@ -0,0 +1,93 @@
+package resilience
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var errBoom = errors.New("boom")
+
+func TestBreakerOpensAfterConsecutiveFailures(t *testing.T) {
+	clock := time.Now()
+	b := NewBreaker("elasticsearch", 3, 10*time.Second)
+	b.now = func() time.Time { return clock }
+
+	fail := func() error { return errBoom }
+	ok := func() error { return nil }
+
+	assert.ErrorIs(t, b.Do(fail), errBoom)
+	assert.ErrorIs(t, b.Do(fail), errBoom)
+	// A success resets the count
+	assert.NoError(t, b.Do(ok))
+	for i := 0; i < 3; i++ {
+		assert.ErrorIs(t, b.Do(fail), errBoom)
+	}
+	assert.Equal(t, StateOpen, b.State())
+
+	// Open: fn is not called
+	called := false
+	err := b.Do(func() error { called = true; return nil })
+	assert.ErrorIs(t, err, ErrCircuitOpen)
+	assert.False(t, called)
+
+	// After the timeout a failed probe re-opens it
+	clock = clock.Add(10 * time.Second)
+	assert.Equal(t, StateHalfOpen, b.State())
+	assert.ErrorIs(t, b.Do(fail), errBoom)
+	assert.Equal(t, StateOpen, b.State())
+
+	// A successful probe closes it
+	clock = clock.Add(10 * time.Second)
+	assert.NoError(t, b.Do(ok))
+	assert.Equal(t, StateClosed, b.State())
+}
+
+func TestBreakerAllowsOneProbe(t *testing.T) {
+	clock := time.Now()
+	b := NewBreaker("mysql", 1, time.Second)
+	b.now = func() time.Time { return clock }
+
+	assert.ErrorIs(t, b.Do(func() error { return errBoom }), errBoom)
+	clock = clock.Add(time.Second)
+
+	err := b.Do(func() error {
+		// A concurrent call while the probe is in flight fails fast
+		assert.ErrorIs(t, b.Do(func() error { return nil }), ErrCircuitOpen)
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, StateClosed, b.State())
+}
+
+func TestBreakerRetryAfter(t *testing.T) {
+	clock := time.Now()
+	b := NewBreaker("redis", 1, 10*time.Second)
+	b.now = func() time.Time { return clock }
+	assert.Zero(t, b.RetryAfter())
+
+	_ = b.Do(func() error { return errBoom })
+	clock = clock.Add(4 * time.Second)
+	assert.Equal(t, 6*time.Second, b.RetryAfter())
+
+	clock = clock.Add(6 * time.Second) // Half-open: a probe may go now
+	assert.Zero(t, b.RetryAfter())
+}
+
+func TestNilBreakerPassesThrough(t *testing.T) {
+	var b *Breaker
+	assert.ErrorIs(t, b.Do(func() error { return errBoom }), errBoom)
+	assert.Zero(t, b.RetryAfter())
+}
+
+func TestRegistryStates(t *testing.T) {
+	r := NewRegistry()
+	r.NewBreaker("mysql", 1, time.Minute)
+	es := r.NewBreaker("elasticsearch", 1, time.Minute)
+	_ = es.Do(func() error { return errBoom })
+
+	assert.Equal(t, map[string]string{"mysql": "closed", "elasticsearch": "open"}, r.States())
+	assert.Equal(t, []string{"elasticsearch"}, r.Open())
+}
@@ -0,0 +1,67 @@
+package resilience
+
+import (
+	"sync"
+	"time"
+)
+
+// RetryBudget caps retries to a fraction of regular traffic, so a failing
+// dependency sees at most (1 + ratio) times the normal load instead of
+// MaxAttempts times. A small per-second allowance keeps retries possible
+// at low traffic.
+type RetryBudget struct {
+	ratio        float64
+	minPerSecond float64
+	maxTokens    float64
+
+	mu       sync.Mutex
+	tokens   float64
+	lastFill time.Time
+	now      func() time.Time
+}
+
+// NewRetryBudget allows ratio retries per first attempt plus minPerSecond
+// retries per second. Unused budget accumulates up to ten seconds' worth.
+func NewRetryBudget(ratio, minPerSecond float64) *RetryBudget {
+	b := &RetryBudget{
+		ratio:        ratio,
+		minPerSecond: minPerSecond,
+		maxTokens:    max(10*minPerSecond, 1),
+		now:          time.Now,
+	}
+	b.tokens = b.maxTokens
+	b.lastFill = b.now()
+	return b
+}
+
+// Record adds the budget earned by one first attempt
+func (b *RetryBudget) Record() {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.refill()
+	b.tokens = min(b.tokens+b.ratio, b.maxTokens)
+}
+
+// Withdraw spends budget for one retry, reporting whether it may proceed
+func (b *RetryBudget) Withdraw() bool {
+	if b == nil {
+		return true
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.refill()
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+func (b *RetryBudget) refill() {
+	now := b.now()
+	b.tokens = min(b.tokens+now.Sub(b.lastFill).Seconds()*b.minPerSecond, b.maxTokens)
+	b.lastFill = now
+}
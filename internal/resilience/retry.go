@@ -0,0 +1,52 @@
+package resilience
+
+import (
+	"context"
+	"errors"
+)
+
+// RetryPolicy bounds how an operation is retried
+type RetryPolicy struct {
+	MaxAttempts int // Including the first attempt
+	Backoff     Backoff
+	Budget      *RetryBudget // Optional, shared across callers
+}
+
+type permanentError struct{ err error }
+
+func (e *permanentError) Error() string { return e.err.Error() }
+func (e *permanentError) Unwrap() error { return e.err }
+
+// Permanent marks err as not worth retrying
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &permanentError{err: err}
+}
+
+// Retry calls fn until it succeeds, MaxAttempts is reached, the budget runs
+// out, ctx is done, or fn returns a Permanent or ErrCircuitOpen error. The
+// last error from fn is returned.
+func Retry(ctx context.Context, policy RetryPolicy, fn func(ctx context.Context) error) error {
+	policy.Budget.Record()
+
+	var err error
+	for attempt := 1; ; attempt++ {
+		err = fn(ctx)
+		if err == nil {
+			return nil
+		}
+
+		var permanent *permanentError
+		if errors.As(err, &permanent) {
+			return permanent.err
+		}
+		if errors.Is(err, ErrCircuitOpen) || attempt >= policy.MaxAttempts || !policy.Budget.Withdraw() {
+			return err
+		}
+		if sleepErr := Sleep(ctx, policy.Backoff.Delay(attempt)); sleepErr != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,86 @@
+package resilience
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBackoffDelay(t *testing.T) {
+	b := Backoff{Initial: 100 * time.Millisecond, Max: time.Second}
+	assert.Equal(t, 100*time.Millisecond, b.Delay(1))
+	assert.Equal(t, 200*time.Millisecond, b.Delay(2))
+	assert.Equal(t, 800*time.Millisecond, b.Delay(4))
+	assert.Equal(t, time.Second, b.Delay(10))
+
+	b.Jitter = 0.5
+	for i := 0; i < 100; i++ {
+		d := b.Delay(2)
+		assert.GreaterOrEqual(t, d, 100*time.Millisecond)
+		assert.LessOrEqual(t, d, 200*time.Millisecond)
+	}
+}
+
+func TestRetryBudget(t *testing.T) {
+	clock := time.Now()
+	budget := NewRetryBudget(0.5, 1)
+	budget.now = func() time.Time { return clock }
+	budget.lastFill = clock
+	budget.tokens = 0
+
+	assert.False(t, budget.Withdraw())
+	budget.Record()
+	budget.Record()
+	assert.True(t, budget.Withdraw()) // Two first attempts earn one retry
+	assert.False(t, budget.Withdraw())
+
+	clock = clock.Add(2 * time.Second) // minPerSecond refill
+	assert.True(t, budget.Withdraw())
+	assert.True(t, budget.Withdraw())
+	assert.False(t, budget.Withdraw())
+}
+
+func TestRetry(t *testing.T) {
+	policy := RetryPolicy{MaxAttempts: 3, Backoff: Backoff{Initial: time.Millisecond}}
+	ctx := context.Background()
+
+	t.Run("SucceedsAfterFailures", func(t *testing.T) {
+		calls := 0
+		err := Retry(ctx, policy, func(ctx context.Context) error {
+			calls++
+			if calls < 3 {
+				return errBoom
+			}
+			return nil
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, 3, calls)
+	})
+
+	t.Run("StopsAtMaxAttempts", func(t *testing.T) {
+		calls := 0
+		err := Retry(ctx, policy, func(ctx context.Context) error { calls++; return errBoom })
+		assert.ErrorIs(t, err, errBoom)
+		assert.Equal(t, 3, calls)
+	})
+
+	t.Run("PermanentAndOpenCircuitAreNotRetried", func(t *testing.T) {
+		calls := 0
+		err := Retry(ctx, policy, func(ctx context.Context) error { calls++; return Permanent(errBoom) })
+		assert.ErrorIs(t, err, errBoom)
+		err = Retry(ctx, policy, func(ctx context.Context) error { calls++; return ErrCircuitOpen })
+		assert.ErrorIs(t, err, ErrCircuitOpen)
+		assert.Equal(t, 2, calls)
+	})
+
+	t.Run("StopsWhenBudgetIsSpent", func(t *testing.T) {
+		budget := NewRetryBudget(0, 0)
+		budget.tokens = 1
+		calls := 0
+		err := Retry(ctx, RetryPolicy{MaxAttempts: 5, Budget: budget}, func(ctx context.Context) error { calls++; return errBoom })
+		assert.ErrorIs(t, err, errBoom)
+		assert.Equal(t, 2, calls)
+	})
+}
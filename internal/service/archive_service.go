@@ -0,0 +1,430 @@
+package service
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Yupoer/logpulse/internal/config"
+	"github.com/Yupoer/logpulse/internal/domain"
+)
+
+const (
+	// RehydratedIndexPrefix marks temporary indices created by Rehydrate
+	RehydratedIndexPrefix = "logs-rehydrated-"
+
+	archiveDayLayout   = "2006-01-02"
+	archiveLockKey     = "archive"
+	archiveLockTTL     = time.Minute // Refreshed while held; only bounds a crashed holder
+	archivePageSize    = 1000
+	rehydrateBatchSize = 1000
+	maxRehydrateRange  = 31 * 24 * time.Hour
+)
+
+var (
+	ErrInvalidRehydrateRange = errors.New("invalid rehydrate range")
+	ErrNotRehydratedIndex    = errors.New("not a rehydrated index")
+	ErrSegmentChecksum       = errors.New("archive segment checksum mismatch")
+	ErrArchiveBusy           = errors.New("another archive run is in progress")
+)
+
+// ArchiveService moves aged-out logs from the relational DB into immutable,
+// day-partitioned, gzip-compressed NDJSON segments, and loads them back into
+// a temporary Elasticsearch index on demand.
+//
+// Object layout:
+//
+//	logs/2024/03/01/segment-00001.ndjson.gz
+//	logs/2024/03/01/manifest.json
+type ArchiveService struct {
+	logRepo    domain.LogRepository
+	store      domain.ArchiveStore
+	indexAdmin domain.LogIndexAdmin
+	locker     domain.Locker
+	cfg        config.ArchiveConfig
+}
+
+func NewArchiveService(logRepo domain.LogRepository, store domain.ArchiveStore, indexAdmin domain.LogIndexAdmin, locker domain.Locker, cfg config.ArchiveConfig) *ArchiveService {
+	return &ArchiveService{
+		logRepo:    logRepo,
+		store:      store,
+		indexAdmin: indexAdmin,
+		locker:     locker,
+		cfg:        cfg,
+	}
+}
+
+// Run archives aged days and expires old rehydrated indices every interval.
+// A cluster-wide lock keeps replicas from archiving the same day twice; it
+// is held for the whole run, however long that takes.
+func (s *ArchiveService) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		release, ok, err := s.locker.TryLock(ctx, archiveLockKey, interval)
+		if err != nil {
+			slog.Error("Failed to acquire archive lock", "error", err)
+		} else if ok {
+			if err := s.ArchiveAged(ctx, time.Now()); err != nil {
+				slog.Error("Archiving failed", "error", err)
+			}
+			if err := s.expireRehydrated(ctx, time.Now()); err != nil {
+				slog.Error("Failed to expire rehydrated indices", "error", err)
+			}
+			release()
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// ArchiveAged archives every day between LookbackDays and AfterDays ago
+// that has no manifest yet, oldest first.
+func (s *ArchiveService) ArchiveAged(ctx context.Context, now time.Time) error {
+	today := startOfDay(now)
+	for i := s.cfg.LookbackDays; i >= s.cfg.AfterDays; i-- {
+		if _, err := s.ArchiveDay(ctx, today.AddDate(0, 0, -i)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ArchiveDayExclusive is ArchiveDay under the lock Run holds, so a manual
+// run never races the scheduled one. It returns ErrArchiveBusy while
+// another run holds the lock.
+func (s *ArchiveService) ArchiveDayExclusive(ctx context.Context, day time.Time) (*domain.ArchiveManifest, error) {
+	release, ok, err := s.locker.TryLock(ctx, archiveLockKey, archiveLockTTL)
+	if err != nil {
+		return nil, fmt.Errorf("acquire archive lock: %w", err)
+	}
+	if !ok {
+		return nil, ErrArchiveBusy
+	}
+	defer release()
+	return s.ArchiveDay(ctx, day)
+}
+
+// ArchiveDay writes all logs of the given day to segments followed by the
+// day's manifest. Days that already have a manifest are returned as is;
+// days without logs are not written at all.
+func (s *ArchiveService) ArchiveDay(ctx context.Context, day time.Time) (*domain.ArchiveManifest, error) {
+	from := startOfDay(day)
+	to := from.AddDate(0, 0, 1)
+
+	existing, err := s.GetManifest(ctx, from)
+	if err == nil {
+		return existing, nil
+	}
+	if !errors.Is(err, domain.ErrArchiveObjectNotFound) {
+		return nil, err
+	}
+
+	manifest := &domain.ArchiveManifest{Day: from.Format(archiveDayLayout)}
+	segment := newSegmentWriter()
+
+	flush := func() error {
+		if segment.count == 0 {
+			return nil
+		}
+		key := fmt.Sprintf("%s/segment-%05d.ndjson.gz", dayPrefix(from), len(manifest.Segments)+1)
+		meta, err := segment.finish(ctx, s.store, key)
+		if err != nil {
+			return fmt.Errorf("write segment %s: %w", key, err)
+		}
+		manifest.Segments = append(manifest.Segments, meta)
+		manifest.Count += meta.Count
+		segment = newSegmentWriter()
+		return nil
+	}
+
+	var afterID uint
+	for {
+		entries, err := s.logRepo.FindByTimeRange(ctx, from, to, afterID, archivePageSize)
+		if err != nil {
+			return nil, err
+		}
+		for _, entry := range entries {
+			if err := segment.add(entry); err != nil {
+				return nil, err
+			}
+			if segment.count >= s.cfg.SegmentSize {
+				if err := flush(); err != nil {
+					return nil, err
+				}
+			}
+		}
+		if len(entries) < archivePageSize {
+			break
+		}
+		afterID = entries[len(entries)-1].ID
+	}
+	if err := flush(); err != nil {
+		return nil, err
+	}
+
+	if manifest.Count == 0 {
+		return manifest, nil
+	}
+
+	// The manifest goes last: its presence marks the day as complete
+	manifest.ArchivedAt = time.Now()
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	if err := s.store.Put(ctx, manifestKey(from), bytes.NewReader(data), int64(len(data))); err != nil {
+		return nil, fmt.Errorf("write manifest: %w", err)
+	}
+
+	slog.InfoContext(ctx, "Archived logs", "day", manifest.Day, "logs", manifest.Count, "segments", len(manifest.Segments))
+	return manifest, nil
+}
+
+// GetManifest returns the manifest of an archived day,
+// or domain.ErrArchiveObjectNotFound if the day is not archived.
+func (s *ArchiveService) GetManifest(ctx context.Context, day time.Time) (*domain.ArchiveManifest, error) {
+	rc, err := s.store.Get(ctx, manifestKey(startOfDay(day)))
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rc.Close() }()
+
+	var manifest domain.ArchiveManifest
+	if err := json.NewDecoder(rc).Decode(&manifest); err != nil {
+		return nil, err
+	}
+	return &manifest, nil
+}
+
+// Rehydrate loads archived logs with from <= timestamp < to into a new
+// temporary index, which is deleted automatically after RehydrateTTL.
+func (s *ArchiveService) Rehydrate(ctx context.Context, from, to time.Time) (*domain.RehydrateResult, error) {
+	if !from.Before(to) || to.Sub(from) > maxRehydrateRange {
+		return nil, ErrInvalidRehydrateRange
+	}
+
+	index := fmt.Sprintf("%s%s-%s-%d", RehydratedIndexPrefix,
+		from.Format("20060102"), to.Format("20060102"), time.Now().Unix())
+	if err := s.indexAdmin.CreateIndex(ctx, index, nil); err != nil {
+		return nil, err
+	}
+
+	count, err := s.loadRange(ctx, index, from, to)
+	if err != nil {
+		// Don't leave a half-loaded index behind
+		_ = s.indexAdmin.DeleteIndex(context.Background(), index)
+		return nil, err
+	}
+
+	slog.InfoContext(ctx, "Rehydrated logs", "index", index, "logs", count)
+	return &domain.RehydrateResult{Index: index, From: from, To: to, Count: count}, nil
+}
+
+// SearchRehydrated runs a keyword search against a rehydrated index
+func (s *ArchiveService) SearchRehydrated(ctx context.Context, index string, query domain.LogSearchQuery) ([]*domain.LogEntry, error) {
+	if !strings.HasPrefix(index, RehydratedIndexPrefix) {
+		return nil, ErrNotRehydratedIndex
+	}
+	return s.indexAdmin.SearchIndex(ctx, index, query)
+}
+
+// DropRehydrated deletes a rehydrated index before its TTL expires
+func (s *ArchiveService) DropRehydrated(ctx context.Context, index string) error {
+	if !strings.HasPrefix(index, RehydratedIndexPrefix) {
+		return ErrNotRehydratedIndex
+	}
+	return s.indexAdmin.DeleteIndex(ctx, index)
+}
+
+func (s *ArchiveService) loadRange(ctx context.Context, index string, from, to time.Time) (int, error) {
+	count := 0
+	batch := make([]*domain.LogEntry, 0, rehydrateBatchSize)
+
+	for day := startOfDay(from); day.Before(to); day = day.AddDate(0, 0, 1) {
+		manifest, err := s.GetManifest(ctx, day)
+		if errors.Is(err, domain.ErrArchiveObjectNotFound) {
+			continue // Nothing archived for this day
+		}
+		if err != nil {
+			return count, err
+		}
+
+		for _, seg := range manifest.Segments {
+			// Skip segments entirely outside the requested range
+			if !seg.MinTime.Before(to) || seg.MaxTime.Before(from) {
+				continue
+			}
+			err := s.readSegment(ctx, seg, func(entry *domain.LogEntry) error {
+				if entry.Timestamp.Before(from) || !entry.Timestamp.Before(to) {
+					return nil
+				}
+				batch = append(batch, entry)
+				if len(batch) < rehydrateBatchSize {
+					return nil
+				}
+				if err := s.indexAdmin.BulkIndexInto(ctx, index, batch); err != nil {
+					return err
+				}
+				count += len(batch)
+				batch = batch[:0]
+				return nil
+			})
+			if err != nil {
+				return count, fmt.Errorf("read segment %s: %w", seg.Key, err)
+			}
+		}
+	}
+
+	if len(batch) > 0 {
+		if err := s.indexAdmin.BulkIndexInto(ctx, index, batch); err != nil {
+			return count, err
+		}
+		count += len(batch)
+	}
+	return count, nil
+}
+
+// readSegment calls fn for every entry of seg. The whole segment is read
+// and checked against the manifest's SHA-256 first, so a corrupt or
+// tampered segment indexes nothing.
+func (s *ArchiveService) readSegment(ctx context.Context, seg domain.ArchiveSegment, fn func(*domain.LogEntry) error) error {
+	rc, err := s.store.Get(ctx, seg.Key)
+	if err != nil {
+		return err
+	}
+	data, err := io.ReadAll(rc)
+	_ = rc.Close()
+	if err != nil {
+		return err
+	}
+	if sum := sha256.Sum256(data); hex.EncodeToString(sum[:]) != seg.SHA256 {
+		return ErrSegmentChecksum
+	}
+
+	gz, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	defer func() { _ = gz.Close() }()
+
+	scanner := bufio.NewScanner(gz)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024) // Allow large messages
+	for scanner.Scan() {
+		var entry domain.LogEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			return err
+		}
+		if err := fn(&entry); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
+
+// expireRehydrated deletes rehydrated indices older than RehydrateTTL.
+// The creation time is the unix timestamp suffix of the index name.
+func (s *ArchiveService) expireRehydrated(ctx context.Context, now time.Time) error {
+	indices, err := s.indexAdmin.ListIndices(ctx, RehydratedIndexPrefix+"*")
+	if err != nil {
+		return err
+	}
+	for _, index := range indices {
+		created, err := strconv.ParseInt(index[strings.LastIndex(index, "-")+1:], 10, 64)
+		if err != nil {
+			continue
+		}
+		if now.Sub(time.Unix(created, 0)) < s.cfg.RehydrateTTL {
+			continue
+		}
+		if err := s.indexAdmin.DeleteIndex(ctx, index); err != nil {
+			return err
+		}
+		slog.Info("Deleted expired rehydrated index", "index", index)
+	}
+	return nil
+}
+
+// segmentWriter buffers one gzip-compressed NDJSON segment in memory
+type segmentWriter struct {
+	buf   bytes.Buffer
+	gz    *gzip.Writer
+	enc   *json.Encoder
+	count int
+	meta  domain.ArchiveSegment
+}
+
+func newSegmentWriter() *segmentWriter {
+	w := &segmentWriter{}
+	w.gz = gzip.NewWriter(&w.buf)
+	w.enc = json.NewEncoder(w.gz) // Encode appends '\n' after every entry
+	return w
+}
+
+func (w *segmentWriter) add(entry *domain.LogEntry) error {
+	if err := w.enc.Encode(entry); err != nil {
+		return err
+	}
+	if w.count == 0 {
+		w.meta.FirstID = entry.ID
+		w.meta.MinTime = entry.Timestamp
+		w.meta.MaxTime = entry.Timestamp
+	}
+	w.meta.LastID = entry.ID
+	if entry.Timestamp.Before(w.meta.MinTime) {
+		w.meta.MinTime = entry.Timestamp
+	}
+	if entry.Timestamp.After(w.meta.MaxTime) {
+		w.meta.MaxTime = entry.Timestamp
+	}
+	w.count++
+	return nil
+}
+
+func (w *segmentWriter) finish(ctx context.Context, store domain.ArchiveStore, key string) (domain.ArchiveSegment, error) {
+	if err := w.gz.Close(); err != nil {
+		return domain.ArchiveSegment{}, err
+	}
+	sum := sha256.Sum256(w.buf.Bytes())
+
+	meta := w.meta
+	meta.Key = key
+	meta.Count = w.count
+	meta.Bytes = int64(w.buf.Len())
+	meta.SHA256 = hex.EncodeToString(sum[:])
+
+	if err := store.Put(ctx, key, bytes.NewReader(w.buf.Bytes()), meta.Bytes); err != nil {
+		return domain.ArchiveSegment{}, err
+	}
+	return meta, nil
+}
+
+// startOfDay returns local midnight, matching the DB's daily partitions
+func startOfDay(t time.Time) time.Time {
+	y, m, d := t.In(time.Local).Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, time.Local)
+}
+
+func dayPrefix(day time.Time) string {
+	return "logs/" + day.Format("2006/01/02")
+}
+
+func manifestKey(day time.Time) string {
+	return dayPrefix(day) + "/manifest.json"
+}
@@ -0,0 +1,251 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Yupoer/logpulse/internal/config"
+	"github.com/Yupoer/logpulse/internal/domain"
+	"github.com/Yupoer/logpulse/internal/repository"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// --- Fakes ---
+
+// memLogRepo serves FindByTimeRange from a slice, like the SQL repositories do
+type memLogRepo struct {
+	MockLogRepo
+	entries []*domain.LogEntry
+}
+
+func (m *memLogRepo) FindByTimeRange(ctx context.Context, from, to time.Time, afterID uint, limit int) ([]*domain.LogEntry, error) {
+	out := make([]*domain.LogEntry, 0)
+	for _, e := range m.entries {
+		if e.ID > afterID && !e.Timestamp.Before(from) && e.Timestamp.Before(to) {
+			out = append(out, e)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].ID < out[j].ID })
+	if len(out) > limit {
+		out = out[:limit]
+	}
+	return out, nil
+}
+
+func (m *memLogRepo) FindByIDRange(ctx context.Context, afterID, untilID uint, limit int) ([]*domain.LogEntry, error) {
+	out := make([]*domain.LogEntry, 0)
+	for _, e := range m.entries {
+		if e.ID > afterID && e.ID <= untilID && len(out) < limit {
+			out = append(out, e)
+		}
+	}
+	return out, nil
+}
+
+func (m *memLogRepo) MaxID(ctx context.Context) (uint, error) {
+	var maxID uint
+	for _, e := range m.entries {
+		if e.ID > maxID {
+			maxID = e.ID
+		}
+	}
+	return maxID, nil
+}
+
+type fakeIndexAdmin struct {
+	indices map[string][]*domain.LogEntry
+	aliases map[string]string
+}
+
+func (f *fakeIndexAdmin) CreateIndex(ctx context.Context, index string, body []byte) error {
+	f.indices[index] = []*domain.LogEntry{}
+	return nil
+}
+func (f *fakeIndexAdmin) DeleteIndex(ctx context.Context, index string) error {
+	delete(f.indices, index)
+	return nil
+}
+func (f *fakeIndexAdmin) ListIndices(ctx context.Context, pattern string) ([]string, error) {
+	names := make([]string, 0, len(f.indices))
+	for name := range f.indices {
+		if strings.HasPrefix(name, strings.TrimSuffix(pattern, "*")) {
+			names = append(names, name)
+		}
+	}
+	return names, nil
+}
+func (f *fakeIndexAdmin) BulkIndexInto(ctx context.Context, index string, entries []*domain.LogEntry) error {
+	f.indices[index] = append(f.indices[index], entries...)
+	return nil
+}
+func (f *fakeIndexAdmin) SearchIndex(ctx context.Context, index string, query domain.LogSearchQuery) ([]*domain.LogEntry, error) {
+	return f.indices[index], nil
+}
+func (f *fakeIndexAdmin) SwitchAlias(ctx context.Context, alias, index string, replaceIndex bool) error {
+	f.aliases[alias] = index
+	return nil
+}
+
+type noopLocker struct{}
+
+func (noopLocker) TryLock(ctx context.Context, key string, ttl time.Duration) (func(), bool, error) {
+	return func() {}, true, nil
+}
+
+// heldLocker has every lock held by someone else
+type heldLocker struct{}
+
+func (heldLocker) TryLock(ctx context.Context, key string, ttl time.Duration) (func(), bool, error) {
+	return nil, false, nil
+}
+
+func newTestArchiveService(t *testing.T, entries []*domain.LogEntry) (*ArchiveService, *fakeIndexAdmin) {
+	store, err := repository.NewFSArchiveStore(t.TempDir())
+	require.NoError(t, err)
+
+	indexAdmin := &fakeIndexAdmin{indices: map[string][]*domain.LogEntry{}, aliases: map[string]string{}}
+	cfg := config.ArchiveConfig{AfterDays: 1, LookbackDays: 3, SegmentSize: 2, RehydrateTTL: time.Hour}
+	return NewArchiveService(&memLogRepo{entries: entries}, store, indexAdmin, noopLocker{}, cfg), indexAdmin
+}
+
+func testEntries(day time.Time) []*domain.LogEntry {
+	entries := make([]*domain.LogEntry, 0)
+	for i := 1; i <= 5; i++ {
+		e := &domain.LogEntry{ServiceName: "order-service", Level: "INFO", Message: "archived", Timestamp: day.Add(time.Duration(i) * time.Hour)}
+		e.ID = uint(i)
+		entries = append(entries, e)
+	}
+	// Next day, must not end up in the first day's segments
+	next := &domain.LogEntry{ServiceName: "order-service", Level: "INFO", Message: "next day", Timestamp: day.AddDate(0, 0, 1).Add(time.Hour)}
+	next.ID = 6
+	return append(entries, next)
+}
+
+// --- Tests ---
+
+func TestArchiveDay(t *testing.T) {
+	day := time.Date(2024, 3, 1, 0, 0, 0, 0, time.Local)
+	svc, _ := newTestArchiveService(t, testEntries(day))
+	ctx := context.Background()
+
+	manifest, err := svc.ArchiveDay(ctx, day)
+	require.NoError(t, err)
+
+	assert.Equal(t, "2024-03-01", manifest.Day)
+	assert.Equal(t, 5, manifest.Count)
+	require.Len(t, manifest.Segments, 3) // SegmentSize = 2
+	assert.Equal(t, "logs/2024/03/01/segment-00001.ndjson.gz", manifest.Segments[0].Key)
+	assert.Equal(t, uint(1), manifest.Segments[0].FirstID)
+	assert.Equal(t, uint(5), manifest.Segments[2].LastID)
+	assert.NotEmpty(t, manifest.Segments[0].SHA256)
+
+	// Archived days are immutable: a second run returns the stored manifest
+	again, err := svc.ArchiveDay(ctx, day)
+	require.NoError(t, err)
+	assert.True(t, manifest.ArchivedAt.Equal(again.ArchivedAt))
+}
+
+func TestArchiveDay_Empty(t *testing.T) {
+	svc, _ := newTestArchiveService(t, nil)
+	day := time.Date(2024, 3, 1, 0, 0, 0, 0, time.Local)
+
+	manifest, err := svc.ArchiveDay(context.Background(), day)
+	require.NoError(t, err)
+	assert.Zero(t, manifest.Count)
+
+	// Nothing is written for empty days
+	_, err = svc.GetManifest(context.Background(), day)
+	assert.ErrorIs(t, err, domain.ErrArchiveObjectNotFound)
+}
+
+func TestArchiveDayExclusive_BusyWhileLocked(t *testing.T) {
+	store, err := repository.NewFSArchiveStore(t.TempDir())
+	require.NoError(t, err)
+	day := time.Date(2024, 3, 1, 0, 0, 0, 0, time.Local)
+	cfg := config.ArchiveConfig{AfterDays: 1, LookbackDays: 3, SegmentSize: 2}
+	svc := NewArchiveService(&memLogRepo{entries: testEntries(day)}, store, nil, heldLocker{}, cfg)
+
+	_, err = svc.ArchiveDayExclusive(context.Background(), day)
+	assert.ErrorIs(t, err, ErrArchiveBusy)
+
+	// Nothing is written while the scheduled run holds the lock
+	_, err = svc.GetManifest(context.Background(), day)
+	assert.ErrorIs(t, err, domain.ErrArchiveObjectNotFound)
+}
+
+func TestRehydrate(t *testing.T) {
+	day := time.Date(2024, 3, 1, 0, 0, 0, 0, time.Local)
+	svc, indexAdmin := newTestArchiveService(t, testEntries(day))
+	ctx := context.Background()
+
+	_, err := svc.ArchiveDay(ctx, day)
+	require.NoError(t, err)
+	_, err = svc.ArchiveDay(ctx, day.AddDate(0, 0, 1))
+	require.NoError(t, err)
+
+	// 02:00 <= ts < 04:00 on day 1 matches entries 2 and 3
+	result, err := svc.Rehydrate(ctx, day.Add(2*time.Hour), day.Add(4*time.Hour))
+	require.NoError(t, err)
+	assert.Equal(t, 2, result.Count)
+	assert.True(t, strings.HasPrefix(result.Index, RehydratedIndexPrefix))
+	require.Len(t, indexAdmin.indices[result.Index], 2)
+	assert.Equal(t, uint(2), indexAdmin.indices[result.Index][0].ID)
+
+	// Spanning both days picks up the next day's manifest as well
+	result, err = svc.Rehydrate(ctx, day, day.AddDate(0, 0, 2))
+	require.NoError(t, err)
+	assert.Equal(t, 6, result.Count)
+}
+
+// corruptingStore flips a byte of every segment it returns
+type corruptingStore struct {
+	domain.ArchiveStore
+}
+
+func (s corruptingStore) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	rc, err := s.ArchiveStore.Get(ctx, key)
+	if err != nil || strings.HasSuffix(key, "manifest.json") {
+		return rc, err
+	}
+	defer func() { _ = rc.Close() }()
+	data, err := io.ReadAll(rc)
+	if err != nil {
+		return nil, err
+	}
+	data[len(data)-1] ^= 0xff
+	return io.NopCloser(bytes.NewReader(data)), nil
+}
+
+func TestRehydrate_ChecksumMismatch(t *testing.T) {
+	day := time.Date(2024, 3, 1, 0, 0, 0, 0, time.Local)
+	store, err := repository.NewFSArchiveStore(t.TempDir())
+	require.NoError(t, err)
+	indexAdmin := &fakeIndexAdmin{indices: map[string][]*domain.LogEntry{}, aliases: map[string]string{}}
+	cfg := config.ArchiveConfig{AfterDays: 1, LookbackDays: 3, SegmentSize: 2, RehydrateTTL: time.Hour}
+	repo := &memLogRepo{entries: testEntries(day)}
+
+	_, err = NewArchiveService(repo, store, indexAdmin, noopLocker{}, cfg).ArchiveDay(context.Background(), day)
+	require.NoError(t, err)
+
+	svc := NewArchiveService(repo, corruptingStore{store}, indexAdmin, noopLocker{}, cfg)
+	_, err = svc.Rehydrate(context.Background(), day, day.AddDate(0, 0, 1))
+	assert.ErrorIs(t, err, ErrSegmentChecksum)
+	assert.Empty(t, indexAdmin.indices, "nothing indexed, half-loaded index removed")
+}
+
+func TestRehydrate_InvalidRange(t *testing.T) {
+	svc, _ := newTestArchiveService(t, nil)
+	now := time.Now()
+
+	_, err := svc.Rehydrate(context.Background(), now, now.Add(-time.Hour))
+	assert.ErrorIs(t, err, ErrInvalidRehydrateRange)
+
+	// The live index can never be dropped through the archive API
+	assert.ErrorIs(t, svc.DropRehydrated(context.Background(), "logs"), ErrNotRehydratedIndex)
+}
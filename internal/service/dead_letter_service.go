@@ -0,0 +1,46 @@
+package service
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/Yupoer/logpulse/internal/domain"
+)
+
+const (
+	defaultDeadLetterLimit = 50
+	maxDeadLetterLimit     = 500
+)
+
+// DeadLetterService lets operators inspect messages the consumer gave up on
+// and send them back through the pipeline once the cause is fixed.
+type DeadLetterService struct {
+	queue domain.DeadLetterQueue
+}
+
+func NewDeadLetterService(queue domain.DeadLetterQueue) *DeadLetterService {
+	return &DeadLetterService{queue: queue}
+}
+
+// List returns the most recent dead letters, newest first.
+// limit applies per partition of the dead-letter topic.
+func (s *DeadLetterService) List(ctx context.Context, limit int) ([]*domain.DeadLetter, error) {
+	if limit <= 0 {
+		limit = defaultDeadLetterLimit
+	}
+	return s.queue.List(ctx, min(limit, maxDeadLetterLimit))
+}
+
+func (s *DeadLetterService) Get(ctx context.Context, partition int32, offset int64) (*domain.DeadLetter, error) {
+	return s.queue.Get(ctx, partition, offset)
+}
+
+// Replay re-publishes the original message to its source topic. The dead
+// letter itself stays in the topic until retention removes it.
+func (s *DeadLetterService) Replay(ctx context.Context, partition int32, offset int64) error {
+	if err := s.queue.Replay(ctx, partition, offset); err != nil {
+		return err
+	}
+	slog.InfoContext(ctx, "Replayed dead letter", "partition", partition, "offset", offset)
+	return nil
+}
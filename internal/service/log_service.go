@@ -2,9 +2,11 @@ package service
 
 import (
 	"context"
-	"log"
+	"log/slog"
+	"time"
 
 	"github.com/Yupoer/logpulse/internal/domain"
+	"github.com/Yupoer/logpulse/internal/metrics"
 )
 
 type LogService struct {
@@ -31,32 +33,49 @@ func (s *LogService) CreateLog(ctx context.Context, entry *domain.LogEntry) (int
 	return s.cacheRepo.GetLogCount(ctx)
 }
 
-func (s *LogService) GetLog(ctx context.Context, id uint) (*domain.LogEntry, error) {
+// GetLog returns the entry with id, from the cache when it is there. day,
+// if set, is the entry's timestamp day and narrows the DB lookup to it.
+func (s *LogService) GetLog(ctx context.Context, id uint, day time.Time) (*domain.LogEntry, error) {
 	// 1. Check Redis Cache
 	cachedEntry, err := s.cacheRepo.GetLog(ctx, id)
 	if err != nil {
-		log.Printf("[Warn] Cache error: %v", err)
+		slog.WarnContext(ctx, "Cache error", "id", id, "error", err)
 	}
 	if cachedEntry != nil {
-		log.Println("[Cache] Hit")
+		slog.DebugContext(ctx, "Cache hit", "id", id)
+		metrics.CacheRequests.WithLabelValues("hit").Inc()
 		return cachedEntry, nil
 	}
 
 	// 2. Cache Miss -> Check MySQL
-	log.Println("[Cache] Miss, querying DB...")
-	dbEntry, err := s.logRepo.GetByID(ctx, id)
+	slog.DebugContext(ctx, "Cache miss, querying DB", "id", id)
+	metrics.CacheRequests.WithLabelValues("miss").Inc()
+	dbEntry, err := s.logRepo.GetByID(ctx, id, day)
 	if err != nil {
 		return nil, err
 	}
 
 	// 3. Write back to Cache
 	if err := s.cacheRepo.SetLog(ctx, dbEntry); err != nil {
-		log.Printf("[Warn] Failed to set cache: %v", err)
+		slog.WarnContext(ctx, "Failed to set cache", "id", id, "error", err)
 	}
 
 	return dbEntry, nil
 }
 
-func (s *LogService) SearchLogs(ctx context.Context, query string) ([]*domain.LogEntry, error) {
-	return s.esRepo.Search(ctx, query)
+// SearchLogs queries Elasticsearch and falls back to the relational DB when
+// ES fails. Fallback results are flagged as degraded: message matching is a
+// plain substring match and only recent data is scanned by default.
+func (s *LogService) SearchLogs(ctx context.Context, query domain.LogSearchQuery) (*domain.LogSearchResult, error) {
+	logs, err := s.esRepo.Search(ctx, query)
+	if err == nil {
+		return &domain.LogSearchResult{Logs: logs}, nil
+	}
+	slog.WarnContext(ctx, "Search failed, falling back to DB", "error", err)
+
+	logs, dbErr := s.logRepo.Search(ctx, query)
+	if dbErr != nil {
+		return nil, dbErr
+	}
+	return &domain.LogSearchResult{Logs: logs, Degraded: true}, nil
 }
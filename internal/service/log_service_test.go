@@ -2,9 +2,13 @@ package service
 
 import (
 	"context"
+	"errors"
 	"testing"
+	"time"
 
 	"github.com/Yupoer/logpulse/internal/domain"
+	"github.com/Yupoer/logpulse/internal/metrics"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 )
@@ -44,15 +48,30 @@ func (m *MockCacheRepo) GetLog(ctx context.Context, id uint) (*domain.LogEntry,
 type MockLogRepo struct{ mock.Mock }
 
 func (m *MockLogRepo) Create(ctx context.Context, entry *domain.LogEntry) error { return nil }
-func (m *MockLogRepo) GetByID(ctx context.Context, id uint) (*domain.LogEntry, error) {
+func (m *MockLogRepo) GetByID(ctx context.Context, id uint, day time.Time) (*domain.LogEntry, error) {
 	return nil, nil
 }
+func (m *MockLogRepo) FindByTimeRange(ctx context.Context, from, to time.Time, afterID uint, limit int) ([]*domain.LogEntry, error) {
+	return nil, nil
+}
+func (m *MockLogRepo) FindByIDRange(ctx context.Context, afterID, untilID uint, limit int) ([]*domain.LogEntry, error) {
+	return nil, nil
+}
+func (m *MockLogRepo) MaxID(ctx context.Context) (uint, error) { return 0, nil }
+func (m *MockLogRepo) Search(ctx context.Context, query domain.LogSearchQuery) ([]*domain.LogEntry, error) {
+	args := m.Called(ctx, query)
+	logs, _ := args.Get(0).([]*domain.LogEntry)
+	return logs, args.Error(1)
+}
 
 type MockESRepo struct{ mock.Mock }
 
 func (m *MockESRepo) BulkIndex(ctx context.Context, entries []*domain.LogEntry) error { return nil }
-func (m *MockESRepo) Search(ctx context.Context, query string) ([]*domain.LogEntry, error) {
-	return nil, nil
+func (m *MockESRepo) Ping(ctx context.Context) error                                  { return nil }
+func (m *MockESRepo) Search(ctx context.Context, query domain.LogSearchQuery) ([]*domain.LogEntry, error) {
+	args := m.Called(ctx, query)
+	logs, _ := args.Get(0).([]*domain.LogEntry)
+	return logs, args.Error(1)
 }
 
 // --- Tests ---
@@ -85,3 +104,61 @@ func TestCreateLog(t *testing.T) {
 	mockProducer.AssertExpectations(t)
 	mockCache.AssertExpectations(t)
 }
+
+func TestSearchLogs_Elasticsearch(t *testing.T) {
+	mockLogRepo := new(MockLogRepo)
+	mockESRepo := new(MockESRepo)
+	query := domain.LogSearchQuery{Query: "timeout", Level: "ERROR"}
+
+	mockESRepo.On("Search", mock.Anything, query).Return([]*domain.LogEntry{{Message: "timeout"}}, nil)
+
+	service := NewLogService(new(MockProducer), mockLogRepo, new(MockCacheRepo), mockESRepo)
+	result, err := service.SearchLogs(context.Background(), query)
+
+	assert.NoError(t, err)
+	assert.False(t, result.Degraded)
+	assert.Len(t, result.Logs, 1)
+	// DB fallback is not touched while ES is healthy
+	mockLogRepo.AssertNotCalled(t, "Search", mock.Anything, mock.Anything)
+}
+
+func TestSearchLogs_FallbackOnESError(t *testing.T) {
+	mockLogRepo := new(MockLogRepo)
+	mockESRepo := new(MockESRepo)
+	query := domain.LogSearchQuery{Query: "timeout", ServiceName: "payment-service"}
+
+	mockESRepo.On("Search", mock.Anything, query).Return(nil, errors.New("connection refused"))
+	mockLogRepo.On("Search", mock.Anything, query).Return([]*domain.LogEntry{{Message: "timeout"}}, nil)
+
+	service := NewLogService(new(MockProducer), mockLogRepo, new(MockCacheRepo), mockESRepo)
+	result, err := service.SearchLogs(context.Background(), query)
+
+	assert.NoError(t, err)
+	assert.True(t, result.Degraded)
+	assert.Len(t, result.Logs, 1)
+	mockLogRepo.AssertExpectations(t)
+}
+
+func TestSearchLogs_BothFail(t *testing.T) {
+	mockLogRepo := new(MockLogRepo)
+	mockESRepo := new(MockESRepo)
+	query := domain.LogSearchQuery{Query: "timeout"}
+
+	mockESRepo.On("Search", mock.Anything, query).Return(nil, errors.New("connection refused"))
+	mockLogRepo.On("Search", mock.Anything, query).Return(nil, errors.New("too many connections"))
+
+	service := NewLogService(new(MockProducer), mockLogRepo, new(MockCacheRepo), mockESRepo)
+	_, err := service.SearchLogs(context.Background(), query)
+
+	assert.Error(t, err)
+}
+
+func TestGetLog_CountsCacheMiss(t *testing.T) {
+	service := NewLogService(new(MockProducer), new(MockLogRepo), new(MockCacheRepo), new(MockESRepo))
+	misses := testutil.ToFloat64(metrics.CacheRequests.WithLabelValues("miss"))
+
+	_, err := service.GetLog(context.Background(), 1, time.Time{})
+
+	assert.NoError(t, err)
+	assert.Equal(t, misses+1, testutil.ToFloat64(metrics.CacheRequests.WithLabelValues("miss")))
+}
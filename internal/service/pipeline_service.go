@@ -0,0 +1,96 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/Yupoer/logpulse/internal/domain"
+)
+
+// PipelineService reports how far the consumer groups are behind and what
+// each worker replica is doing, so operators can tell a stalled pipeline
+// from a slow one.
+type PipelineService struct {
+	offsets domain.OffsetInspector
+	stats   domain.ConsumerStatsStore
+	groups  []string
+}
+
+// NewPipelineService reports partition lag through offsets, which may be nil
+// for queue backends without one. groups lists the consumer group of every
+// lane.
+func NewPipelineService(offsets domain.OffsetInspector, stats domain.ConsumerStatsStore, groups []string) *PipelineService {
+	return &PipelineService{offsets: offsets, stats: stats, groups: groups}
+}
+
+// Status combines broker-side lag with the stats of every live replica.
+// Counters are summed over replicas; LastFlushAt is the most recent flush.
+func (s *PipelineService) Status(ctx context.Context) (*domain.PipelineStatus, error) {
+	var lags []domain.PartitionLag
+	if s.offsets != nil {
+		var err error
+		if lags, err = s.offsets.PartitionLags(ctx); err != nil {
+			return nil, fmt.Errorf("read partition lag: %w", err)
+		}
+	}
+	replicas, err := s.stats.List(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("read consumer stats: %w", err)
+	}
+	sort.Slice(replicas, func(i, j int) bool { return replicas[i].Replica < replicas[j].Replica })
+
+	status := &domain.PipelineStatus{Groups: s.groups, Partitions: lags, Replicas: replicas}
+	for _, lag := range lags {
+		status.TotalLag += lag.Lag
+	}
+	for _, r := range replicas {
+		status.BatchFill += r.BatchFill
+		status.DBErrors += r.DBErrors
+		status.ESErrors += r.ESErrors
+		status.DeadLettered += r.DeadLettered
+		if r.LastFlushAt.After(status.LastFlushAt) {
+			status.LastFlushAt = r.LastFlushAt
+		}
+	}
+	return status, nil
+}
+
+// ReplicaName identifies this process among the worker replicas
+func ReplicaName() string {
+	host, err := os.Hostname()
+	if err != nil {
+		host = "unknown"
+	}
+	return fmt.Sprintf("%s-%d", host, os.Getpid())
+}
+
+// PublishConsumerStats writes source's stats to store every interval until
+// ctx is done. Entries live for three intervals, so a replica that stops
+// publishing disappears from the status shortly after.
+func PublishConsumerStats(ctx context.Context, store domain.ConsumerStatsStore, replica string, source func() domain.ConsumerStats, interval time.Duration) {
+	publish := func() {
+		stats := source()
+		stats.Replica = replica
+		stats.UpdatedAt = time.Now()
+		if err := store.Publish(ctx, stats, 3*interval); err != nil && ctx.Err() == nil {
+			slog.Warn("Failed to publish consumer stats", "error", err)
+		}
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	publish()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			publish()
+		}
+	}
+}
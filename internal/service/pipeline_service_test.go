@@ -0,0 +1,105 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Yupoer/logpulse/internal/domain"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fixedOffsetInspector struct {
+	lags []domain.PartitionLag
+	err  error
+}
+
+func (f *fixedOffsetInspector) PartitionLags(ctx context.Context) ([]domain.PartitionLag, error) {
+	return f.lags, f.err
+}
+
+func (f *fixedOffsetInspector) Close() error { return nil }
+
+type memConsumerStats struct {
+	mu    sync.Mutex
+	stats map[string]domain.ConsumerStats
+}
+
+func (m *memConsumerStats) Publish(ctx context.Context, stats domain.ConsumerStats, ttl time.Duration) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.stats[stats.Replica] = stats
+	return nil
+}
+
+func (m *memConsumerStats) List(ctx context.Context) ([]*domain.ConsumerStats, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	out := make([]*domain.ConsumerStats, 0, len(m.stats))
+	for _, s := range m.stats {
+		out = append(out, &s)
+	}
+	return out, nil
+}
+
+func TestPipelineStatus_AggregatesReplicas(t *testing.T) {
+	earlier := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	later := earlier.Add(time.Minute)
+	store := &memConsumerStats{stats: map[string]domain.ConsumerStats{
+		"worker-b": {Replica: "worker-b", BatchFill: 5, LastFlushAt: later, DBErrors: 1, DeadLettered: 2},
+		"worker-a": {Replica: "worker-a", BatchFill: 7, LastFlushAt: earlier, ESErrors: 3},
+	}}
+	offsets := &fixedOffsetInspector{lags: []domain.PartitionLag{
+		{Group: "logpulse-group", Topic: "logs", Partition: 0, Committed: 90, HighWater: 100, Lag: 10},
+		{Group: "logpulse-group", Topic: "logs", Partition: 1, Committed: -1, HighWater: 4, Lag: 4},
+		{Group: "logpulse-group-high", Topic: "logs-high", Partition: 0, Committed: 7, HighWater: 9, Lag: 2},
+	}}
+	groups := []string{"logpulse-group", "logpulse-group-high"}
+
+	status, err := NewPipelineService(offsets, store, groups).Status(context.Background())
+	require.NoError(t, err)
+
+	assert.Equal(t, groups, status.Groups)
+	assert.Equal(t, int64(16), status.TotalLag)
+	assert.Equal(t, 12, status.BatchFill)
+	assert.Equal(t, later, status.LastFlushAt)
+	assert.Equal(t, int64(1), status.DBErrors)
+	assert.Equal(t, int64(3), status.ESErrors)
+	assert.Equal(t, int64(2), status.DeadLettered)
+	require.Len(t, status.Replicas, 2)
+	assert.Equal(t, "worker-a", status.Replicas[0].Replica)
+}
+
+func TestPipelineStatus_OffsetError(t *testing.T) {
+	offsets := &fixedOffsetInspector{err: errors.New("broker down")}
+	_, err := NewPipelineService(offsets, &memConsumerStats{}, []string{"logpulse-group"}).Status(context.Background())
+	assert.Error(t, err)
+}
+
+func TestPublishConsumerStats(t *testing.T) {
+	store := &memConsumerStats{stats: map[string]domain.ConsumerStats{}}
+	ctx, cancel := context.WithCancel(context.Background())
+
+	done := make(chan struct{})
+	go func() {
+		PublishConsumerStats(ctx, store, "worker-a", func() domain.ConsumerStats {
+			return domain.ConsumerStats{BatchFill: 3}
+		}, time.Hour)
+		close(done)
+	}()
+
+	// The first publish happens right away, not after one interval
+	require.Eventually(t, func() bool {
+		stats, _ := store.List(context.Background())
+		return len(stats) == 1
+	}, time.Second, 10*time.Millisecond)
+	cancel()
+	<-done
+
+	stats := store.stats["worker-a"]
+	assert.Equal(t, 3, stats.BatchFill)
+	assert.False(t, stats.UpdatedAt.IsZero())
+}
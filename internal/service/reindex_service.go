@@ -0,0 +1,211 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/Yupoer/logpulse/internal/domain"
+)
+
+// catch-up passes pick up rows inserted while the main pass was running
+const reindexCatchUpPasses = 3
+
+type ReindexOptions struct {
+	Index          string  // Target index, created unless resuming ("" = the checkpoint's, else logs-<timestamp>)
+	Mapping        []byte  // Optional settings/mappings for the new index
+	Alias          string  // Switched to Index when done ("" = leave aliases alone)
+	ReplaceIndex   bool    // Allow deleting a concrete index named Alias during the switch
+	BatchSize      int     // Entries per DB page and bulk request
+	Rate           float64 // Max entries per second (0 = unlimited)
+	CheckpointPath string  // Progress is saved here after every batch
+	ProgressEvery  time.Duration
+}
+
+// ReindexCheckpoint is persisted after every batch so an interrupted run can resume
+type ReindexCheckpoint struct {
+	Index     string    `json:"index"`
+	LastID    uint      `json:"last_id"`
+	Indexed   int64     `json:"indexed"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// ReindexService rebuilds a search index from the relational DB,
+// which is the durable copy of every log.
+type ReindexService struct {
+	logRepo    domain.LogRepository
+	indexAdmin domain.LogIndexAdmin
+}
+
+func NewReindexService(logRepo domain.LogRepository, indexAdmin domain.LogIndexAdmin) *ReindexService {
+	return &ReindexService{logRepo: logRepo, indexAdmin: indexAdmin}
+}
+
+// Run streams log_entries by ID range into opts.Index, then switches
+// opts.Alias to it. A checkpoint left by an interrupted run for the same
+// index, or for any index when opts.Index is empty, is resumed; it is
+// removed once the run completes.
+func (s *ReindexService) Run(ctx context.Context, opts ReindexOptions) (*ReindexCheckpoint, error) {
+	cp, err := loadReindexCheckpoint(opts.CheckpointPath)
+	if err != nil {
+		return nil, err
+	}
+
+	if opts.Index == "" {
+		opts.Index = fmt.Sprintf("logs-%s", time.Now().Format("20060102150405"))
+		if cp != nil {
+			opts.Index = cp.Index
+		}
+	}
+
+	switch {
+	case cp == nil:
+		if err := s.indexAdmin.CreateIndex(ctx, opts.Index, opts.Mapping); err != nil {
+			return nil, err
+		}
+		cp = &ReindexCheckpoint{Index: opts.Index}
+		slog.Info("Created index", "index", opts.Index)
+	case cp.Index != opts.Index:
+		return nil, fmt.Errorf("checkpoint %s belongs to index %s, remove it or reindex into that index", opts.CheckpointPath, cp.Index)
+	default:
+		slog.Info("Resuming reindex", "index", cp.Index, "after_id", cp.LastID, "indexed", cp.Indexed)
+	}
+
+	for pass := 0; pass < reindexCatchUpPasses; pass++ {
+		maxID, err := s.logRepo.MaxID(ctx)
+		if err != nil {
+			return cp, err
+		}
+		if maxID <= cp.LastID {
+			break // Caught up
+		}
+		if err := s.copyRange(ctx, opts, cp, maxID); err != nil {
+			return cp, err
+		}
+	}
+
+	if opts.Alias != "" {
+		if err := s.indexAdmin.SwitchAlias(ctx, opts.Alias, opts.Index, opts.ReplaceIndex); err != nil {
+			return cp, err
+		}
+		slog.Info("Alias switched", "alias", opts.Alias, "index", opts.Index)
+
+		// Rows written between the last pass and the switch went to the old
+		// index only. Document IDs are the DB IDs, so copying them again is safe.
+		maxID, err := s.logRepo.MaxID(ctx)
+		if err != nil {
+			return cp, err
+		}
+		if err := s.copyRange(ctx, opts, cp, maxID); err != nil {
+			return cp, err
+		}
+	}
+
+	if err := os.Remove(opts.CheckpointPath); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return cp, err
+	}
+	slog.Info("Reindex done", "indexed", cp.Indexed, "index", cp.Index)
+	return cp, nil
+}
+
+// copyRange indexes all entries with cp.LastID < id <= untilID, saving the
+// checkpoint after every batch and pacing itself to opts.Rate.
+func (s *ReindexService) copyRange(ctx context.Context, opts ReindexOptions, cp *ReindexCheckpoint, untilID uint) error {
+	startID := cp.LastID
+	started := time.Now()
+	lastReport := started
+	var copied int64
+
+	for cp.LastID < untilID {
+		entries, err := s.logRepo.FindByIDRange(ctx, cp.LastID, untilID, opts.BatchSize)
+		if err != nil {
+			return err
+		}
+		if len(entries) == 0 {
+			cp.LastID = untilID // Only gaps (deleted rows) left
+			break
+		}
+
+		if err := s.indexAdmin.BulkIndexInto(ctx, opts.Index, entries); err != nil {
+			return err
+		}
+
+		cp.LastID = entries[len(entries)-1].ID
+		cp.Indexed += int64(len(entries))
+		cp.UpdatedAt = time.Now()
+		copied += int64(len(entries))
+		if err := saveReindexCheckpoint(opts.CheckpointPath, cp); err != nil {
+			return err
+		}
+
+		if opts.ProgressEvery > 0 && time.Since(lastReport) >= opts.ProgressEvery {
+			lastReport = time.Now()
+			elapsed := time.Since(started).Seconds()
+			slog.Info("Reindex progress",
+				"last_id", cp.LastID, "until_id", untilID,
+				"percent", math.Round(1000*float64(cp.LastID-startID)/float64(untilID-startID))/10,
+				"indexed", cp.Indexed, "logs_per_second", math.Round(float64(copied)/elapsed))
+		}
+
+		if err := throttle(ctx, opts.Rate, copied, started); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// throttle sleeps until copied entries fit into rate per second since started
+func throttle(ctx context.Context, rate float64, copied int64, started time.Time) error {
+	if rate <= 0 {
+		return nil
+	}
+	ahead := time.Duration(float64(copied)/rate*float64(time.Second)) - time.Since(started)
+	if ahead <= 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(ahead)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+func loadReindexCheckpoint(path string) (*ReindexCheckpoint, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var cp ReindexCheckpoint
+	if err := json.Unmarshal(data, &cp); err != nil {
+		return nil, fmt.Errorf("corrupt checkpoint %s: %w", path, err)
+	}
+	return &cp, nil
+}
+
+// saveReindexCheckpoint writes via a temp file + rename, so a crash never
+// leaves a truncated checkpoint behind
+func saveReindexCheckpoint(path string, cp *ReindexCheckpoint) error {
+	data, err := json.Marshal(cp)
+	if err != nil {
+		return err
+	}
+	tmp := filepath.Join(filepath.Dir(path), "."+filepath.Base(path)+".tmp")
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
@@ -0,0 +1,77 @@
+package service
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Yupoer/logpulse/internal/domain"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestReindex(t *testing.T) (*ReindexService, *fakeIndexAdmin, ReindexOptions) {
+	entries := testEntries(time.Date(2024, 3, 1, 0, 0, 0, 0, time.Local)) // IDs 1..6
+	indexAdmin := &fakeIndexAdmin{indices: map[string][]*domain.LogEntry{}, aliases: map[string]string{}}
+
+	opts := ReindexOptions{
+		Index:          "logs-v2",
+		Alias:          "logs",
+		BatchSize:      2,
+		CheckpointPath: filepath.Join(t.TempDir(), "reindex.checkpoint.json"),
+	}
+	return NewReindexService(&memLogRepo{entries: entries}, indexAdmin), indexAdmin, opts
+}
+
+func TestReindex_Full(t *testing.T) {
+	svc, indexAdmin, opts := newTestReindex(t)
+
+	cp, err := svc.Run(context.Background(), opts)
+	require.NoError(t, err)
+
+	assert.Equal(t, uint(6), cp.LastID)
+	assert.Equal(t, "logs-v2", indexAdmin.aliases["logs"])
+	// The post-switch catch-up pass finds nothing new, so nothing is indexed twice
+	assert.Len(t, indexAdmin.indices["logs-v2"], 6)
+
+	// Checkpoint is removed once the run completes
+	_, err = os.Stat(opts.CheckpointPath)
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestReindex_ResumeFromCheckpoint(t *testing.T) {
+	svc, indexAdmin, opts := newTestReindex(t)
+	require.NoError(t, saveReindexCheckpoint(opts.CheckpointPath, &ReindexCheckpoint{Index: "logs-v2", LastID: 4, Indexed: 4}))
+
+	cp, err := svc.Run(context.Background(), opts)
+	require.NoError(t, err)
+
+	// Only IDs 5 and 6 are copied, and the index is not re-created
+	require.Len(t, indexAdmin.indices["logs-v2"], 2)
+	assert.Equal(t, uint(5), indexAdmin.indices["logs-v2"][0].ID)
+	assert.Equal(t, int64(6), cp.Indexed)
+}
+
+func TestReindex_ResumeWithoutIndex(t *testing.T) {
+	svc, indexAdmin, opts := newTestReindex(t)
+	require.NoError(t, saveReindexCheckpoint(opts.CheckpointPath, &ReindexCheckpoint{Index: "logs-v2", LastID: 4, Indexed: 4}))
+
+	// A re-run without -index continues into the checkpoint's index
+	opts.Index = ""
+	cp, err := svc.Run(context.Background(), opts)
+	require.NoError(t, err)
+
+	assert.Equal(t, "logs-v2", cp.Index)
+	assert.Len(t, indexAdmin.indices["logs-v2"], 2)
+	assert.Equal(t, "logs-v2", indexAdmin.aliases["logs"])
+}
+
+func TestReindex_CheckpointForOtherIndex(t *testing.T) {
+	svc, _, opts := newTestReindex(t)
+	require.NoError(t, saveReindexCheckpoint(opts.CheckpointPath, &ReindexCheckpoint{Index: "logs-v1", LastID: 2}))
+
+	_, err := svc.Run(context.Background(), opts)
+	assert.Error(t, err)
+}